@@ -0,0 +1,262 @@
+// Or16Way.tst: generated by n2t gen from a model of the chip.
+
+load Or16Way.hdl,
+output-file Or16Way.out,
+compare-to Or16Way.cmp,
+output-list in%B1.16.1 out%B2.1.2;
+
+set in %B0100110111000111,
+eval,
+output;
+
+set in %B1000001000100001,
+eval,
+output;
+
+set in %B0000000000000000,
+eval,
+output;
+
+set in %B0101101010101111,
+eval,
+output;
+
+set in %B0101111111110001,
+eval,
+output;
+
+set in %B1000000000000000,
+eval,
+output;
+
+set in %B0101110010010101,
+eval,
+output;
+
+set in %B0100110111000111,
+eval,
+output;
+
+set in %B0000100011011010,
+eval,
+output;
+
+set in %B0111111111111111,
+eval,
+output;
+
+set in %B1100110100101011,
+eval,
+output;
+
+set in %B0100110011111000,
+eval,
+output;
+
+set in %B0001011111110111,
+eval,
+output;
+
+set in %B1000001000100001,
+eval,
+output;
+
+set in %B0111101100001111,
+eval,
+output;
+
+set in %B1000001000100001,
+eval,
+output;
+
+set in %B0000010010111011,
+eval,
+output;
+
+set in %B0100110111000111,
+eval,
+output;
+
+set in %B0100110111000111,
+eval,
+output;
+
+set in %B0010001101000011,
+eval,
+output;
+
+set in %B0000010010111011,
+eval,
+output;
+
+set in %B0011101011100100,
+eval,
+output;
+
+set in %B1010010001011001,
+eval,
+output;
+
+set in %B1001101000001111,
+eval,
+output;
+
+set in %B0000010010111011,
+eval,
+output;
+
+set in %B0000000000000000,
+eval,
+output;
+
+set in %B0111111111111111,
+eval,
+output;
+
+set in %B1111011110101011,
+eval,
+output;
+
+set in %B1110100000011110,
+eval,
+output;
+
+set in %B1000001000100001,
+eval,
+output;
+
+set in %B0110011110100100,
+eval,
+output;
+
+set in %B0100110111000111,
+eval,
+output;
+
+set in %B0000110100100010,
+eval,
+output;
+
+set in %B0100011011101000,
+eval,
+output;
+
+set in %B1010011011110110,
+eval,
+output;
+
+set in %B0110100000100110,
+eval,
+output;
+
+set in %B0000010010111011,
+eval,
+output;
+
+set in %B0000000000000000,
+eval,
+output;
+
+set in %B1101001101111001,
+eval,
+output;
+
+set in %B1001101000001111,
+eval,
+output;
+
+set in %B0000010010111011,
+eval,
+output;
+
+set in %B0000010010111011,
+eval,
+output;
+
+set in %B1010010010110010,
+eval,
+output;
+
+set in %B0001100001011000,
+eval,
+output;
+
+set in %B0001110111110011,
+eval,
+output;
+
+set in %B0111111111111111,
+eval,
+output;
+
+set in %B0111111111111111,
+eval,
+output;
+
+set in %B0100110111000111,
+eval,
+output;
+
+set in %B0000010010111011,
+eval,
+output;
+
+set in %B0110100111111101,
+eval,
+output;
+
+set in %B1110111101111010,
+eval,
+output;
+
+set in %B0111111011110101,
+eval,
+output;
+
+set in %B0010010001110000,
+eval,
+output;
+
+set in %B0101111100101001,
+eval,
+output;
+
+set in %B0110001100000110,
+eval,
+output;
+
+set in %B1111111111111111,
+eval,
+output;
+
+set in %B0010101111111001,
+eval,
+output;
+
+set in %B1011000001110110,
+eval,
+output;
+
+set in %B0011100111101010,
+eval,
+output;
+
+set in %B0000010010111011,
+eval,
+output;
+
+set in %B1111110011010110,
+eval,
+output;
+
+set in %B0100110111000111,
+eval,
+output;
+
+set in %B0001010010100101,
+eval,
+output;
+
+set in %B0000000000000000,
+eval,
+output;
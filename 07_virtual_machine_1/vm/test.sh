@@ -0,0 +1,2 @@
+# Runs the CPU emulator scripts of this project against the shared VM translator.
+cd "$(dirname "$0")/.." && go run ../tools/n2t test $(ls */*/*.tst | grep -v VME.tst)
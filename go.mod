@@ -0,0 +1,3 @@
+module github.com/christopher-weiss/nand2tetris
+
+go 1.21
@@ -0,0 +1,375 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+var predefSymbols = map[string]int{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"R0":     0,
+	"R1":     1,
+	"R2":     2,
+	"R3":     3,
+	"R4":     4,
+	"R5":     5,
+	"R6":     6,
+	"R7":     7,
+	"R8":     8,
+	"R9":     9,
+	"R10":    10,
+	"R11":    11,
+	"R12":    12,
+	"R13":    13,
+	"R14":    14,
+	"R15":    15,
+	"SCREEN": 16384,
+	"KBD":    24576,
+}
+
+/*
+ * PredefinedSymbols returns the RAM addresses of the symbols every program
+ * can use without defining them.
+ */
+func PredefinedSymbols() map[string]int {
+	symbols := map[string]int{}
+	for symbol, address := range predefSymbols {
+		symbols[symbol] = address
+	}
+	return symbols
+}
+
+type CommandType int
+
+const (
+	A_COMMAND CommandType = iota
+	C_COMMAND
+	L_COMMAND
+)
+
+type Command struct {
+	CommandType CommandType
+	Symbol      string
+	Dest        string
+	Comp        string
+	Jmp         string
+	Value       int
+	Line        int
+}
+
+/*
+ * Program is a parsed .asm file with all symbols resolved.
+ */
+type Program struct {
+	Commands    []Command
+	SymbolTable map[string]int
+}
+
+/*
+ * Assemble reads an .asm program and returns its Hack machine code, one string of
+ * binary digits per instruction.
+ */
+func Assemble(r io.Reader) ([]string, error) {
+	program, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return program.Translate()
+}
+
+/*
+ * Parse .asm file in two passes.
+ */
+func Parse(r io.Reader) (*Program, error) {
+	program := &Program{SymbolTable: map[string]int{}}
+	for symbol, address := range predefSymbols {
+		program.SymbolTable[symbol] = address
+	}
+
+	address := 0
+	lineNumber := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		command, ok, err := parseLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		if !ok {
+			continue
+		}
+		command.Line = lineNumber
+		if command.CommandType == L_COMMAND {
+			program.SymbolTable[command.Symbol] = address
+		} else {
+			address++
+		}
+		program.Commands = append(program.Commands, command)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	variableAddress := 16
+	for index := range program.Commands {
+		command := program.Commands[index]
+		if command.CommandType == A_COMMAND {
+			if value, exists := program.SymbolTable[command.Symbol]; exists {
+				program.Commands[index].Value = value
+			} else if address, err := strconv.Atoi(command.Symbol); err == nil {
+				// @<address> e.g. @123
+				program.Commands[index].Value = address
+			} else {
+				//@<variable> e.g. @var
+				program.Commands[index].Value = variableAddress
+				program.SymbolTable[command.Symbol] = variableAddress
+				variableAddress++
+			}
+		}
+	}
+
+	return program, nil
+}
+
+/*
+ * Labels returns the ROM address of each label (LOOP) of the program, without
+ * the predefined symbols and variables of the symbol table.
+ */
+func (p *Program) Labels() map[string]int {
+	labels := map[string]int{}
+	for _, command := range p.Commands {
+		if command.CommandType == L_COMMAND {
+			labels[command.Symbol] = p.SymbolTable[command.Symbol]
+		}
+	}
+	return labels
+}
+
+/*
+ * Variables returns the RAM address of each predefined symbol (SP, R0, SCREEN,
+ * ...) and each variable of the program.
+ */
+func (p *Program) Variables() map[string]int {
+	variables := map[string]int{}
+	labels := p.Labels()
+	for symbol, address := range p.SymbolTable {
+		if _, isLabel := labels[symbol]; !isLabel {
+			variables[symbol] = address
+		}
+	}
+	return variables
+}
+
+/*
+ * Output symbol table for debugging purposes
+ */
+func (p *Program) WriteSymbolTable(w io.Writer) {
+	fmt.Fprintln(w, "=== Symbol Table ===")
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 8, 8, 0, '\t', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "\n %s\t%s\t", "Symbol", "Address")
+	fmt.Fprintf(tw, "\n %s\t%s\t", "----", "----")
+
+	symbols := make([]string, 0, len(p.SymbolTable))
+	for symbol := range p.SymbolTable {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		fmt.Fprintf(tw, "\n %s\t%d\t", symbol, p.SymbolTable[symbol])
+	}
+	fmt.Fprintln(tw)
+}
+
+/*
+ * Translate parsed commands into Hack machine code, represented as strings of binary digits.
+ */
+func (p *Program) Translate() ([]string, error) {
+	var code []string
+	for _, command := range p.Commands {
+		if command.CommandType == A_COMMAND {
+			if command.Value < 0 || command.Value > 32767 {
+				return nil, fmt.Errorf("line %d: address %d out of range", command.Line, command.Value)
+			}
+			binary := int64(command.Value)
+			aCommand := fmt.Sprintf("0%s", strconv.FormatInt(binary, 2))
+
+			code = append(code, fillZeros(aCommand))
+		}
+		if command.CommandType == C_COMMAND {
+			comp, ok := compCodes[command.Comp]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown computation %q", command.Line, command.Comp)
+			}
+			dest, ok := destCodes[command.Dest]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown destination %q", command.Line, command.Dest)
+			}
+			jmp, ok := jmpCodes[command.Jmp]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown jump %q", command.Line, command.Jmp)
+			}
+			cCommand := fmt.Sprintf("111%s%s%s", comp, dest, jmp)
+			code = append(code, cCommand)
+		}
+	}
+	return code, nil
+}
+
+var compCodes = map[string]string{
+	"0":   "0101010",
+	"1":   "0111111",
+	"-1":  "0111010",
+	"D":   "0001100",
+	"A":   "0110000",
+	"!D":  "0001101",
+	"!A":  "0110001",
+	"-D":  "0001111",
+	"-A":  "0110011",
+	"D+1": "0011111",
+	"A+1": "0110111",
+	"D-1": "0001110",
+	"A-1": "0110010",
+	"D+A": "0000010",
+	"D-A": "0010011",
+	"A-D": "0000111",
+	"D&A": "0000000",
+	"D|A": "0010101",
+	"M":   "1110000",
+	"!M":  "1110001",
+	"-M":  "1110011",
+	"M+1": "1110111",
+	"M-1": "1110010",
+	"D+M": "1000010",
+	"D-M": "1010011",
+	"M-D": "1000111",
+	"D&M": "1000000",
+	"D|M": "1010101",
+	// commutative forms accepted by the official assembler
+	"1+D": "0011111",
+	"1+A": "0110111",
+	"A+D": "0000010",
+	"A&D": "0000000",
+	"A|D": "0010101",
+	"1+M": "1110111",
+	"M+D": "1000010",
+	"M&D": "1000000",
+	"M|D": "1010101",
+}
+
+var destCodes = map[string]string{
+	"":    "000",
+	"M":   "001",
+	"D":   "010",
+	"MD":  "011",
+	"DM":  "011",
+	"A":   "100",
+	"AM":  "101",
+	"MA":  "101",
+	"AD":  "110",
+	"DA":  "110",
+	"AMD": "111",
+	"ADM": "111",
+}
+
+var jmpCodes = map[string]string{
+	"":    "000",
+	"JGT": "001",
+	"JEQ": "010",
+	"JGE": "011",
+	"JLT": "100",
+	"JNE": "101",
+	"JLE": "110",
+	"JMP": "111",
+}
+
+/*
+ * Takes a string representation of a binary number and fixes the length to 16,
+ * pre-appending 0s.
+ */
+func fillZeros(binaryStr string) string {
+	verb := fmt.Sprintf("%%%d.%ds", 16, 16)
+	resultWithSpaces := fmt.Sprintf(verb, binaryStr)
+	return strings.Replace(resultWithSpaces, " ", "0", 16)
+}
+
+/*
+ * Parse a single line; ok is false for empty and comment-only lines.
+ */
+func parseLine(line string) (Command, bool, error) {
+	// remove comments && trim whitespace
+	commentsRemoved := stripComment(line)
+	trimmedLine := strings.TrimSpace(commentsRemoved)
+
+	// ignore empty lines
+	if len(trimmedLine) == 0 {
+		return Command{}, false, nil
+	}
+
+	command := Command{}
+	switch trimmedLine[0] {
+	case '@':
+		command.CommandType = A_COMMAND
+		command.Symbol = trimmedLine[1:]
+		if command.Symbol == "" {
+			return Command{}, false, fmt.Errorf("missing symbol in %q", trimmedLine)
+		}
+	case '(':
+		command.CommandType = L_COMMAND
+		if !strings.HasSuffix(trimmedLine, ")") || len(trimmedLine) < 3 {
+			return Command{}, false, fmt.Errorf("malformed label %q", trimmedLine)
+		}
+		command.Symbol = trimmedLine[1 : len(trimmedLine)-1]
+	default:
+		command.CommandType = C_COMMAND
+		dest, comp, jmp, err := parseCCommand(trimmedLine)
+		if err != nil {
+			return Command{}, false, err
+		}
+		command.Dest, command.Comp, command.Jmp = dest, comp, jmp
+	}
+
+	return command, true, nil
+}
+
+/*
+ * Parse components of C-Command (dest=comp;jmp)
+ */
+func parseCCommand(cCommand string) (string, string, string, error) {
+	var dest = ""
+	var comp = cCommand
+	var jmp = ""
+
+	if index := strings.Index(comp, ";"); index >= 0 {
+		jmp = strings.TrimSpace(comp[index+1:])
+		comp = comp[:index]
+	}
+	if index := strings.Index(comp, "="); index >= 0 {
+		dest = strings.TrimSpace(comp[:index])
+		comp = comp[index+1:]
+	}
+	comp = strings.ReplaceAll(comp, " ", "")
+	if comp == "" {
+		return "", "", "", fmt.Errorf("missing computation in %q", cCommand)
+	}
+	return dest, comp, jmp, nil
+}
+
+func stripComment(source string) string {
+	if comment := strings.Index(source, "//"); comment >= 0 {
+		return strings.TrimRightFunc(source[:comment], unicode.IsSpace)
+	}
+	return source
+}
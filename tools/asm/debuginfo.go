@@ -0,0 +1,283 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * debugInfoVersion is written into debug info files and checked on reading.
+ */
+const debugInfoVersion = 1
+
+/*
+ * DebugInfo is what assembly discards and emulators, profilers and debuggers
+ * want back: the source line of each instruction, the ROM address of each
+ * label and the RAM address of each variable the assembler allocated.
+ */
+type DebugInfo struct {
+	Lines     []SourceLine
+	Labels    map[string]int
+	Variables map[string]int
+}
+
+/*
+ * SourceLine is where the code starting at ROM address Address comes from.
+ * It lasts until the address of the next SourceLine. Code without a source
+ * line, such as the bootstrap a VM translator adds, has an empty File. A File
+ * is relative to the directory of the debug info file, see SourceName, and
+ * readers look for the source there.
+ */
+type SourceLine struct {
+	Address int
+	File    string
+	Line    int
+}
+
+func (l SourceLine) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+/*
+ * SourceName is how debug info written to the file dbg names the source file
+ * at path: relative to the directory of dbg, so the two can move together, or
+ * absolute if there is no relative path.
+ */
+func SourceName(dbg, path string) string {
+	dir, err := filepath.Abs(filepath.Dir(dbg))
+	if err != nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		return rel
+	}
+	return abs
+}
+
+/*
+ * DebugInfo returns the debug info of the program, which was read from the
+ * source file named file, as SourceName names it.
+ */
+func (p *Program) DebugInfo(file string) *DebugInfo {
+	info := &DebugInfo{Labels: p.Labels(), Variables: map[string]int{}}
+	address := 0
+	for _, command := range p.Commands {
+		if command.CommandType != L_COMMAND {
+			info.Lines = append(info.Lines, SourceLine{address, file, command.Line})
+			address++
+		}
+	}
+	for symbol, address := range p.Variables() {
+		if _, predefined := predefSymbols[symbol]; !predefined {
+			info.Variables[symbol] = address
+		}
+	}
+	return info
+}
+
+/*
+ * Lookup returns the source line of the code containing the ROM address.
+ */
+func (d *DebugInfo) Lookup(address int) (SourceLine, bool) {
+	i := sort.Search(len(d.Lines), func(i int) bool { return d.Lines[i].Address > address }) - 1
+	if i < 0 || d.Lines[i].File == "" {
+		return SourceLine{}, false
+	}
+	return d.Lines[i], true
+}
+
+/*
+ * Address returns the ROM address of the first instruction of a source
+ * line.
+ */
+func (d *DebugInfo) Address(file string, line int) (int, bool) {
+	for _, l := range d.Lines {
+		if l.File == file && l.Line == line {
+			return l.Address, true
+		}
+	}
+	return 0, false
+}
+
+/*
+ * Write writes the debug info as text:
+ *
+ *	debug 1
+ *	file Pong.asm
+ *	line 0 12
+ *	line 1 13
+ *	line 2 -
+ *	label main.main 0
+ *	variable ball.x 16
+ *
+ * A file line names the source file of the line entries after it, each the
+ * ROM address of an instruction and its line number, or - for code without
+ * one. The name is the rest of the line after a single separator, so it may
+ * contain spaces. Labels are written in order of address, variables in
+ * order of allocation.
+ */
+func (d *DebugInfo) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "debug %d\n", debugInfoVersion)
+	file := ""
+	for _, l := range d.Lines {
+		if l.File == "" {
+			fmt.Fprintf(out, "line %d -\n", l.Address)
+			continue
+		}
+		if l.File != file {
+			file = l.File
+			fmt.Fprintf(out, "file %s\n", file)
+		}
+		fmt.Fprintf(out, "line %d %d\n", l.Address, l.Line)
+	}
+	for _, name := range sortedByAddress(d.Labels) {
+		fmt.Fprintf(out, "label %s %d\n", name, d.Labels[name])
+	}
+	for _, name := range sortedByAddress(d.Variables) {
+		fmt.Fprintf(out, "variable %s %d\n", name, d.Variables[name])
+	}
+	return out.Flush()
+}
+
+func sortedByAddress(symbols map[string]int) []string {
+	names := make([]string, 0, len(symbols))
+	for name := range symbols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if symbols[names[i]] != symbols[names[j]] {
+			return symbols[names[i]] < symbols[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+/*
+ * ParseDebugInfo reads debug info written by Write. name is used in error
+ * messages.
+ */
+func ParseDebugInfo(r io.Reader, name string) (*DebugInfo, error) {
+	info := &DebugInfo{Labels: map[string]int{}, Variables: map[string]int{}}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+	}
+	versioned := false
+	file := ""
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if !versioned {
+			if len(fields) != 2 || fields[0] != "debug" {
+				return nil, fail("not a debug info file")
+			}
+			if fields[1] != strconv.Itoa(debugInfoVersion) {
+				return nil, fail("debug info version %s, expected %d", fields[1], debugInfoVersion)
+			}
+			versioned = true
+			continue
+		}
+		switch fields[0] {
+		case "file":
+			// the name is the rest of the line after the keyword and one
+			// separator, spaces and all
+			rest := strings.TrimPrefix(strings.TrimLeftFunc(text, unicode.IsSpace), "file")
+			_, separator := utf8.DecodeRuneInString(rest)
+			if rest[separator:] == "" {
+				return nil, fail("expected file <name>")
+			}
+			file = rest[separator:]
+		case "line":
+			if len(fields) != 3 {
+				return nil, fail("expected line <address> <line>")
+			}
+			address, err := strconv.Atoi(fields[1])
+			if err != nil || address < 0 {
+				return nil, fail("invalid address %q", fields[1])
+			}
+			if n := len(info.Lines); n > 0 && info.Lines[n-1].Address >= address {
+				return nil, fail("address %d out of order", address)
+			}
+			if fields[2] == "-" {
+				info.Lines = append(info.Lines, SourceLine{Address: address})
+				continue
+			}
+			number, err := strconv.Atoi(fields[2])
+			if err != nil || number < 1 {
+				return nil, fail("invalid line number %q", fields[2])
+			}
+			if file == "" {
+				return nil, fail("line before file")
+			}
+			info.Lines = append(info.Lines, SourceLine{address, file, number})
+		case "label", "variable":
+			if len(fields) != 3 {
+				return nil, fail("expected %s <name> <address>", fields[0])
+			}
+			address, err := strconv.Atoi(fields[2])
+			if err != nil || address < 0 {
+				return nil, fail("invalid address %q", fields[2])
+			}
+			if fields[0] == "label" {
+				info.Labels[fields[1]] = address
+			} else {
+				info.Variables[fields[1]] = address
+			}
+		default:
+			return nil, fail("unknown entry %q", fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !versioned {
+		return nil, fmt.Errorf("%s: not a debug info file", name)
+	}
+	return info, nil
+}
+
+/*
+ * ReadDebugInfo reads a debug info file.
+ */
+func ReadDebugInfo(path string) (*DebugInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseDebugInfo(file, path)
+}
+
+/*
+ * WriteFile writes the debug info to a file.
+ */
+func (d *DebugInfo) WriteFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := d.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,96 @@
+package asm
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+ * TestDebugInfoRoundTrip writes debug info and reads it back: source files
+ * whose names contain or start with spaces, code without a source line,
+ * labels and variables.
+ */
+func TestDebugInfoRoundTrip(t *testing.T) {
+	info := &DebugInfo{
+		Lines: []SourceLine{
+			{0, "", 0},
+			{4, "my programs/Main.vm", 3},
+			{9, "my programs/Main.vm", 4},
+			{12, "Sys.vm", 1},
+			{15, "", 0},
+			{20, "my programs/Main.vm", 7},
+			{23, " Lib.vm", 2},
+		},
+		Labels:    map[string]int{"Main.main": 4, "Sys.init": 12, "Sys.init$LOOP": 12},
+		Variables: map[string]int{"Main.0": 16, "counter": 17},
+	}
+	var text strings.Builder
+	if err := info.Write(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "\nfile my programs/Main.vm\n") {
+		t.Errorf("no file line for my programs/Main.vm in\n%s", text.String())
+	}
+	got, err := ParseDebugInfo(strings.NewReader(text.String()), "Main.dbg")
+	if err != nil {
+		t.Fatalf("%v in\n%s", err, text.String())
+	}
+	if !reflect.DeepEqual(got, info) {
+		t.Errorf("read back %+v, want %+v", got, info)
+	}
+	if line, ok := got.Lookup(10); !ok || line.String() != "my programs/Main.vm:4" {
+		t.Errorf("ROM[10] comes from %v (%v), want my programs/Main.vm:4", line, ok)
+	}
+	if line, ok := got.Lookup(16); ok {
+		t.Errorf("ROM[16] comes from %v, want no source line", line)
+	}
+
+	// an indented file line, and one separated by a tab
+	for _, text := range []string{"debug 1\n  file Main.vm\nline 0 1\n", "debug 1\nfile\tMain.vm\nline 0 1\n"} {
+		got, err := ParseDebugInfo(strings.NewReader(text), "Main.dbg")
+		if err != nil || got.Lines[0].File != "Main.vm" {
+			t.Errorf("%q: read back %+v (%v), want file Main.vm", text, got, err)
+		}
+	}
+}
+
+/*
+ * TestParseDebugInfoErrors checks that malformed debug info is reported with
+ * its file and line.
+ */
+func TestParseDebugInfoErrors(t *testing.T) {
+	for _, test := range []struct {
+		text, err string
+	}{
+		{"Main.asm\n", "Main.dbg:1: not a debug info file"},
+		{"debug 2\n", "Main.dbg:1: debug info version 2, expected 1"},
+		{"debug 1\nfile \n", "Main.dbg:2: expected file <name>"},
+		{"debug 1\n\tfile\n", "Main.dbg:2: expected file <name>"},
+		{"debug 1\nline 0 1\n", "Main.dbg:2: line before file"},
+		{"debug 1\nfile Main.asm\nline 3 1\nline 2 2\n", "Main.dbg:4: address 2 out of order"},
+	} {
+		_, err := ParseDebugInfo(strings.NewReader(test.text), "Main.dbg")
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: error %v, want %s", test.text, err, test.err)
+		}
+	}
+}
+
+/*
+ * TestSourceName names sources as seen from the directory of the .dbg file.
+ */
+func TestSourceName(t *testing.T) {
+	for _, test := range []struct {
+		dbg, path, want string
+	}{
+		{"mult/Mult.dbg", "mult/Mult.asm", "Mult.asm"},
+		{"out/Mult.dbg", "my programs/Mult.asm", "../my programs/Mult.asm"},
+		{"Mult.dbg", "mult/Mult.asm", "mult/Mult.asm"},
+	} {
+		if got := SourceName(test.dbg, test.path); got != filepath.FromSlash(test.want) {
+			t.Errorf("SourceName(%q, %q) is %q, want %q", test.dbg, test.path, got, test.want)
+		}
+	}
+}
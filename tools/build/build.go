@@ -0,0 +1,341 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/asm"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/jack"
+	"github.com/christopher-weiss/nand2tetris/tools/jackos"
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+/*
+ * VMFiles returns the .vm sources named by path: the file itself, or every .vm
+ * file of a directory in lexical order.
+ */
+func VMFiles(path string) ([]string, error) {
+	return sourceFiles(path, ".vm")
+}
+
+/*
+ * JackFiles returns the .jack sources named by path, like VMFiles.
+ */
+func JackFiles(path string) ([]string, error) {
+	return sourceFiles(path, ".jack")
+}
+
+func sourceFiles(path, ext string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if filepath.Ext(path) != ext {
+			return nil, fmt.Errorf("%s: not a %s file", path, ext)
+		}
+		return []string{path}, nil
+	}
+	files, err := filepath.Glob(filepath.Join(path, "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no %s files", path, ext)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+/*
+ * Translate runs the VM translator over the given .vm files and returns the
+ * resulting assembly program. With program flow enabled, the Jack OS classes
+ * the program uses are linked in.
+ */
+func Translate(files []string, features vm.Features) ([]string, error) {
+	commands, err := ParseVM(files)
+	if err != nil {
+		return nil, err
+	}
+	return Link(commands, features)
+}
+
+/*
+ * Link links the Jack OS into commands, unless features is stack arithmetic
+ * only, and translates them.
+ */
+func Link(commands []vm.Command, features vm.Features) ([]string, error) {
+	program, _, err := LinkMapped(commands, features)
+	return program, err
+}
+
+/*
+ * LinkMapped links and translates like Link and also returns the source map
+ * of the translation.
+ */
+func LinkMapped(commands []vm.Command, features vm.Features) ([]string, *vm.SourceMap, error) {
+	if features == vm.ProgramFlow {
+		var err error
+		if commands, err = jackos.Link(commands); err != nil {
+			return nil, nil, err
+		}
+	}
+	return vm.TranslateMapped(commands, features)
+}
+
+/*
+ * ParseVM reads the VM commands of the given .vm files.
+ */
+func ParseVM(files []string) ([]vm.Command, error) {
+	var commands []vm.Command
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := vm.Parse(name, file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		for i := range parsed {
+			parsed[i].Path = name
+		}
+		commands = append(commands, parsed...)
+	}
+	return commands, nil
+}
+
+/*
+ * Compile runs the Jack compiler over the given .jack files and returns the
+ * VM commands of all their classes.
+ */
+func Compile(files []string) ([]vm.Command, error) {
+	var commands []vm.Command
+	for _, name := range files {
+		source, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		compiled, err := jack.CompileSource(name, string(source))
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, compiled...)
+	}
+	return commands, nil
+}
+
+/*
+ * Assemble runs the assembler over an in-memory assembly program.
+ */
+func Assemble(program []string) ([]string, error) {
+	return asm.Assemble(strings.NewReader(strings.Join(program, "\n")))
+}
+
+/*
+ * AssembleDebug assembles like Assemble and also returns the debug info of
+ * the program. Its lines are those of the assembly, read from the named
+ * file, or if source is not nil those of the VM commands it maps the code to,
+ * whose files are named relative to dir (see debugInfo).
+ */
+func AssembleDebug(program []string, file string, source *vm.SourceMap, dir string) ([]string, *asm.DebugInfo, error) {
+	parsed, err := asm.Parse(strings.NewReader(strings.Join(program, "\n")))
+	if err != nil {
+		return nil, nil, err
+	}
+	code, err := parsed.Translate()
+	if err != nil {
+		return nil, nil, err
+	}
+	return code, debugInfo(parsed, file, source, dir), nil
+}
+
+/*
+ * debugInfo returns the debug info of an assembled program. With a source
+ * map, the lines are those of the VM commands: .vm files read from disk are
+ * named by their path relative to dir, so that files of the same name in
+ * different directories stay apart, and others, such as the Jack OS, by class.
+ */
+func debugInfo(program *asm.Program, file string, source *vm.SourceMap, dir string) *asm.DebugInfo {
+	info := program.DebugInfo(file)
+	if source == nil {
+		return info
+	}
+	// several commands can start at one address, of which the last has the
+	// code; the bootstrap and shared routines have no source line
+	info.Lines = nil
+	for i, entry := range source.Entries {
+		if i+1 < len(source.Entries) && source.Entries[i+1].Address == entry.Address {
+			continue
+		}
+		line := asm.SourceLine{Address: entry.Address}
+		switch {
+		case entry.Command.Path != "":
+			name := asm.SourceName(filepath.Join(dir, entry.Command.File+".dbg"), entry.Command.Path)
+			line.File, line.Line = name, entry.Command.Line
+		case entry.Command.File != "":
+			line.File, line.Line = entry.Command.File+".vm", entry.Command.Line
+		}
+		info.Lines = append(info.Lines, line)
+	}
+	return info
+}
+
+/*
+ * Assembly returns the assembly program for path, which is either an .asm file,
+ * a .vm or .jack file, or a directory of .vm or .jack files. Jack programs are
+ * compiled in memory and linked with the Jack OS.
+ */
+func Assembly(path string) ([]string, error) {
+	program, _, err := assembly(path)
+	return program, err
+}
+
+/*
+ * assembly returns the assembly program for path like Assembly, and for VM
+ * and Jack programs where the code of each VM command starts.
+ */
+func assembly(path string) ([]string, *vm.SourceMap, error) {
+	if filepath.Ext(path) == ".asm" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return strings.Split(string(data), "\n"), nil, nil
+	}
+	if isJack(path) {
+		files, err := JackFiles(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		commands, err := Compile(files)
+		if err != nil {
+			return nil, nil, err
+		}
+		return LinkMapped(commands, vm.ProgramFlow)
+	}
+	files, err := VMFiles(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	commands, err := ParseVM(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	return LinkMapped(commands, vm.ProgramFlow)
+}
+
+/*
+ * isJack reports whether path is a .jack file, or a directory with .jack files
+ * but no .vm files (a directory holding both has usually been compiled already).
+ */
+func isJack(path string) bool {
+	if filepath.Ext(path) == ".jack" {
+		return true
+	}
+	if _, err := VMFiles(path); err == nil {
+		return false
+	}
+	_, err := JackFiles(path)
+	return err == nil
+}
+
+/*
+ * Hack returns the machine code for path, which is either a .hack file or
+ * anything Assembly accepts.
+ */
+func Hack(path string) ([]uint16, error) {
+	code, _, err := HackSymbols(path)
+	return code, err
+}
+
+/*
+ * Symbols are the symbols of an assembled program: the ROM address of each
+ * label, and the RAM address of each variable and predefined symbol. Programs
+ * translated from VM code also have the source map of the translation, and
+ * Debug holds the source line of each instruction.
+ */
+type Symbols struct {
+	Labels    map[string]int
+	Variables map[string]int
+	Source    *vm.SourceMap
+	Debug     *asm.DebugInfo
+}
+
+/*
+ * HackSymbols returns the machine code for path like Hack, together with the
+ * symbols of its assembly. A .hack file has only the predefined symbols,
+ * unless the assembler left the debug info X.dbg next to X.hack.
+ */
+func HackSymbols(path string) ([]uint16, Symbols, error) {
+	if filepath.Ext(path) == ".hack" {
+		return hackSymbols(path)
+	}
+	program, source, err := assembly(path)
+	if err != nil {
+		return nil, Symbols{}, err
+	}
+	parsed, err := asm.Parse(strings.NewReader(strings.Join(program, "\n")))
+	if err != nil {
+		return nil, Symbols{}, fmt.Errorf("%s: %v", path, err)
+	}
+	code, err := parsed.Translate()
+	if err != nil {
+		return nil, Symbols{}, fmt.Errorf("%s: %v", path, err)
+	}
+	words, err := cpu.ParseWords(code)
+	// with no .dbg file, source names are relative to the program's directory
+	dir := path
+	if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	info := debugInfo(parsed, filepath.Base(path), source, dir)
+	return words, Symbols{parsed.Labels(), parsed.Variables(), source, info}, err
+}
+
+func hackSymbols(path string) ([]uint16, Symbols, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, Symbols{}, err
+	}
+	defer file.Close()
+	code, err := cpu.ParseHack(file)
+	if err != nil {
+		return nil, Symbols{}, err
+	}
+	symbols := Symbols{Labels: map[string]int{}, Variables: asm.PredefinedSymbols()}
+	info, err := asm.ReadDebugInfo(strings.TrimSuffix(path, ".hack") + ".dbg")
+	if os.IsNotExist(err) {
+		return code, symbols, nil
+	}
+	if err != nil {
+		return nil, Symbols{}, err
+	}
+	symbols.Labels, symbols.Debug = info.Labels, info
+	for name, address := range info.Variables {
+		symbols.Variables[name] = address
+	}
+	return code, symbols, nil
+}
+
+/*
+ * WriteLines writes lines to the named file, one per line, replacing its contents.
+ */
+func WriteLines(name string, lines []string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(file, line); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
@@ -0,0 +1,302 @@
+package cover
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/asm"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/jackos"
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+/*
+ * Coverage collects which instructions of Hack programs ran and which way
+ * their conditional jumps went, and reports them per line of the .asm or .vm
+ * sources the programs were built from. The programs of a test suite add up:
+ * a line is covered if any of them ran it.
+ */
+type Coverage struct {
+	programs []program
+	commands map[string]map[int]string
+}
+
+type program struct {
+	profile *cpu.Profile
+	code    []uint16
+	lines   []asm.SourceLine
+	dir     string
+}
+
+/*
+ * Add adds a program, with the source lines of its debug info, whose CPU
+ * counts into profile. The profile may go on counting until the report is
+ * made. dir is the directory of the program's debug info, which names the
+ * sources relative to it.
+ */
+func (c *Coverage) Add(profile *cpu.Profile, code []uint16, lines []asm.SourceLine, dir string) {
+	c.programs = append(c.programs, program{profile, code, lines, dir})
+}
+
+/*
+ * AddVMSource records the VM commands of a source map, whose text stands in
+ * for VM files that are not on disk, such as those compiled from Jack in
+ * memory.
+ */
+func (c *Coverage) AddVMSource(source *vm.SourceMap) {
+	if c.commands == nil {
+		c.commands = map[string]map[int]string{}
+	}
+	for _, entry := range source.Entries {
+		if entry.Command.File == "" {
+			continue
+		}
+		name := entry.Command.File + ".vm"
+		if c.commands[name] == nil {
+			c.commands[name] = map[int]string{}
+		}
+		c.commands[name][entry.Command.Line] = entry.Command.String()
+	}
+}
+
+/*
+ * Line is the coverage of a source line: Hits counts how often each
+ * instruction of its code ran, and is empty for lines without code, and
+ * Branches how its conditional jumps went.
+ */
+type Line struct {
+	Number   int
+	Text     string
+	Hits     []uint64
+	Branches []Branch
+}
+
+/*
+ * Branch counts how often a conditional jump was taken and how often not.
+ */
+type Branch struct {
+	Taken    uint64
+	NotTaken uint64
+}
+
+/*
+ * isBranch reports whether an instruction is a conditional jump.
+ */
+func isBranch(instruction uint16) bool {
+	jump := instruction & 7
+	return instruction&0x8000 != 0 && jump != 0 && jump != 7
+}
+
+/*
+ * Count is how often the line ran: the most any of its instructions ran.
+ */
+func (l Line) Count() uint64 {
+	var count uint64
+	for _, hits := range l.Hits {
+		count = max(count, hits)
+	}
+	return count
+}
+
+/*
+ * Executed is how many instructions of the line ran at least once.
+ */
+func (l Line) Executed() int {
+	executed := 0
+	for _, hits := range l.Hits {
+		if hits > 0 {
+			executed++
+		}
+	}
+	return executed
+}
+
+/*
+ * BranchesCovered counts the directions of the line's conditional jumps,
+ * taken and not taken, that were followed at least once.
+ */
+func (l Line) BranchesCovered() (covered, total int) {
+	for _, branch := range l.Branches {
+		if branch.Taken > 0 {
+			covered++
+		}
+		if branch.NotTaken > 0 {
+			covered++
+		}
+	}
+	return covered, 2 * len(l.Branches)
+}
+
+/*
+ * Partial reports whether the line ran but not all of its code did, or a
+ * conditional jump went only one way, as in the code of an eq command whose
+ * result was always true.
+ */
+func (l Line) Partial() bool {
+	executed := l.Executed()
+	covered, total := l.BranchesCovered()
+	return executed > 0 && (executed < len(l.Hits) || covered < total)
+}
+
+/*
+ * File is the coverage of a source file. Found is false if the source could
+ * not be read, in which case the lines have no text and only those with code
+ * are listed.
+ */
+type File struct {
+	Name  string
+	Found bool
+	Lines []Line
+}
+
+/*
+ * Summary counts the lines with code, those that ran and those that ran in
+ * part, and the branch directions followed of all there are.
+ */
+func (f *File) Summary() (code, covered, partial, branches, directions int) {
+	for _, line := range f.Lines {
+		if len(line.Hits) == 0 {
+			continue
+		}
+		code++
+		if line.Executed() > 0 {
+			covered++
+		}
+		if line.Partial() {
+			partial++
+		}
+		c, t := line.BranchesCovered()
+		branches, directions = branches+c, directions+t
+	}
+	return code, covered, partial, branches, directions
+}
+
+/*
+ * Files returns the coverage of every source file of the programs, sorted by
+ * name.
+ */
+func (c *Coverage) Files() []*File {
+	lines := map[string]map[int]*Line{}
+	dirs := map[string][]string{}
+	for _, p := range c.programs {
+		files := map[string]bool{}
+		for i, line := range p.lines {
+			if line.File == "" {
+				continue
+			}
+			if !files[line.File] {
+				files[line.File] = true
+				dirs[line.File] = append(dirs[line.File], p.dir)
+			}
+			end := min(len(p.code), cpu.ROMSize)
+			if i+1 < len(p.lines) {
+				end = min(end, p.lines[i+1].Address)
+			}
+			if lines[line.File] == nil {
+				lines[line.File] = map[int]*Line{}
+			}
+			l := lines[line.File][line.Line]
+			if l == nil {
+				l = &Line{Number: line.Line}
+				lines[line.File][line.Line] = l
+			}
+			// the same line in another program adds up instruction by
+			// instruction, and branch by branch
+			branch := 0
+			for address := line.Address; address < end; address++ {
+				offset := address - line.Address
+				if offset == len(l.Hits) {
+					l.Hits = append(l.Hits, 0)
+				}
+				count := p.profile.Counts[address]
+				l.Hits[offset] += count
+				if !isBranch(p.code[address]) {
+					continue
+				}
+				if branch == len(l.Branches) {
+					l.Branches = append(l.Branches, Branch{})
+				}
+				taken := p.profile.Taken[address]
+				l.Branches[branch].Taken += taken
+				l.Branches[branch].NotTaken += count - taken
+				branch++
+			}
+		}
+	}
+
+	var files []*File
+	for name, covered := range lines {
+		text, found := readSource(name, dirs[name])
+		if !found && c.commands[name] != nil {
+			text, found = commandLines(c.commands[name]), true
+		}
+		file := &File{Name: name, Found: found}
+		n := len(text)
+		for number := range covered {
+			n = max(n, number)
+		}
+		for number := 1; number <= n; number++ {
+			line := Line{Number: number}
+			if l := covered[number]; l != nil {
+				line = *l
+			} else if !found {
+				continue
+			}
+			if number <= len(text) {
+				line.Text = text[number-1]
+			}
+			file.Lines = append(file.Lines, line)
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+/*
+ * readSource returns the lines of a source file, found relative to one of
+ * dirs, where the debug info naming it is, or for a VM file of the Jack OS
+ * built into the tools.
+ */
+func readSource(name string, dirs []string) ([]string, bool) {
+	candidates := []string{name}
+	if !filepath.IsAbs(name) {
+		candidates = nil
+		for _, dir := range dirs {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+	for _, path := range candidates {
+		if data, err := os.ReadFile(path); err == nil {
+			return splitLines(string(data)), true
+		}
+	}
+	if class, ok := strings.CutSuffix(filepath.Base(name), ".vm"); ok {
+		if source, ok := jackos.VMSource(class); ok {
+			return splitLines(source), true
+		}
+	}
+	return nil, false
+}
+
+func commandLines(commands map[int]string) []string {
+	n := 0
+	for number := range commands {
+		n = max(n, number)
+	}
+	lines := make([]string, n)
+	for number, text := range commands {
+		lines[number-1] = text
+	}
+	return lines
+}
+
+func splitLines(text string) []string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,142 @@
+package cover
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/christopher-weiss/nand2tetris/tools/asm"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+)
+
+const countdown = `// count down from 3, then skip to END if R0 < 0
+@3
+D=A
+(LOOP)
+D=D-1
+@LOOP
+D;JGT
+@R0
+D=M
+@END
+D;JLT
+(END)
+@END
+0;JMP
+`
+
+/*
+ * run assembles countdown, runs it for the given number of instructions and
+ * returns the coverage of the source, written to dir as name unless name is
+ * empty.
+ */
+func run(t *testing.T, dir, name string, cycles uint64) []*File {
+	t.Helper()
+	program, err := asm.Parse(strings.NewReader(countdown))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := program.Translate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := cpu.ParseWords(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "Countdown.asm"
+	if name != "" {
+		file = name
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(countdown), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := cpu.New(words)
+	c.Profile = &cpu.Profile{}
+	c.Run(cycles)
+	var coverage Coverage
+	coverage.Add(c.Profile, words, program.DebugInfo(file).Lines, dir)
+	return coverage.Files()
+}
+
+/*
+ * TestLineHits counts the lines of the loop once per round and the lines
+ * before it once.
+ */
+func TestLineHits(t *testing.T) {
+	files := run(t, t.TempDir(), "Countdown.asm", 30)
+	if len(files) != 1 || !files[0].Found {
+		t.Fatalf("files %v, want Countdown.asm found", files)
+	}
+	lines := files[0].Lines
+	if len(lines) != 14 {
+		t.Fatalf("%d lines, want 14", len(lines))
+	}
+	for number, want := range map[int]uint64{2: 1, 3: 1, 5: 3, 6: 3, 7: 3, 8: 1} {
+		if got := lines[number-1].Count(); got != want {
+			t.Errorf("line %d ran %d times, want %d", number, got, want)
+		}
+	}
+	if len(lines[0].Hits) != 0 || lines[4].Text != "D=D-1" {
+		t.Errorf("line 1 has code %v, line 5 is %q", lines[0].Hits, lines[4].Text)
+	}
+	code, covered, _, _, _ := files[0].Summary()
+	if code != 11 || covered != 11 {
+		t.Errorf("%d of %d lines covered, want 11 of 11", covered, code)
+	}
+}
+
+/*
+ * TestPartialBranch checks that a jump that went only one way marks its line
+ * as partial in the report, while the loop jump, taken and not, does not.
+ */
+func TestPartialBranch(t *testing.T) {
+	files := run(t, t.TempDir(), "Countdown.asm", 30)
+	lines := files[0].Lines
+	if lines[6].Partial() {
+		t.Errorf("the loop jump D;JGT went both ways but is partial: %+v", lines[6].Branches)
+	}
+	if !lines[10].Partial() {
+		t.Errorf("D;JLT was never taken but is not partial: %+v", lines[10].Branches)
+	}
+	if _, _, partial, branches, directions := files[0].Summary(); partial != 1 || branches != 3 || directions != 4 {
+		t.Errorf("%d partial lines, %d of %d directions, want 1, 3 of 4", partial, branches, directions)
+	}
+	var report strings.Builder
+	if err := WriteText(&report, files); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"        1*:    11: D;JLT\n", "jump 0 never taken\n"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, report.String())
+		}
+	}
+}
+
+/*
+ * TestMissingSource reports a source that is not where the debug info says
+ * with a warning and its lines with code only.
+ */
+func TestMissingSource(t *testing.T) {
+	files := run(t, t.TempDir(), "", 30)
+	if len(files) != 1 || files[0].Found {
+		t.Fatalf("files %v, want Countdown.asm not found", files)
+	}
+	if n := len(files[0].Lines); n != 11 {
+		t.Errorf("%d lines listed, want the 11 with code", n)
+	}
+	var text, html strings.Builder
+	if err := WriteText(&text, files); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteHTML(&html, files); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "warning: source Countdown.asm not found") {
+		t.Errorf("text report has no warning:\n%s", text.String())
+	}
+	if !strings.Contains(html.String(), "Warning: source Countdown.asm not found") {
+		t.Errorf("HTML report has no warning")
+	}
+}
@@ -0,0 +1,204 @@
+package cover
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+)
+
+/*
+ * percent is the share of covered lines, 100 for a file without code.
+ */
+func percent(code, covered int) float64 {
+	if code == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(code)
+}
+
+/*
+ * WriteText writes a summary of the files, then each file in the manner of
+ * gcov, every line prefixed with how often it ran: - for lines without code,
+ * ##### for lines that never ran and a * after the count of lines that ran
+ * only in part. Conditional jumps that went only one way, such as that of an
+ * eq whose result was always true, are listed below their line.
+ */
+func WriteText(w io.Writer, files []*File) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%8s %8s %8s %8s  %s\n", "lines", "covered", "partial", "branches", "file")
+	var total summary
+	for _, file := range files {
+		var s summary
+		s.code, s.covered, s.partial, s.branches, s.directions = file.Summary()
+		s.write(out, file.Name)
+		total.add(s)
+	}
+	total.write(out, "total")
+	for _, file := range files {
+		fmt.Fprintf(out, "\n%s\n", file.Name)
+		if !file.Found {
+			fmt.Fprintf(out, "warning: source %s not found; only lines with code are listed\n", file.Name)
+		}
+		for _, line := range file.Lines {
+			fmt.Fprintf(out, "%10s:%6d: %s\n", textCount(line), line.Number, line.Text)
+			if line.Executed() == 0 {
+				continue
+			}
+			for i, branch := range line.Branches {
+				if branch.Taken == 0 {
+					fmt.Fprintf(out, "%10s  %6s  jump %d never taken\n", "", "", i)
+				} else if branch.NotTaken == 0 {
+					fmt.Fprintf(out, "%10s  %6s  jump %d always taken\n", "", "", i)
+				}
+			}
+		}
+	}
+	return out.Flush()
+}
+
+type summary struct {
+	code, covered, partial, branches, directions int
+}
+
+func (s *summary) add(t summary) {
+	s.code += t.code
+	s.covered += t.covered
+	s.partial += t.partial
+	s.branches += t.branches
+	s.directions += t.directions
+}
+
+/*
+ * branchPercent is the share of jump directions taken, or - without
+ * conditional jumps.
+ */
+func (s summary) branchPercent() string {
+	if s.directions == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", percent(s.directions, s.branches))
+}
+
+func (s summary) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%8d %7.1f%% %8d %8s  %s\n", s.code, percent(s.code, s.covered), s.partial, s.branchPercent(), name)
+}
+
+func textCount(line Line) string {
+	switch {
+	case len(line.Hits) == 0:
+		return "-"
+	case line.Executed() == 0:
+		return "#####"
+	case line.Partial():
+		return fmt.Sprintf("%d*", line.Count())
+	}
+	return fmt.Sprint(line.Count())
+}
+
+/*
+ * htmlFile is a File as the HTML report shows it.
+ */
+type htmlFile struct {
+	*File
+	ID       int
+	Code     int
+	Covered  int
+	Partial  int
+	Percent  float64
+	Branches string
+	Rows     []htmlLine
+}
+
+type htmlLine struct {
+	Line
+	Class string
+	Count string
+	Title string
+}
+
+/*
+ * WriteHTML writes the coverage of the files as a single HTML page: a summary
+ * table, then each file with lines that ran in green, lines that ran in part
+ * in yellow and lines that never ran in red.
+ */
+func WriteHTML(w io.Writer, files []*File) error {
+	var page struct {
+		Files         []htmlFile
+		Code, Covered int
+		Partial       int
+		Percent       float64
+		Branches      string
+	}
+	var total summary
+	for i, file := range files {
+		f := htmlFile{File: file, ID: i}
+		var s summary
+		s.code, s.covered, s.partial, s.branches, s.directions = file.Summary()
+		total.add(s)
+		f.Code, f.Covered, f.Partial = s.code, s.covered, s.partial
+		f.Percent = percent(f.Code, f.Covered)
+		f.Branches = s.branchPercent()
+		for _, line := range file.Lines {
+			row := htmlLine{Line: line}
+			if len(line.Hits) > 0 {
+				row.Count = fmt.Sprint(line.Count())
+				row.Title = fmt.Sprintf("%d of %d instructions ran", line.Executed(), len(line.Hits))
+				if covered, total := line.BranchesCovered(); total > 0 {
+					row.Title += fmt.Sprintf(", %d of %d jump directions taken", covered, total)
+				}
+				switch {
+				case line.Executed() == 0:
+					row.Class = "uncovered"
+				case line.Partial():
+					row.Class = "partial"
+				default:
+					row.Class = "covered"
+				}
+			}
+			f.Rows = append(f.Rows, row)
+		}
+		page.Files = append(page.Files, f)
+	}
+	page.Code, page.Covered, page.Partial = total.code, total.covered, total.partial
+	page.Percent = percent(total.code, total.covered)
+	page.Branches = total.branchPercent()
+	return htmlReport.Execute(w, page)
+}
+
+var htmlReport = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+.summary td, .summary th { padding: 0.2em 1em; text-align: right; }
+.summary td:last-child, .summary th:last-child { text-align: left; }
+.source { font-family: monospace; white-space: pre; width: 100%; }
+.source td { padding: 0 0.5em; }
+.source td.count, .source td.number { text-align: right; color: #666; }
+.covered { background: #dfd; }
+.partial { background: #ffb; }
+.uncovered { background: #fcc; }
+.warning { color: #a00; }
+</style>
+</head>
+<body>
+<h1>Coverage</h1>
+<table class="summary">
+<tr><th>lines</th><th>covered</th><th>partial</th><th>branches</th><th>file</th></tr>
+{{range .Files}}<tr><td>{{.Code}}</td><td>{{printf "%.1f" .Percent}}%</td><td>{{.Partial}}</td><td>{{.Branches}}</td><td><a href="#file{{.ID}}">{{.Name}}</a></td></tr>
+{{end}}<tr><th>{{.Code}}</th><th>{{printf "%.1f" .Percent}}%</th><th>{{.Partial}}</th><th>{{.Branches}}</th><th>total</th></tr>
+</table>
+{{range .Files}}
+<h2 id="file{{.ID}}">{{.Name}}</h2>
+{{if not .Found}}<p class="warning">Warning: source {{.Name}} not found; only lines with code are listed.</p>
+{{end}}<table class="source">
+{{range .Rows}}<tr class="{{.Class}}" title="{{.Title}}"><td class="count">{{.Count}}</td><td class="number">{{.Number}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
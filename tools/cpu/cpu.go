@@ -0,0 +1,198 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	ROMSize  = 32768
+	RAMSize  = 32768
+	SCREEN   = 16384
+	KBD      = 24576
+	SP       = 0
+	LCL      = 1
+	ARG      = 2
+	THIS     = 3
+	THAT     = 4
+	addrMask = 0x7FFF
+)
+
+/*
+ * CPU is the Hack computer: instruction memory, data memory and the A, D and PC
+ * registers. Cycles counts the instructions executed since the program was loaded.
+ * If Keyboard is set, it presses the keys of its script into the KBD register
+ * as the cycles pass. If Profile is set, it counts the instructions executed at
+ * each ROM address.
+ */
+type CPU struct {
+	ROM      [ROMSize]uint16
+	RAM      [RAMSize]int16
+	A        int16
+	D        int16
+	PC       uint16
+	Cycles   uint64
+	Keyboard *Keyboard
+	Profile  *Profile
+
+	// the decoded ROM, see Run
+	ops *[ROMSize]Op
+}
+
+/*
+ * New returns a CPU with program loaded into ROM and all registers cleared.
+ */
+func New(program []uint16) *CPU {
+	c := &CPU{}
+	c.Load(program)
+	return c
+}
+
+/*
+ * Load replaces the ROM contents with program and resets the CPU.
+ */
+func (c *CPU) Load(program []uint16) {
+	c.ROM = [ROMSize]uint16{}
+	copy(c.ROM[:], program)
+	c.RAM = [RAMSize]int16{}
+	c.A, c.D = 0, 0
+	c.Reset()
+}
+
+/*
+ * Reset jumps back to the first instruction, leaving memory untouched.
+ */
+func (c *CPU) Reset() {
+	c.PC = 0
+	c.Cycles = 0
+}
+
+/*
+ * Step executes the instruction at PC, decoding it from scratch. Run is
+ * faster for many instructions.
+ */
+func (c *CPU) Step() {
+	if c.Keyboard != nil {
+		if key, changed := c.Keyboard.Advance(c.Cycles); changed {
+			c.RAM[KBD] = key
+		}
+	}
+	if c.Profile != nil {
+		c.Profile.Counts[c.PC&addrMask]++
+	}
+	instruction := c.ROM[c.PC&addrMask]
+	c.Cycles++
+
+	// A-instruction: @value
+	if instruction&0x8000 == 0 {
+		c.A = int16(instruction)
+		c.PC++
+		return
+	}
+
+	// C-instruction: 111a cccc ccdd djjj
+	address := uint16(c.A) & addrMask
+	y := c.A
+	if instruction&0x1000 != 0 {
+		y = c.RAM[address]
+	}
+	out := alu(c.D, y, instruction>>6)
+
+	if instruction&0x0008 != 0 {
+		c.RAM[address] = out
+	}
+	if instruction&0x0020 != 0 {
+		c.A = out
+	}
+	if instruction&0x0010 != 0 {
+		c.D = out
+	}
+
+	if jump(out, instruction&0x7) {
+		if c.Profile != nil {
+			c.Profile.Taken[c.PC&addrMask]++
+		}
+		c.PC = address
+	} else {
+		c.PC++
+	}
+}
+
+/*
+ * alu computes the Hack ALU function selected by the six control bits
+ * zx nx zy ny f no (lowest six bits of control, no in bit 0).
+ */
+func alu(x, y int16, control uint16) int16 {
+	if control&0x20 != 0 {
+		x = 0
+	}
+	if control&0x10 != 0 {
+		x = ^x
+	}
+	if control&0x08 != 0 {
+		y = 0
+	}
+	if control&0x04 != 0 {
+		y = ^y
+	}
+	var out int16
+	if control&0x02 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if control&0x01 != 0 {
+		out = ^out
+	}
+	return out
+}
+
+func jump(out int16, jmp uint16) bool {
+	return (jmp&0x4 != 0 && out < 0) ||
+		(jmp&0x2 != 0 && out == 0) ||
+		(jmp&0x1 != 0 && out > 0)
+}
+
+/*
+ * ParseHack reads a .hack file: one 16 digit binary instruction per line.
+ */
+func ParseHack(r io.Reader) ([]uint16, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ParseWords(lines)
+}
+
+/*
+ * ParseWords converts instructions in their binary string form (as produced by
+ * the assembler) into machine words. Blank lines are ignored.
+ */
+func ParseWords(lines []string) ([]uint16, error) {
+	var program []uint16
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(line) != 16 {
+			return nil, fmt.Errorf("line %d: expected 16 binary digits, got %q", i+1, line)
+		}
+		word, err := strconv.ParseUint(line, 2, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		program = append(program, uint16(word))
+	}
+	if len(program) > ROMSize {
+		return nil, fmt.Errorf("program has %d instructions, ROM holds %d", len(program), ROMSize)
+	}
+	return program, nil
+}
@@ -0,0 +1,259 @@
+package cpu
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/christopher-weiss/nand2tetris/tools/asm"
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+func loadPong(tb testing.TB) []uint16 {
+	file, err := os.Open("../../06_assembler/pong/Pong.hack")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+	program, err := ParseHack(file)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return program
+}
+
+/*
+ * sameState reports where a CPU differs from the one it should match.
+ */
+func sameState(t *testing.T, want, got *CPU) {
+	t.Helper()
+	if want.A != got.A || want.D != got.D || want.PC != got.PC || want.Cycles != got.Cycles {
+		t.Fatalf("after %d cycles: got A=%d D=%d PC=%d, want A=%d D=%d PC=%d",
+			want.Cycles, got.A, got.D, got.PC, want.A, want.D, want.PC)
+	}
+	for address := range want.RAM {
+		if want.RAM[address] != got.RAM[address] {
+			t.Fatalf("after %d cycles: got RAM[%d]=%d, want %d", want.Cycles, address, got.RAM[address], want.RAM[address])
+		}
+	}
+}
+
+/*
+ * TestRunMatchesStep runs Pong with the predecoded run loop and with the
+ * instruction by instruction decoder and compares the machines.
+ */
+func TestRunMatchesStep(t *testing.T) {
+	program := loadPong(t)
+	stepped, run := New(program), New(program)
+	chunks := 200
+	if testing.Short() {
+		chunks = 20
+	}
+	for i := 0; i < chunks; i++ {
+		for j := 0; j < 10000; j++ {
+			stepped.Step()
+		}
+		run.Run(10000)
+		sameState(t, stepped, run)
+	}
+}
+
+/*
+ * TestRunRandomInstructions compares Run and Step on random programs, which
+ * use every computation, destination and jump, invalid control bits included.
+ */
+func TestRunRandomInstructions(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		program := make([]uint16, 4096)
+		for i := range program {
+			program[i] = uint16(random.Intn(1 << 16))
+			if i%4 == 0 {
+				// keep jumps mostly inside the program
+				program[i] = uint16(random.Intn(len(program)))
+			}
+		}
+		stepped, run := New(program), New(program)
+		for address := range stepped.RAM {
+			value := int16(random.Intn(1 << 16))
+			stepped.RAM[address], run.RAM[address] = value, value
+		}
+		for i := 0; i < 50000; i++ {
+			stepped.Step()
+		}
+		run.Run(50000)
+		sameState(t, stepped, run)
+	}
+}
+
+/*
+ * TestRunDecodesChangedROM checks that instructions written to ROM after
+ * they were decoded take effect.
+ */
+func TestRunDecodesChangedROM(t *testing.T) {
+	c := New([]uint16{7, 0xec10}) // @7, D=A
+	c.Run(2)
+	c.ROM[0] = 9
+	c.Reset()
+	c.Run(2)
+	if c.D != 9 {
+		t.Fatalf("D is %d after changing @7 to @9, expected 9", c.D)
+	}
+}
+
+/*
+ * TestSnapshotRoundTrip writes a snapshot of Pong in mid-game, reads it back
+ * and checks that the machine resumes exactly as the original goes on.
+ */
+func TestSnapshotRoundTrip(t *testing.T) {
+	c := New(loadPong(t))
+	c.Keyboard = &Keyboard{Events: []KeyEvent{{Cycle: 500000, Key: 130}, {Cycle: 900000, Key: 0}}}
+	c.Run(700000)
+	var file bytes.Buffer
+	if err := c.Save().Write(&file); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := ParseSnapshot(&file, "pong.snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if differences := c.Save().Diff(snapshot); len(differences) > 0 {
+		t.Fatalf("snapshot read back differs: %v", differences)
+	}
+	resumed := New(nil)
+	resumed.Restore(snapshot)
+	c.Run(500000)
+	resumed.Run(500000)
+	sameState(t, c, resumed)
+}
+
+/*
+ * TestProfileCountsJumps runs a loop of three rounds under a profile and
+ * checks the counts of its instructions and of the jumps taken.
+ */
+func TestProfileCountsJumps(t *testing.T) {
+	// @3, D=A, (LOOP) D=D-1, @2, D;JGT
+	c := New([]uint16{3, 0xec10, 0xe390, 2, 0xe301})
+	c.Profile = &Profile{}
+	c.Run(11)
+	if got := c.Profile.Counts[2]; got != 3 {
+		t.Errorf("D=D-1 ran %d times, want 3", got)
+	}
+	if got := c.Profile.Taken[4]; got != 2 {
+		t.Errorf("D;JGT was taken %d times, want 2", got)
+	}
+	if got := c.Profile.Taken[1]; got != 0 {
+		t.Errorf("D=A counted as a jump taken %d times", got)
+	}
+}
+
+/*
+ * TestLabelsPreferProgramLabels names addresses marked by several labels: the
+ * loop a call returns into is named after the loop, not the return address,
+ * though that comes first alphabetically.
+ */
+func TestLabelsPreferProgramLabels(t *testing.T) {
+	labels := NewLabels(map[string]int{
+		"Main.fibonacci$ret.3": 40,
+		"Sys.init$WHILE":       40,
+		"COMPARE_TRUE0":        50,
+		"VM_RETURN":            50,
+		"Main.fibonacci":       60,
+		"Main.fibonacci$END":   60,
+	})
+	for address, want := range map[int]string{40: "Sys.init$WHILE", 42: "Sys.init$WHILE+2", 50: "COMPARE_TRUE0", 60: "Main.fibonacci"} {
+		if got := labels.Name(address); got != want {
+			t.Errorf("address %d is named %s, want %s", address, got, want)
+		}
+	}
+}
+
+/*
+ * TestProfileOfVMProgram profiles FibonacciElement and checks that the cycles
+ * per label count whole functions and loops: the return addresses and
+ * comparisons the VM translator labels inside them get no rows of their own.
+ */
+func TestProfileOfVMProgram(t *testing.T) {
+	dir := "../../08_virtual_machine_2/FunctionCalls/FibonacciElement"
+	var commands []vm.Command
+	for _, name := range []string{"Sys.vm", "Main.vm"} {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := vm.Parse(name, file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, parsed...)
+	}
+	translated, err := vm.Translate(commands, vm.ProgramFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := asm.Parse(strings.NewReader(strings.Join(translated, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := program.Translate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := ParseWords(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := NewLabels(program.Labels())
+	// ret.0 is the bootstrap's call and ret.1 the call in Sys.init
+	if owner, _ := labels.Owner(program.Labels()["Main.fibonacci$ret.2"]); owner != "Main.fibonacci$IF_FALSE" {
+		t.Errorf("the return address of the first recursive call belongs to %s", owner)
+	}
+
+	c := New(words)
+	c.Profile = &Profile{}
+	c.Run(5000)
+	var report bytes.Buffer
+	if err := c.Profile.Write(&report, c, labels, 0); err != nil {
+		t.Fatal(err)
+	}
+	perLabel, _, _ := strings.Cut(report.String(), "\n\n      cycles   share    ROM")
+	for _, row := range strings.Split(perLabel, "\n")[3:] {
+		fields := strings.Fields(row)
+		if label := fields[len(fields)-1]; generatedLabel(label) && strings.Contains(label, "$") || strings.HasPrefix(label, "COMPARE_") {
+			t.Errorf("generated label %s has a row: %s", label, row)
+		}
+	}
+	for _, label := range []string{"Main.fibonacci", "Main.fibonacci$IF_TRUE", "VM_CALL", "VM_LT"} {
+		if !strings.Contains(perLabel, "  "+label+"\n") {
+			t.Errorf("no row for %s in\n%s", label, perLabel)
+		}
+	}
+}
+
+/*
+ * BenchmarkRun reports how fast the predecoded run loop plays Pong.
+ */
+func BenchmarkRun(b *testing.B) {
+	c := New(loadPong(b))
+	b.ReportAllocs()
+	b.ResetTimer()
+	c.Run(uint64(b.N))
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds()/1e6, "Minstr/s")
+}
+
+/*
+ * BenchmarkStep is BenchmarkRun with instructions decoded one at a time.
+ */
+func BenchmarkStep(b *testing.B) {
+	c := New(loadPong(b))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Step()
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds()/1e6, "Minstr/s")
+}
@@ -0,0 +1,238 @@
+package cpu
+
+/*
+ * Comp is a computation of the Hack instruction set, decoded from the a bit
+ * and the six control bits of a C-instruction. COMP_VALUE stands for an
+ * A-instruction and COMP_ALU for control bits outside the instruction set,
+ * which the ALU is simulated for.
+ */
+type Comp uint8
+
+const (
+	COMP_VALUE Comp = iota
+	COMP_ALU
+	COMP_ZERO
+	COMP_ONE
+	COMP_MINUS_ONE
+	COMP_D
+	COMP_A
+	COMP_NOT_D
+	COMP_NOT_A
+	COMP_NEG_D
+	COMP_NEG_A
+	COMP_D_PLUS_ONE
+	COMP_A_PLUS_ONE
+	COMP_D_MINUS_ONE
+	COMP_A_MINUS_ONE
+	COMP_D_PLUS_A
+	COMP_D_MINUS_A
+	COMP_A_MINUS_D
+	COMP_D_AND_A
+	COMP_D_OR_A
+	COMP_M
+	COMP_NOT_M
+	COMP_NEG_M
+	COMP_M_PLUS_ONE
+	COMP_M_MINUS_ONE
+	COMP_D_PLUS_M
+	COMP_D_MINUS_M
+	COMP_M_MINUS_D
+	COMP_D_AND_M
+	COMP_D_OR_M
+)
+
+/*
+ * compCodes maps the a bit and control bits of a C-instruction to its Comp.
+ */
+var compCodes = map[uint16]Comp{
+	0x2a: COMP_ZERO, 0x3f: COMP_ONE, 0x3a: COMP_MINUS_ONE,
+	0x0c: COMP_D, 0x30: COMP_A, 0x0d: COMP_NOT_D, 0x31: COMP_NOT_A, 0x0f: COMP_NEG_D, 0x33: COMP_NEG_A,
+	0x1f: COMP_D_PLUS_ONE, 0x37: COMP_A_PLUS_ONE, 0x0e: COMP_D_MINUS_ONE, 0x32: COMP_A_MINUS_ONE,
+	0x02: COMP_D_PLUS_A, 0x13: COMP_D_MINUS_A, 0x07: COMP_A_MINUS_D, 0x00: COMP_D_AND_A, 0x15: COMP_D_OR_A,
+	0x70: COMP_M, 0x71: COMP_NOT_M, 0x73: COMP_NEG_M, 0x77: COMP_M_PLUS_ONE, 0x72: COMP_M_MINUS_ONE,
+	0x42: COMP_D_PLUS_M, 0x53: COMP_D_MINUS_M, 0x47: COMP_M_MINUS_D, 0x40: COMP_D_AND_M, 0x55: COMP_D_OR_M,
+}
+
+/*
+ * Destination and jump bits of an Op, as in the instruction.
+ */
+const (
+	DEST_M = 1
+	DEST_D = 2
+	DEST_A = 4
+
+	JUMP_GT = 1
+	JUMP_EQ = 2
+	JUMP_LT = 4
+)
+
+/*
+ * Op is an instruction decoded for the run loop: Value is loaded into A by
+ * an A-instruction; a C-instruction computes Comp, stores it in the
+ * registers of Dest and jumps if the sign of the result is in Jump. Word is
+ * the instruction itself. The zero Op is the decoded @0, so a zeroed table
+ * is a valid decoding of a zeroed ROM.
+ */
+type Op struct {
+	Word  uint16
+	Value int16
+	Comp  Comp
+	Dest  uint8
+	Jump  uint8
+}
+
+/*
+ * Decode decodes an instruction.
+ */
+func Decode(instruction uint16) Op {
+	if instruction&0x8000 == 0 {
+		return Op{Word: instruction, Value: int16(instruction), Comp: COMP_VALUE}
+	}
+	comp, ok := compCodes[instruction>>6&0x7f]
+	if !ok {
+		comp = COMP_ALU
+	}
+	return Op{Word: instruction, Comp: comp, Dest: uint8(instruction >> 3 & 7), Jump: uint8(instruction & 7)}
+}
+
+/*
+ * Run executes n instructions. Instructions are decoded into a table of Ops
+ * on first use and executed from it; an entry whose Word no longer matches
+ * the ROM, changed by a test script or a debugger, is decoded again. With a
+ * Keyboard to play or a Profile to count into, Run steps one instruction at a
+ * time.
+ */
+func (c *CPU) Run(n uint64) {
+	if c.Keyboard != nil || c.Profile != nil {
+		for i := uint64(0); i < n; i++ {
+			c.Step()
+		}
+		return
+	}
+	if c.ops == nil {
+		c.ops = &[ROMSize]Op{}
+	}
+	ops, rom, ram := c.ops, &c.ROM, &c.RAM
+	a, d, pc := c.A, c.D, c.PC
+	for i := n; i > 0; i-- {
+		index := pc & addrMask
+		op := &ops[index]
+		if op.Word != rom[index] {
+			*op = Decode(rom[index])
+		}
+		if op.Comp == COMP_VALUE {
+			a = op.Value
+			pc++
+			// A-instructions are mostly followed by a C-instruction: running
+			// it in the same iteration keeps the branches predictable
+			if i == 1 {
+				break
+			}
+			i--
+			index = pc & addrMask
+			op = &ops[index]
+			if op.Word != rom[index] {
+				*op = Decode(rom[index])
+			}
+			if op.Comp == COMP_VALUE {
+				a = op.Value
+				pc++
+				continue
+			}
+		}
+		address := uint16(a) & addrMask
+		var out int16
+		switch op.Comp {
+		case COMP_ZERO:
+			out = 0
+		case COMP_ONE:
+			out = 1
+		case COMP_MINUS_ONE:
+			out = -1
+		case COMP_D:
+			out = d
+		case COMP_A:
+			out = a
+		case COMP_NOT_D:
+			out = ^d
+		case COMP_NOT_A:
+			out = ^a
+		case COMP_NEG_D:
+			out = -d
+		case COMP_NEG_A:
+			out = -a
+		case COMP_D_PLUS_ONE:
+			out = d + 1
+		case COMP_A_PLUS_ONE:
+			out = a + 1
+		case COMP_D_MINUS_ONE:
+			out = d - 1
+		case COMP_A_MINUS_ONE:
+			out = a - 1
+		case COMP_D_PLUS_A:
+			out = d + a
+		case COMP_D_MINUS_A:
+			out = d - a
+		case COMP_A_MINUS_D:
+			out = a - d
+		case COMP_D_AND_A:
+			out = d & a
+		case COMP_D_OR_A:
+			out = d | a
+		case COMP_M:
+			out = ram[address]
+		case COMP_NOT_M:
+			out = ^ram[address]
+		case COMP_NEG_M:
+			out = -ram[address]
+		case COMP_M_PLUS_ONE:
+			out = ram[address] + 1
+		case COMP_M_MINUS_ONE:
+			out = ram[address] - 1
+		case COMP_D_PLUS_M:
+			out = d + ram[address]
+		case COMP_D_MINUS_M:
+			out = d - ram[address]
+		case COMP_M_MINUS_D:
+			out = ram[address] - d
+		case COMP_D_AND_M:
+			out = d & ram[address]
+		case COMP_D_OR_M:
+			out = d | ram[address]
+		default:
+			y := a
+			if op.Word&0x1000 != 0 {
+				y = ram[address]
+			}
+			out = alu(d, y, op.Word>>6)
+		}
+		if op.Dest != 0 {
+			if op.Dest&DEST_M != 0 {
+				ram[address] = out
+			}
+			if op.Dest&DEST_A != 0 {
+				a = out
+			}
+			if op.Dest&DEST_D != 0 {
+				d = out
+			}
+		}
+		if op.Jump == 0 {
+			pc++
+			continue
+		}
+		var sign uint8 = JUMP_EQ
+		if out < 0 {
+			sign = JUMP_LT
+		} else if out > 0 {
+			sign = JUMP_GT
+		}
+		if op.Jump&sign != 0 {
+			pc = address
+		} else {
+			pc++
+		}
+	}
+	c.A, c.D, c.PC = a, d, pc
+	c.Cycles += n
+}
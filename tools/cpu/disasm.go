@@ -0,0 +1,42 @@
+package cpu
+
+import "fmt"
+
+/*
+ * comps names the computations of the Hack instruction set by their a bit and
+ * six control bits, in the forms the book uses.
+ */
+var comps = map[uint16]string{
+	0x2a: "0", 0x3f: "1", 0x3a: "-1",
+	0x0c: "D", 0x30: "A", 0x0d: "!D", 0x31: "!A", 0x0f: "-D", 0x33: "-A",
+	0x1f: "D+1", 0x37: "A+1", 0x0e: "D-1", 0x32: "A-1",
+	0x02: "D+A", 0x13: "D-A", 0x07: "A-D", 0x00: "D&A", 0x15: "D|A",
+	0x70: "M", 0x71: "!M", 0x73: "-M", 0x77: "M+1", 0x72: "M-1",
+	0x42: "D+M", 0x53: "D-M", 0x47: "M-D", 0x40: "D&M", 0x55: "D|M",
+}
+
+var dests = []string{"", "M", "D", "MD", "A", "AM", "AD", "AMD"}
+
+var jumps = []string{"", "JGT", "JEQ", "JGE", "JLT", "JNE", "JLE", "JMP"}
+
+/*
+ * Disassemble writes an instruction in assembly, e.g. @17 or AM=M-1;JNE. A
+ * computation outside the instruction set is shown as its control bits.
+ */
+func Disassemble(instruction uint16) string {
+	if instruction&0x8000 == 0 {
+		return fmt.Sprintf("@%d", instruction)
+	}
+	comp, ok := comps[instruction>>6&0x7f]
+	if !ok {
+		comp = fmt.Sprintf("?%07b", instruction>>6&0x7f)
+	}
+	text := comp
+	if dest := dests[instruction>>3&7]; dest != "" {
+		text = dest + "=" + text
+	}
+	if jump := jumps[instruction&7]; jump != "" {
+		text += ";" + jump
+	}
+	return text
+}
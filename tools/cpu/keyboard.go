@@ -0,0 +1,145 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+ * KeyCodes names the keys the Hack keyboard reports with codes of their own,
+ * as listed in the book. Printable characters report their ASCII code.
+ */
+var KeyCodes = map[string]int16{
+	"none": 0, "space": 32,
+	"newline": 128, "enter": 128, "backspace": 129,
+	"left": 130, "up": 131, "right": 132, "down": 133,
+	"home": 134, "end": 135, "pageup": 136, "pagedown": 137,
+	"insert": 138, "delete": 139, "esc": 140, "escape": 140,
+	"f1": 141, "f2": 142, "f3": 143, "f4": 144, "f5": 145, "f6": 146,
+	"f7": 147, "f8": 148, "f9": 149, "f10": 150, "f11": 151, "f12": 152,
+}
+
+/*
+ * KeyEvent holds down Key from cycle Cycle on; key 0 releases the keyboard.
+ */
+type KeyEvent struct {
+	Cycle uint64
+	Key   int16
+}
+
+/*
+ * Keyboard plays a keyboard script: a timeline of keys pressed, each held
+ * until the next event. Set CPU.Keyboard to play it into the KBD register.
+ */
+type Keyboard struct {
+	Events []KeyEvent
+	next   int
+	last   uint64
+}
+
+/*
+ * ParseKeyboard reads a keyboard script, one event per line:
+ *
+ *	// comment
+ *	1000 K          hold down K from cycle 1000 on
+ *	+50000 none     release it 50000 cycles later
+ *	+10000 left     then hold the left arrow
+ *
+ * A cycle without + counts from the start of the run, with + from the event
+ * before. A key is a name from KeyCodes (in any case), a single character or
+ * a decimal code. name is used in error messages.
+ */
+func ParseKeyboard(r io.Reader, name string) (*Keyboard, error) {
+	k := &Keyboard{}
+	scanner := bufio.NewScanner(r)
+	var cycle uint64
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a cycle and a key", name, line)
+		}
+		at, relative := strings.CutPrefix(fields[0], "+")
+		n, err := strconv.ParseUint(at, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid cycle %q", name, line, fields[0])
+		}
+		if relative {
+			n += cycle
+		} else if n < cycle {
+			return nil, fmt.Errorf("%s:%d: cycle %d is before the event at %d", name, line, n, cycle)
+		}
+		key, err := ParseKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		cycle = n
+		k.Events = append(k.Events, KeyEvent{Cycle: cycle, Key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+/*
+ * ReadKeyboard reads a keyboard script from a file.
+ */
+func ReadKeyboard(path string) (*Keyboard, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseKeyboard(file, path)
+}
+
+/*
+ * ParseKey returns the code of a key: a name from KeyCodes, a single
+ * character or a decimal code.
+ */
+func ParseKey(text string) (int16, error) {
+	if code, ok := KeyCodes[strings.ToLower(text)]; ok {
+		return code, nil
+	}
+	if len(text) == 1 && text[0] > ' ' && text[0] < 127 {
+		return int16(text[0]), nil
+	}
+	code, err := strconv.ParseInt(text, 10, 16)
+	if err != nil || code < 0 {
+		return 0, fmt.Errorf("unknown key %q", text)
+	}
+	return int16(code), nil
+}
+
+/*
+ * Advance moves the script to a cycle and returns the key held down then, with
+ * changed set if events took effect since the cycle Advance was last called
+ * with. Going back in time, as after a reset, replays the script from the
+ * start.
+ */
+func (k *Keyboard) Advance(cycle uint64) (key int16, changed bool) {
+	rewound := cycle < k.last
+	if rewound {
+		k.next = 0
+	}
+	k.last = cycle
+	start := k.next
+	for k.next < len(k.Events) && k.Events[k.next].Cycle <= cycle {
+		k.next++
+	}
+	if k.next > 0 {
+		key = k.Events[k.next-1].Key
+	}
+	return key, rewound || k.next != start
+}
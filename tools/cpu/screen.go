@@ -0,0 +1,126 @@
+package cpu
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+const (
+	ScreenWidth  = 512
+	ScreenHeight = 256
+)
+
+/*
+ * screenPalette draws a 0 bit white and a 1 bit black, as the book's screen.
+ */
+var screenPalette = color.Palette{color.White, color.Black}
+
+/*
+ * Screen renders the screen memory map, RAM[SCREEN..KBD-1]: row r is the 32
+ * words from SCREEN+32*r, and the pixel in column c is bit c%16 of word c/16,
+ * so the least significant bit is leftmost.
+ */
+func (c *CPU) Screen() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, ScreenWidth, ScreenHeight), screenPalette)
+	for i, word := range c.RAM[SCREEN:KBD] {
+		if word == 0 {
+			continue
+		}
+		row := img.Pix[i/32*img.Stride:]
+		for bit := 0; bit < 16; bit++ {
+			row[i%32*16+bit] = uint8(uint16(word) >> bit & 1)
+		}
+	}
+	return img
+}
+
+/*
+ * WriteScreenPNG writes the screen as it is now to w as a PNG image.
+ */
+func (c *CPU) WriteScreenPNG(w io.Writer) error {
+	return png.Encode(w, c.Screen())
+}
+
+/*
+ * Animation records the screen over a run as the frames of an animated GIF.
+ * A frame identical to the one before only extends its delay, so programs
+ * that redraw rarely stay small.
+ */
+type Animation struct {
+	delay int
+	gif   gif.GIF
+}
+
+/*
+ * NewAnimation returns an animation that shows each frame for delay
+ * hundredths of a second.
+ */
+func NewAnimation(delay int) *Animation {
+	if delay < 1 {
+		delay = 1
+	}
+	return &Animation{delay: delay}
+}
+
+/*
+ * Add records the screen as the next frame.
+ */
+func (a *Animation) Add(c *CPU) {
+	img := c.Screen()
+	if n := len(a.gif.Image); n > 0 && bytes.Equal(a.gif.Image[n-1].Pix, img.Pix) {
+		a.gif.Delay[n-1] += a.delay
+		return
+	}
+	a.gif.Image = append(a.gif.Image, img)
+	a.gif.Delay = append(a.gif.Delay, a.delay)
+}
+
+/*
+ * Frames returns the number of distinct frames recorded.
+ */
+func (a *Animation) Frames() int {
+	return len(a.gif.Image)
+}
+
+/*
+ * Encode writes the animation to w as a GIF that loops forever.
+ */
+func (a *Animation) Encode(w io.Writer) error {
+	if len(a.gif.Image) == 0 {
+		return fmt.Errorf("no frames recorded")
+	}
+	return gif.EncodeAll(w, &a.gif)
+}
+
+/*
+ * CompareScreen compares the screen with an image of it, say a golden PNG,
+ * reading the image's dark pixels as black. It returns the number of pixels
+ * that differ and the first of them in row order.
+ */
+func (c *CPU) CompareScreen(golden image.Image) (int, image.Point, error) {
+	bounds := golden.Bounds()
+	if bounds.Dx() != ScreenWidth || bounds.Dy() != ScreenHeight {
+		return 0, image.Point{}, fmt.Errorf("image is %dx%d, the screen %dx%d", bounds.Dx(), bounds.Dy(), ScreenWidth, ScreenHeight)
+	}
+	screen := c.Screen()
+	count := 0
+	var first image.Point
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			gray := color.GrayModel.Convert(golden.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+			black := gray.Y < 0x80
+			if black != (screen.Pix[y*screen.Stride+x] == 1) {
+				if count == 0 {
+					first = image.Pt(x, y)
+				}
+				count++
+			}
+		}
+	}
+	return count, first, nil
+}
@@ -0,0 +1,126 @@
+package cpu
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/christopher-weiss/nand2tetris/tools/asm"
+)
+
+/*
+ * rect returns a CPU that runs Rect, which draws a rectangle 16 pixels wide
+ * and RAM[0] rows high in the top left corner, with RAM[0] set to 50.
+ */
+func rect(t *testing.T) *CPU {
+	t.Helper()
+	source, err := os.ReadFile("../../06_assembler/rect/Rect.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := asm.Parse(strings.NewReader(string(source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := program.Translate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := ParseWords(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(words)
+	c.RAM[0] = 50
+	return c
+}
+
+/*
+ * readPNG decodes the PNG image in data.
+ */
+func readPNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+/*
+ * TestScreenMatchesGolden draws Rect and compares the screen with
+ * testdata/rect.png, and with the PNG and the last GIF frame it writes.
+ */
+func TestScreenMatchesGolden(t *testing.T) {
+	c := rect(t)
+	animation := NewAnimation(2)
+	animation.Add(c)
+	for i := 0; i < 10; i++ {
+		c.Run(100)
+		animation.Add(c)
+	}
+	golden, err := os.ReadFile("testdata/rect.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, first, err := c.CompareScreen(readPNG(t, golden)); err != nil || count != 0 {
+		t.Fatalf("screen differs from testdata/rect.png in %d pixels, first %v (%v)", count, first, err)
+	}
+
+	var written bytes.Buffer
+	if err := c.WriteScreenPNG(&written); err != nil {
+		t.Fatal(err)
+	}
+	if count, first, err := c.CompareScreen(readPNG(t, written.Bytes())); err != nil || count != 0 {
+		t.Errorf("written PNG differs from the screen in %d pixels, first %v (%v)", count, first, err)
+	}
+
+	written.Reset()
+	if err := animation.Encode(&written); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := gif.DecodeAll(&written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rectangle grows over the first frames and then stays as it is
+	if n := len(decoded.Image); n != animation.Frames() || n < 3 || n > 10 {
+		t.Fatalf("GIF has %d frames, the animation %d", n, animation.Frames())
+	}
+	last := decoded.Image[len(decoded.Image)-1]
+	if count, first, err := c.CompareScreen(last); err != nil || count != 0 {
+		t.Errorf("last GIF frame differs from the screen in %d pixels, first %v (%v)", count, first, err)
+	}
+
+	c.RAM[SCREEN+32*100+3] = 1 << 4
+	if count, first, _ := c.CompareScreen(readPNG(t, golden)); count != 1 || first != image.Pt(52, 100) {
+		t.Errorf("one pixel set: %d differ, first %v, want 1 at (52,100)", count, first)
+	}
+	if _, _, err := c.CompareScreen(image.NewGray(image.Rect(0, 0, 256, 512))); err == nil {
+		t.Errorf("compared the screen with a 256x512 image")
+	}
+}
+
+/*
+ * TestScreenPixelOrder checks that the least significant bit of a word is
+ * the leftmost of its 16 pixels, as on the book's screen.
+ */
+func TestScreenPixelOrder(t *testing.T) {
+	c := New(nil)
+	c.RAM[SCREEN] = 1
+	c.RAM[SCREEN+1] = -1 << 15
+	c.RAM[SCREEN+32] = 0b110
+	screen := c.Screen()
+	black := map[image.Point]bool{{0, 0}: true, {31, 0}: true, {1, 1}: true, {2, 1}: true}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 48; x++ {
+			if got := screen.ColorIndexAt(x, y) == 1; got != black[image.Pt(x, y)] {
+				t.Errorf("pixel (%d,%d) is black: %v", x, y, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+ * snapshotVersion is written into snapshot files and checked on reading.
+ */
+const snapshotVersion = 1
+
+/*
+ * snapshotWords is how many words a line of a snapshot file holds.
+ */
+const snapshotWords = 8
+
+/*
+ * Snapshot is the complete state of a CPU: memory, registers, the cycle
+ * count and the keyboard script being played, if any (the key held down is
+ * in RAM[KBD]).
+ */
+type Snapshot struct {
+	ROM      [ROMSize]uint16
+	RAM      [RAMSize]int16
+	A        int16
+	D        int16
+	PC       uint16
+	Cycles   uint64
+	Keyboard []KeyEvent
+}
+
+/*
+ * Save takes a snapshot of the CPU.
+ */
+func (c *CPU) Save() *Snapshot {
+	s := &Snapshot{ROM: c.ROM, RAM: c.RAM, A: c.A, D: c.D, PC: c.PC, Cycles: c.Cycles}
+	if c.Keyboard != nil {
+		s.Keyboard = append([]KeyEvent(nil), c.Keyboard.Events...)
+	}
+	return s
+}
+
+/*
+ * Restore puts the CPU back into the state of a snapshot, which it does not
+ * keep, so one snapshot can be restored many times.
+ */
+func (c *CPU) Restore(s *Snapshot) {
+	c.ROM, c.RAM = s.ROM, s.RAM
+	c.A, c.D, c.PC, c.Cycles = s.A, s.D, s.PC, s.Cycles
+	c.Keyboard = nil
+	if s.Keyboard != nil {
+		c.Keyboard = &Keyboard{Events: append([]KeyEvent(nil), s.Keyboard...)}
+		c.Keyboard.Advance(c.Cycles)
+	}
+}
+
+/*
+ * Write writes the snapshot as text, which diff and version control handle
+ * well:
+ *
+ *	snapshot 1
+ *	A 16384
+ *	D -1
+ *	PC 10
+ *	cycles 123456
+ *	keyboard 200000 75
+ *	ROM 0: 4000 ec10 0010 e308 0000 0000 0000 0000
+ *	RAM 0: 256 0 0 0 0 0 0 0
+ *
+ * keyboard lines are the events of the keyboard script. ROM words are in hex
+ * and RAM words in decimal, eight to a line headed by the first address;
+ * lines of zeros are left out.
+ */
+func (s *Snapshot) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "snapshot %d\nA %d\nD %d\nPC %d\ncycles %d\n", snapshotVersion, s.A, s.D, s.PC, s.Cycles)
+	for _, event := range s.Keyboard {
+		fmt.Fprintf(out, "keyboard %d %d\n", event.Cycle, event.Key)
+	}
+	for address := 0; address < ROMSize; address += snapshotWords {
+		words := s.ROM[address : address+snapshotWords]
+		if isZero(words) {
+			continue
+		}
+		fmt.Fprintf(out, "ROM %d:", address)
+		for _, word := range words {
+			fmt.Fprintf(out, " %04x", word)
+		}
+		fmt.Fprintln(out)
+	}
+	for address := 0; address < RAMSize; address += snapshotWords {
+		words := s.RAM[address : address+snapshotWords]
+		if isZero(words) {
+			continue
+		}
+		fmt.Fprintf(out, "RAM %d:", address)
+		for _, word := range words {
+			fmt.Fprintf(out, " %d", word)
+		}
+		fmt.Fprintln(out)
+	}
+	return out.Flush()
+}
+
+func isZero[T uint16 | int16](words []T) bool {
+	for _, word := range words {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * ParseSnapshot reads a snapshot written by Write. name is used in error
+ * messages.
+ */
+func ParseSnapshot(r io.Reader, name string) (*Snapshot, error) {
+	s := &Snapshot{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+	}
+	versioned := false
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if !versioned {
+			if len(fields) != 2 || fields[0] != "snapshot" {
+				return nil, fail("not a snapshot")
+			}
+			if fields[1] != strconv.Itoa(snapshotVersion) {
+				return nil, fail("snapshot version %s, expected %d", fields[1], snapshotVersion)
+			}
+			versioned = true
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "A", "D", "PC", "cycles":
+			if len(fields) != 2 {
+				return nil, fail("expected %s <value>", fields[0])
+			}
+			err = s.setRegister(fields[0], fields[1])
+		case "keyboard":
+			if len(fields) != 3 {
+				return nil, fail("expected keyboard <cycle> <key>")
+			}
+			var event KeyEvent
+			if event.Cycle, err = strconv.ParseUint(fields[1], 10, 64); err == nil {
+				var key int64
+				key, err = strconv.ParseInt(fields[2], 10, 16)
+				event.Key = int16(key)
+			}
+			s.Keyboard = append(s.Keyboard, event)
+		case "ROM", "RAM":
+			err = s.setWords(fields)
+		default:
+			return nil, fail("unknown entry %q", fields[0])
+		}
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !versioned {
+		return nil, fmt.Errorf("%s: not a snapshot", name)
+	}
+	return s, nil
+}
+
+func (s *Snapshot) setRegister(name, text string) error {
+	if name == "cycles" {
+		cycles, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid cycle count %q", text)
+		}
+		s.Cycles = cycles
+		return nil
+	}
+	value, err := strconv.ParseInt(text, 10, 32)
+	if err != nil || value < -32768 || value > 65535 {
+		return fmt.Errorf("invalid %s %q", name, text)
+	}
+	switch name {
+	case "A":
+		s.A = int16(value)
+	case "D":
+		s.D = int16(value)
+	case "PC":
+		s.PC = uint16(value)
+	}
+	return nil
+}
+
+/*
+ * setWords reads a ROM or RAM line: the memory, the first address and the
+ * words from there.
+ */
+func (s *Snapshot) setWords(fields []string) error {
+	if len(fields) < 2 || !strings.HasSuffix(fields[1], ":") {
+		return fmt.Errorf("expected %s <address>: <words>", fields[0])
+	}
+	address, err := strconv.Atoi(strings.TrimSuffix(fields[1], ":"))
+	words := fields[2:]
+	if err != nil || address < 0 || address+len(words) > RAMSize {
+		return fmt.Errorf("invalid address %q", fields[1])
+	}
+	for i, text := range words {
+		if fields[0] == "ROM" {
+			word, err := strconv.ParseUint(text, 16, 16)
+			if err != nil {
+				return fmt.Errorf("invalid instruction %q", text)
+			}
+			s.ROM[address+i] = uint16(word)
+			continue
+		}
+		word, err := strconv.ParseInt(text, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid word %q", text)
+		}
+		s.RAM[address+i] = int16(word)
+	}
+	return nil
+}
+
+/*
+ * ReadSnapshot reads a snapshot file.
+ */
+func ReadSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseSnapshot(file, path)
+}
+
+/*
+ * WriteFile writes the snapshot to a file.
+ */
+func (s *Snapshot) WriteFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+/*
+ * Diff lists how the snapshot t differs from s, one line each: registers,
+ * the cycle count, the number of ROM words that differ and every RAM word
+ * that does, as RAM[address]: old -> new.
+ */
+func (s *Snapshot) Diff(t *Snapshot) []string {
+	var lines []string
+	registers := []struct {
+		name     string
+		old, new int64
+	}{
+		{"A", int64(s.A), int64(t.A)},
+		{"D", int64(s.D), int64(t.D)},
+		{"PC", int64(s.PC), int64(t.PC)},
+		{"cycles", int64(s.Cycles), int64(t.Cycles)},
+	}
+	for _, r := range registers {
+		if r.old != r.new {
+			lines = append(lines, fmt.Sprintf("%s: %d -> %d", r.name, r.old, r.new))
+		}
+	}
+	if fmt.Sprint(s.Keyboard) != fmt.Sprint(t.Keyboard) {
+		lines = append(lines, "keyboard: scripts differ")
+	}
+	rom := 0
+	for address := range s.ROM {
+		if s.ROM[address] != t.ROM[address] {
+			rom++
+		}
+	}
+	if rom > 0 {
+		lines = append(lines, fmt.Sprintf("ROM: %d words differ", rom))
+	}
+	for address := range s.RAM {
+		if s.RAM[address] != t.RAM[address] {
+			lines = append(lines, fmt.Sprintf("RAM[%d]: %d -> %d", address, s.RAM[address], t.RAM[address]))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,226 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*
+ * Labels names ROM addresses after the labels of the assembly program they
+ * were assembled from: an address belongs to the nearest label at or before it.
+ */
+type Labels struct {
+	addresses []int
+	names     []string
+}
+
+/*
+ * NewLabels indexes a symbol table of labels and their ROM addresses. Where
+ * several labels mark one address, a label of the program's own, such as a
+ * function or a loop, names it rather than one the VM translator generated,
+ * and the first in alphabetical order among those of the same kind.
+ */
+func NewLabels(labels map[string]int) *Labels {
+	l := &Labels{}
+	byAddress := map[int]string{}
+	for name, address := range labels {
+		other, ok := byAddress[address]
+		if !ok || generatedLabel(other) && !generatedLabel(name) ||
+			generatedLabel(other) == generatedLabel(name) && name < other {
+			byAddress[address] = name
+		}
+	}
+	for address := range byAddress {
+		l.addresses = append(l.addresses, address)
+	}
+	sort.Ints(l.addresses)
+	for _, address := range l.addresses {
+		l.names = append(l.names, byAddress[address])
+	}
+	return l
+}
+
+/*
+ * generatedLabel reports whether a label is one the VM translator adds: the
+ * return address of a call (f$ret.N) or a comparison (COMPARE_RETURNN), the
+ * true branch of an eq (COMPARE_TRUEN), or one of its shared routines (VM_CALL,
+ * VM_GT, VM_END and the like) and the labels within them (VM_GT$SAME).
+ */
+func generatedLabel(name string) bool {
+	return strings.Contains(name, "$ret.") || strings.HasPrefix(name, "COMPARE_") || strings.HasPrefix(name, "VM_")
+}
+
+/*
+ * Owner returns the label whose code an address belongs to, for counting
+ * cycles per function or loop: the nearest label at or before it that the
+ * program defines, or that starts a routine shared by the VM translator's
+ * code, such as VM_CALL; ok is false for addresses before the first one.
+ */
+func (l *Labels) Owner(address int) (label string, ok bool) {
+	if l == nil {
+		return "", false
+	}
+	for i := sort.SearchInts(l.addresses, address+1) - 1; i >= 0; i-- {
+		name := l.names[i]
+		if !generatedLabel(name) || strings.HasPrefix(name, "VM_") && !strings.Contains(name, "$") {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+/*
+ * Region returns the label an address belongs to and the address's offset from
+ * it; ok is false for addresses before the first label.
+ */
+func (l *Labels) Region(address int) (label string, offset int, ok bool) {
+	if l == nil {
+		return "", 0, false
+	}
+	i := sort.SearchInts(l.addresses, address+1) - 1
+	if i < 0 {
+		return "", 0, false
+	}
+	return l.names[i], address - l.addresses[i], true
+}
+
+/*
+ * Name writes an address relative to its label, e.g. LOOP or LOOP+3, or as a
+ * number if no label precedes it.
+ */
+func (l *Labels) Name(address int) string {
+	label, offset, ok := l.Region(address)
+	switch {
+	case !ok:
+		return fmt.Sprint(address)
+	case offset == 0:
+		return label
+	}
+	return fmt.Sprintf("%s+%d", label, offset)
+}
+
+/*
+ * Tracer logs the instructions a CPU executes, one line each: the cycle, PC
+ * (also relative to its label), the instruction and the A and D registers
+ * after it, plus the RAM word it wrote, if any. Call Before and After around
+ * every Step.
+ */
+type Tracer struct {
+	w           *bufio.Writer
+	labels      *Labels
+	pc          uint16
+	instruction uint16
+	address     int
+}
+
+/*
+ * NewTracer starts a trace written to w, naming addresses after labels, which
+ * may be nil, and writes its header.
+ */
+func NewTracer(w io.Writer, labels *Labels) *Tracer {
+	t := &Tracer{w: bufio.NewWriter(w), labels: labels}
+	fmt.Fprintf(t.w, "%8s %5s  %-24s %-14s %6s %6s  %s\n", "cycle", "PC", "label", "instruction", "A", "D", "M write")
+	return t
+}
+
+/*
+ * Before notes the instruction the CPU is about to execute, and the RAM word
+ * it addresses.
+ */
+func (t *Tracer) Before(c *CPU) {
+	t.pc = c.PC & addrMask
+	t.instruction = c.ROM[t.pc]
+	t.address = int(uint16(c.A) & addrMask)
+}
+
+/*
+ * After writes the line of the instruction noted by Before, with the
+ * registers and the RAM word as it left them.
+ */
+func (t *Tracer) After(c *CPU) {
+	write := ""
+	if t.instruction&0x8008 == 0x8008 {
+		write = fmt.Sprintf("RAM[%d]=%d", t.address, c.RAM[t.address])
+	}
+	label := ""
+	if _, _, ok := t.labels.Region(int(t.pc)); ok {
+		label = t.labels.Name(int(t.pc))
+	}
+	line := fmt.Sprintf("%8d %5d  %-24s %-14s %6d %6d  %s", c.Cycles, t.pc, label, Disassemble(t.instruction), c.A, c.D, write)
+	fmt.Fprintln(t.w, strings.TrimRight(line, " "))
+}
+
+/*
+ * Flush writes out what is buffered; call it when the run ends.
+ */
+func (t *Tracer) Flush() error {
+	return t.w.Flush()
+}
+
+/*
+ * Profile counts the instructions executed at each ROM address by the CPU it
+ * is set on, and how often the jump at each address was taken.
+ */
+type Profile struct {
+	Counts [ROMSize]uint64
+	Taken  [ROMSize]uint64
+}
+
+/*
+ * Write reports the cycles spent per label, the code from one label to the
+ * next that is not generated by the VM translator (see Labels.Owner), and at
+ * the top ROM addresses, each sorted by cycles, with their share of the total.
+ */
+func (p *Profile) Write(w io.Writer, c *CPU, labels *Labels, top int) error {
+	out := bufio.NewWriter(w)
+	var total uint64
+	perLabel := map[string]uint64{}
+	var addresses []int
+	for address, count := range p.Counts {
+		if count == 0 {
+			continue
+		}
+		total += count
+		addresses = append(addresses, address)
+		label, ok := labels.Owner(address)
+		if !ok {
+			label = "(start)"
+		}
+		perLabel[label] += count
+	}
+	if total == 0 {
+		fmt.Fprintln(out, "no instructions executed")
+		return out.Flush()
+	}
+	share := func(count uint64) float64 { return 100 * float64(count) / float64(total) }
+
+	var names []string
+	for name := range perLabel {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := perLabel[names[i]], perLabel[names[j]]
+		return a > b || a == b && names[i] < names[j]
+	})
+	fmt.Fprintf(out, "%d cycles\n\n%12s %7s  %s\n", total, "cycles", "share", "label")
+	for _, name := range names {
+		fmt.Fprintf(out, "%12d %6.2f%%  %s\n", perLabel[name], share(perLabel[name]), name)
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		a, b := p.Counts[addresses[i]], p.Counts[addresses[j]]
+		return a > b || a == b && addresses[i] < addresses[j]
+	})
+	if top > 0 && len(addresses) > top {
+		addresses = addresses[:top]
+	}
+	fmt.Fprintf(out, "\n%12s %7s  %5s  %-24s %s\n", "cycles", "share", "ROM", "label", "instruction")
+	for _, address := range addresses {
+		count := p.Counts[address]
+		fmt.Fprintf(out, "%12d %6.2f%%  %5d  %-24s %s\n", count, share(count), address, labels.Name(address), Disassemble(c.ROM[address]))
+	}
+	return out.Flush()
+}
@@ -0,0 +1,654 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/christopher-weiss/nand2tetris/tools/asm"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+/*
+ * Debugger runs a program on the Hack emulator under the control of commands
+ * read line by line, in the manner of gdb: breakpoints stop before the
+ * instruction at a ROM address executes, watchpoints stop after an
+ * instruction changes a RAM word. Addresses are numbers, labels (for ROM) or
+ * variables and predefined symbols such as SP or SCREEN (for RAM), optionally
+ * plus or minus an offset, e.g. LOOP+2 or SCREEN+32. Given the source map of
+ * a program translated from VM code, the debugger also works in terms of VM
+ * commands and frames, see vm.go. Given debug info, it shows the source line
+ * of the next instruction and accepts file:line as a ROM address. A bounded
+ * undo log of the instructions executed lets it step and run backwards, see
+ * history.go.
+ */
+type Debugger struct {
+	CPU       *cpu.CPU
+	Source    *vm.SourceMap
+	Debug     *asm.DebugInfo
+	labels    map[string]int
+	variables map[string]int
+	index     *cpu.Labels
+	ramNames  map[int]string
+	out       io.Writer
+
+	points      []*point
+	nextID      int
+	breakAt     [cpu.ROMSize]bool
+	watched     [cpu.RAMSize]bool
+	interrupted atomic.Bool
+	history     *history
+	last        string
+}
+
+/*
+ * point is a breakpoint on ROM address lo, or a watchpoint on the RAM words
+ * lo to hi.
+ */
+type point struct {
+	id     int
+	watch  bool
+	lo, hi int
+}
+
+/*
+ * New debugs the program loaded into c. labels name ROM addresses, variables
+ * RAM addresses; either may be nil.
+ */
+func New(c *cpu.CPU, labels, variables map[string]int, out io.Writer) *Debugger {
+	d := &Debugger{CPU: c, labels: labels, variables: variables, index: cpu.NewLabels(labels),
+		ramNames: map[int]string{}, out: out, nextID: 1, history: newHistory(DefaultHistory)}
+	// name a RAM word after its variable or predefined symbol, preferring SP
+	// to R0 and the like
+	var names []string
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		address := variables[name]
+		if other, ok := d.ramNames[address]; !ok || isRegister(other) && !isRegister(name) {
+			d.ramNames[address] = name
+		}
+	}
+	return d
+}
+
+/*
+ * Interrupt stops a running continue or until at the next instruction; call it
+ * from another goroutine, e.g. on Ctrl-C.
+ */
+func (d *Debugger) Interrupt() {
+	d.interrupted.Store(true)
+}
+
+/*
+ * Run reads commands from in until quit or the end of the input, printing a
+ * prompt before each when prompt is set. An empty line repeats the previous
+ * command.
+ */
+func (d *Debugger) Run(in io.Reader, prompt bool) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if prompt {
+			fmt.Fprint(d.out, "(hdb) ")
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = d.last
+		}
+		d.last = line
+		if line == "" {
+			continue
+		}
+		quit, err := d.Exec(line)
+		if err != nil {
+			fmt.Fprintln(d.out, err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+/*
+ * commands are the debugger commands with their short forms and help.
+ */
+var commands = []struct {
+	name, short, usage, help string
+}{
+	{"break", "b", "break <rom address>", "stop before the instruction at the address executes"},
+	{"watch", "w", "watch <ram address>[..<ram address>]", "stop after an instruction changes a word in the range"},
+	{"delete", "d", "delete [n]", "delete breakpoint or watchpoint n, or all of them"},
+	{"info", "i", "info", "list breakpoints and watchpoints"},
+	{"step", "s", "step [n]", "execute one or n instructions"},
+	{"continue", "c", "continue", "run until a breakpoint or watchpoint, or Ctrl-C"},
+	{"until", "u", "until <rom address>", "run until PC reaches the address"},
+	{"reverse-step", "rs", "reverse-step [n]", "undo one or n instructions"},
+	{"reverse-continue", "rc", "reverse-continue", "run backwards to a breakpoint or to the last change of a watched word"},
+	{"into", "", "into", "run to the next VM command, entering calls"},
+	{"next", "n", "next", "run to the next VM command of this function, stepping over calls"},
+	{"finish", "", "finish", "run until the current VM function returns"},
+	{"backtrace", "bt", "backtrace", "show the VM call stack"},
+	{"frame", "f", "frame [n]", "show the VM segments of frame n of the call stack (default 0, the current)"},
+	{"regs", "r", "regs", "show A, D, PC and M = RAM[A]"},
+	{"print", "p", "print <ram address>[..<ram address>]", "show RAM words"},
+	{"set", "", "set A|D|PC|<ram address> <value>", "change a register or RAM word"},
+	{"list", "l", "list [rom address] [n]", "disassemble n instructions around the address (default PC)"},
+	{"screen", "", "screen <file.png>", "save the screen as a PNG image"},
+	{"save", "", "save <file>", "save the machine state to a snapshot file"},
+	{"load", "", "load <file>", "restore the machine state from a snapshot file"},
+	{"reset", "", "reset", "jump back to instruction 0, keeping RAM"},
+	{"help", "h", "help", "show this list"},
+	{"quit", "q", "quit", "leave the debugger"},
+}
+
+/*
+ * Exec executes one command line; quit is set by the quit command.
+ */
+func (d *Debugger) Exec(line string) (quit bool, err error) {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+	for _, command := range commands {
+		if name == command.short && command.short != "" {
+			name = command.name
+		}
+	}
+	switch name {
+	case "break":
+		if len(args) != 1 {
+			return false, usage("break")
+		}
+		address, err := d.romAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		p := d.add(false, address, address)
+		fmt.Fprintf(d.out, "breakpoint %d at %s\n", p.id, d.rom(address))
+	case "watch":
+		if len(args) != 1 {
+			return false, usage("watch")
+		}
+		lo, hi, err := d.ramRange(args[0])
+		if err != nil {
+			return false, err
+		}
+		p := d.add(true, lo, hi)
+		fmt.Fprintf(d.out, "watchpoint %d on %s\n", p.id, d.ramRangeName(lo, hi))
+	case "delete":
+		return false, d.delete(args)
+	case "info":
+		if len(d.points) == 0 {
+			fmt.Fprintln(d.out, "no breakpoints or watchpoints")
+		}
+		for _, p := range d.points {
+			if p.watch {
+				fmt.Fprintf(d.out, "%3d  watchpoint  %s\n", p.id, d.ramRangeName(p.lo, p.hi))
+			} else {
+				fmt.Fprintf(d.out, "%3d  breakpoint  %s\n", p.id, d.rom(p.lo))
+			}
+		}
+		fmt.Fprintf(d.out, "history of %d instructions, up to %d\n", d.history.size, len(d.history.changes))
+	case "step":
+		n := 1
+		if len(args) > 1 {
+			return false, usage("step")
+		}
+		if len(args) == 1 {
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return false, fmt.Errorf("invalid count %q", args[0])
+			}
+		}
+		d.run(n, nil)
+	case "continue":
+		d.run(-1, nil)
+	case "until":
+		if len(args) != 1 {
+			return false, usage("until")
+		}
+		address, err := d.romAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.run(-1, func(pc int) bool { return pc == address })
+	case "reverse-step":
+		n := 1
+		if len(args) > 1 {
+			return false, usage("reverse-step")
+		}
+		if len(args) == 1 {
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return false, fmt.Errorf("invalid count %q", args[0])
+			}
+		}
+		d.reverse(n)
+	case "reverse-continue":
+		d.reverse(-1)
+	case "into", "next", "finish", "backtrace", "frame":
+		return false, d.execVM(name, args)
+	case "regs":
+		c := d.CPU
+		address := int(uint16(c.A) & (cpu.RAMSize - 1))
+		fmt.Fprintf(d.out, "A  %6d  %s\nD  %6d\nPC %6d  %s\nM  %6d  %s\ncycles %d\n", c.A, d.ramName(address), c.D,
+			c.PC, d.rom(int(c.PC)), c.RAM[address], d.ramName(address), c.Cycles)
+	case "print":
+		if len(args) != 1 {
+			return false, usage("print")
+		}
+		lo, hi, err := d.ramRange(args[0])
+		if err != nil {
+			return false, err
+		}
+		for address := lo; address <= hi; address++ {
+			fmt.Fprintf(d.out, "%-18s %6d\n", d.ramName(address), d.CPU.RAM[address])
+		}
+	case "set":
+		if len(args) != 2 {
+			return false, usage("set")
+		}
+		// the history cannot undo the change
+		d.history.clear()
+		return false, d.set(args[0], args[1])
+	case "list":
+		return false, d.list(args)
+	case "screen":
+		if len(args) != 1 {
+			return false, usage("screen")
+		}
+		return false, d.screen(args[0])
+	case "save":
+		if len(args) != 1 {
+			return false, usage("save")
+		}
+		if err := d.CPU.Save().WriteFile(args[0]); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(d.out, "machine at cycle %d saved to %s\n", d.CPU.Cycles, args[0])
+	case "load":
+		if len(args) != 1 {
+			return false, usage("load")
+		}
+		snapshot, err := cpu.ReadSnapshot(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.CPU.Restore(snapshot)
+		d.history.clear()
+		d.where()
+	case "reset":
+		d.CPU.Reset()
+		d.history.clear()
+		d.where()
+	case "help":
+		for _, command := range commands {
+			if vmCommands[command.name] && d.Source == nil {
+				continue
+			}
+			short := ""
+			if command.short != "" {
+				short = " (" + command.short + ")"
+			}
+			fmt.Fprintf(d.out, "%-42s %s%s\n", command.usage, command.help, short)
+		}
+	case "quit":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q; try help", fields[0])
+	}
+	return false, nil
+}
+
+/*
+ * isRegister reports whether a symbol is one of R0 to R15.
+ */
+func isRegister(name string) bool {
+	_, err := strconv.Atoi(strings.TrimPrefix(name, "R"))
+	return strings.HasPrefix(name, "R") && err == nil
+}
+
+func usage(name string) error {
+	for _, command := range commands {
+		if command.name == name {
+			return fmt.Errorf("usage: %s", command.usage)
+		}
+	}
+	return nil
+}
+
+func (d *Debugger) add(watch bool, lo, hi int) *point {
+	p := &point{id: d.nextID, watch: watch, lo: lo, hi: hi}
+	d.nextID++
+	d.points = append(d.points, p)
+	d.mark()
+	return p
+}
+
+func (d *Debugger) delete(args []string) error {
+	if len(args) > 1 {
+		return usage("delete")
+	}
+	if len(args) == 0 {
+		d.points = nil
+		d.mark()
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid breakpoint number %q", args[0])
+	}
+	for i, p := range d.points {
+		if p.id == id {
+			d.points = append(d.points[:i], d.points[i+1:]...)
+			d.mark()
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+/*
+ * mark recomputes the addresses the run loop checks.
+ */
+func (d *Debugger) mark() {
+	d.breakAt = [cpu.ROMSize]bool{}
+	d.watched = [cpu.RAMSize]bool{}
+	for _, p := range d.points {
+		for address := p.lo; address <= p.hi; address++ {
+			if p.watch {
+				d.watched[address] = true
+			} else {
+				d.breakAt[address] = true
+			}
+		}
+	}
+}
+
+/*
+ * run executes up to n instructions (without limit if n < 0), stopping at
+ * breakpoints, watchpoints, when stop (if set) reports true for the new PC or
+ * on Interrupt, and shows where it stopped.
+ */
+func (d *Debugger) run(n int, stop func(pc int) bool) {
+	c := d.CPU
+	d.interrupted.Store(false)
+	reason := ""
+	for i := 0; n < 0 || i < n; i++ {
+		instruction := c.ROM[c.PC&(cpu.ROMSize-1)]
+		address := int(uint16(c.A) & (cpu.RAMSize - 1))
+		writes := instruction&0x8008 == 0x8008 && d.watched[address]
+		old := c.RAM[address]
+		d.history.record(c)
+		c.Step()
+		if writes && c.RAM[address] != old {
+			for _, p := range d.points {
+				if p.watch && p.lo <= address && address <= p.hi {
+					reason = fmt.Sprintf("watchpoint %d: %s changed from %d to %d", p.id, d.ramName(address), old, c.RAM[address])
+					break
+				}
+			}
+			break
+		}
+		pc := int(c.PC & (cpu.ROMSize - 1))
+		if stop != nil && stop(pc) {
+			break
+		}
+		if d.breakAt[pc] {
+			for _, p := range d.points {
+				if !p.watch && p.lo == pc {
+					reason = fmt.Sprintf("breakpoint %d", p.id)
+					break
+				}
+			}
+			break
+		}
+		if i&1023 == 0 && d.interrupted.Load() {
+			reason = "interrupted"
+			break
+		}
+	}
+	if reason != "" {
+		fmt.Fprintln(d.out, reason)
+	}
+	d.where()
+}
+
+/*
+ * where shows the instruction about to execute.
+ */
+func (d *Debugger) where() {
+	pc := int(d.CPU.PC & (cpu.ROMSize - 1))
+	if d.Source != nil {
+		if entry, ok := d.Source.Lookup(pc); ok {
+			fmt.Fprintln(d.out, location(entry))
+		}
+	} else if d.Debug != nil {
+		if line, ok := d.Debug.Lookup(pc); ok {
+			fmt.Fprintln(d.out, line)
+		}
+	}
+	fmt.Fprintf(d.out, "%5d  %-24s %s\n", pc, d.label(pc), cpu.Disassemble(d.CPU.ROM[pc]))
+}
+
+func (d *Debugger) list(args []string) error {
+	center := int(d.CPU.PC & (cpu.ROMSize - 1))
+	n := 11
+	if len(args) > 2 {
+		return usage("list")
+	}
+	if len(args) > 0 {
+		var err error
+		if center, err = d.romAddress(args[0]); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			return fmt.Errorf("invalid count %q", args[1])
+		}
+	}
+	lo := center - n/2
+	if lo < 0 {
+		lo = 0
+	}
+	hi := lo + n - 1
+	if hi >= cpu.ROMSize {
+		hi = cpu.ROMSize - 1
+	}
+	for address := lo; address <= hi; address++ {
+		if d.Source != nil {
+			for _, entry := range d.Source.Entries {
+				if entry.Address == address && entry.Command.CommandType != vm.C_LABEL {
+					fmt.Fprintf(d.out, "// %s\n", location(entry))
+				}
+			}
+		}
+		if label, offset, ok := d.index.Region(address); ok && offset == 0 {
+			fmt.Fprintf(d.out, "(%s)\n", label)
+		}
+		// * marks a breakpoint, => the next instruction
+		breakpoint, current := " ", "  "
+		if d.breakAt[address] {
+			breakpoint = "*"
+		}
+		if address == int(d.CPU.PC&(cpu.ROMSize-1)) {
+			current = "=>"
+		}
+		fmt.Fprintf(d.out, "%s%s %5d  %s\n", breakpoint, current, address, cpu.Disassemble(d.CPU.ROM[address]))
+	}
+	return nil
+}
+
+func (d *Debugger) set(name, text string) error {
+	value, err := strconv.Atoi(text)
+	if err != nil || value < -32768 || value > 65535 {
+		return fmt.Errorf("invalid value %q", text)
+	}
+	c := d.CPU
+	switch name {
+	case "A":
+		c.A = int16(value)
+	case "D":
+		c.D = int16(value)
+	case "PC":
+		if value < 0 || value >= cpu.ROMSize {
+			return fmt.Errorf("PC %d out of range", value)
+		}
+		c.PC = uint16(value)
+		d.where()
+	default:
+		address, err := d.ramAddress(name)
+		if err != nil {
+			return err
+		}
+		c.RAM[address] = int16(value)
+	}
+	return nil
+}
+
+/*
+ * screen saves the screen as it is now, at the current cycle.
+ */
+func (d *Debugger) screen(name string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := d.CPU.WriteScreenPNG(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "screen at cycle %d saved to %s\n", d.CPU.Cycles, name)
+	return nil
+}
+
+/*
+ * rom writes a ROM address with its label, e.g. 14 (END+2).
+ */
+func (d *Debugger) rom(address int) string {
+	if label := d.label(address); label != "" {
+		return fmt.Sprintf("%d (%s)", address, label)
+	}
+	return fmt.Sprint(address)
+}
+
+func (d *Debugger) label(address int) string {
+	if _, _, ok := d.index.Region(address); ok {
+		return d.index.Name(address)
+	}
+	return ""
+}
+
+/*
+ * ramName writes a RAM address with its symbol, e.g. RAM[0] (SP).
+ */
+func (d *Debugger) ramName(address int) string {
+	if name, ok := d.ramNames[address]; ok {
+		return fmt.Sprintf("RAM[%d] (%s)", address, name)
+	}
+	return fmt.Sprintf("RAM[%d]", address)
+}
+
+func (d *Debugger) ramRangeName(lo, hi int) string {
+	if lo == hi {
+		return d.ramName(lo)
+	}
+	return fmt.Sprintf("RAM[%d..%d]", lo, hi)
+}
+
+func (d *Debugger) romAddress(text string) (int, error) {
+	if file, line, ok := strings.Cut(text, ".vm:"); ok && d.Source != nil {
+		return d.sourceAddress(file, line)
+	}
+	// labels may contain colons too, so file:line is only taken if it exists
+	if i := strings.LastIndex(text, ":"); i > 0 && d.Debug != nil {
+		if line, err := strconv.Atoi(text[i+1:]); err == nil {
+			if address, ok := d.Debug.Address(text[:i], line); ok {
+				return address, nil
+			}
+		}
+	}
+	address, err := evaluate(text, d.labels)
+	if err == nil && (address < 0 || address >= cpu.ROMSize) {
+		err = fmt.Errorf("ROM address %s out of range", text)
+	}
+	return address, err
+}
+
+func (d *Debugger) ramAddress(text string) (int, error) {
+	address, err := evaluate(strings.TrimSuffix(strings.TrimPrefix(text, "RAM["), "]"), d.variables)
+	if err == nil && (address < 0 || address >= cpu.RAMSize) {
+		err = fmt.Errorf("RAM address %s out of range", text)
+	}
+	return address, err
+}
+
+/*
+ * ramRange reads a RAM address or a range lo..hi, both inclusive.
+ */
+func (d *Debugger) ramRange(text string) (lo, hi int, err error) {
+	from, to, isRange := strings.Cut(text, "..")
+	if lo, err = d.ramAddress(from); err != nil {
+		return 0, 0, err
+	}
+	hi = lo
+	if isRange {
+		if hi, err = d.ramAddress(to); err != nil {
+			return 0, 0, err
+		}
+	}
+	if hi < lo {
+		return 0, 0, fmt.Errorf("empty range %s", text)
+	}
+	return lo, hi, nil
+}
+
+/*
+ * evaluate reads an address: a number or symbol, followed by any number of
+ * +n or -n offsets.
+ */
+func evaluate(text string, symbols map[string]int) (int, error) {
+	i := strings.IndexAny(text[min(1, len(text)):], "+-") + 1
+	if i == 0 {
+		i = len(text)
+	}
+	term, rest := text[:i], text[i:]
+	value, err := strconv.Atoi(term)
+	if err != nil {
+		address, ok := symbols[term]
+		if !ok {
+			return 0, fmt.Errorf("unknown address %q", term)
+		}
+		value = address
+	}
+	for rest != "" {
+		sign := 1
+		if rest[0] == '-' {
+			sign = -1
+		}
+		rest = rest[1:]
+		j := strings.IndexAny(rest, "+-")
+		if j < 0 {
+			j = len(rest)
+		}
+		offset, err := strconv.Atoi(rest[:j])
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset in %q", text)
+		}
+		value += sign * offset
+		rest = rest[j:]
+	}
+	return value, nil
+}
@@ -0,0 +1,234 @@
+package debug
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/christopher-weiss/nand2tetris/tools/build"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+)
+
+/*
+ * fibonacci debugs FibonacciElement, translated and assembled in memory:
+ * Sys.init calls the recursive Main.fibonacci with 4.
+ */
+func fibonacci(t *testing.T) (*Debugger, *bytes.Buffer) {
+	t.Helper()
+	program, symbols, err := build.HackSymbols("../../08_virtual_machine_2/FunctionCalls/FibonacciElement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	d := New(cpu.New(program), symbols.Labels, symbols.Variables, &out)
+	d.Source, d.Debug = symbols.Source, symbols.Debug
+	return d, &out
+}
+
+/*
+ * exec runs a command line and returns what the debugger printed.
+ */
+func exec(t *testing.T, d *Debugger, out *bytes.Buffer, line string) string {
+	t.Helper()
+	out.Reset()
+	if _, err := d.Exec(line); err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+	return out.String()
+}
+
+/*
+ * TestBreakContinue stops at a breakpoint in Main.fibonacci each time the
+ * function is entered, with the argument of the call in its frame.
+ */
+func TestBreakContinue(t *testing.T) {
+	d, out := fibonacci(t)
+	address := d.labels["Main.fibonacci"]
+	if got, want := exec(t, d, out, "break Main.fibonacci"), fmt.Sprintf("breakpoint 1 at %d (Main.fibonacci)\n", address); got != want {
+		t.Errorf("break printed %q, want %q", got, want)
+	}
+	// fibonacci(4) calls fibonacci(2), which calls fibonacci(0)
+	for _, n := range []int16{4, 2, 0} {
+		got := exec(t, d, out, "continue")
+		if !strings.HasPrefix(got, "breakpoint 1\nMain.vm:12 push argument 0 (in Main.fibonacci)\n") {
+			t.Fatalf("continue printed\n%s", got)
+		}
+		if pc := int(d.CPU.PC); pc != address {
+			t.Fatalf("stopped at %d, want %d", pc, address)
+		}
+		if arg := d.CPU.RAM[d.CPU.RAM[cpu.ARG]]; arg != n {
+			t.Errorf("argument 0 is %d, want %d", arg, n)
+		}
+	}
+
+	// Main.fibonacci has no locals, nor a working stack yet
+	frame := exec(t, d, out, "frame")
+	if want := fmt.Sprintf("\nlocal     LCL=%d\n", d.CPU.RAM[cpu.LCL]); !strings.Contains(frame, want) || strings.Contains(frame, " \n") {
+		t.Errorf("frame printed\n%q", frame)
+	}
+}
+
+/*
+ * TestWatch stops where Sys.init pushes 4 to the word its call later returns
+ * fibonacci(4) in, and then where that return stores the result.
+ */
+func TestWatch(t *testing.T) {
+	d, out := fibonacci(t)
+	exec(t, d, out, "watch 261")
+	for _, want := range []string{
+		"watchpoint 1: RAM[261] changed from 0 to 4\nSys.vm:12 push constant 4 (in Sys.init)\n",
+		"watchpoint 1: RAM[261] changed from 4 to 3\n(shared routines)\n",
+	} {
+		if got := exec(t, d, out, "continue"); !strings.HasPrefix(got, want) {
+			t.Errorf("continue printed\n%swant\n%s", got, want)
+		}
+	}
+}
+
+/*
+ * TestFinish runs from the entry of fibonacci(4), the outermost call, to
+ * the command after the call in Sys.init, with the result on the stack.
+ */
+func TestFinish(t *testing.T) {
+	d, out := fibonacci(t)
+	exec(t, d, out, "break Main.fibonacci")
+	exec(t, d, out, "continue")
+	exec(t, d, out, "delete")
+	if got := exec(t, d, out, "finish"); !strings.HasPrefix(got, "Sys.vm:15 goto WHILE (in Sys.init)\n") {
+		t.Errorf("finish stopped at\n%s", got)
+	}
+	c := d.CPU
+	if sp := c.RAM[cpu.SP]; sp != 262 || c.RAM[sp-1] != 3 {
+		t.Errorf("SP is %d with %d on top, want 262 with fibonacci(4) = 3", sp, c.RAM[sp-1])
+	}
+}
+
+/*
+ * TestBacktrace stops in fibonacci(0), called by fibonacci(2), called by
+ * fibonacci(4), and reconstructs the frames of the recursion from RAM.
+ */
+func TestBacktrace(t *testing.T) {
+	d, out := fibonacci(t)
+	exec(t, d, out, "break Main.fibonacci$IF_TRUE")
+	exec(t, d, out, "continue")
+	want := "#0   Main.vm:18 push argument 0 (in Main.fibonacci)\n" +
+		"#1   Main.vm:24 call Main.fibonacci 1 (in Main.fibonacci)\n" +
+		"#2   Main.vm:24 call Main.fibonacci 1 (in Main.fibonacci)\n" +
+		"#3   Sys.vm:13 call Main.fibonacci 1 (in Sys.init)\n"
+	if got := exec(t, d, out, "backtrace"); got != want {
+		t.Errorf("backtrace printed\n%swant\n%s", got, want)
+	}
+
+	// each call of fibonacci pushes its argument and the 5 words of the
+	// saved frame, Sys.init has neither arguments nor locals
+	frames := d.frames()
+	for i, f := range frames {
+		arg, lcl := 273-6*i, 279-6*i
+		if i == 3 {
+			arg, lcl = 256, 261
+		}
+		if f.arg != arg || f.lcl != lcl {
+			t.Errorf("frame %d has ARG=%d LCL=%d, want ARG=%d LCL=%d", i, f.arg, f.lcl, arg, lcl)
+		}
+	}
+	for n, want := range map[string]string{
+		"0": "argument  ARG=273  [0]=0\nlocal     LCL=279\n",
+		"1": "argument  ARG=267  [0]=2\nlocal     LCL=273\n",
+		"2": "argument  ARG=261  [0]=4\nlocal     LCL=267\n",
+		"3": "argument  ARG=256\nlocal     LCL=261\n",
+	} {
+		if got := exec(t, d, out, "frame "+n); !strings.Contains(got, want) {
+			t.Errorf("frame %s printed\n%swant\n%s", n, got, want)
+		}
+	}
+	if _, err := d.Exec("frame 4"); err == nil || err.Error() != "no frame 4; backtrace lists 4" {
+		t.Errorf("frame 4: error %v", err)
+	}
+}
+
+/*
+ * TestReverseStep steps forward and back again over key presses and
+ * releases, which leaves the machine as it was, keyboard included, and
+ * then forward again, which replays the keys.
+ */
+func TestReverseStep(t *testing.T) {
+	d, out := fibonacci(t)
+	c := d.CPU
+	c.Keyboard = &cpu.Keyboard{Events: []cpu.KeyEvent{{Cycle: 50, Key: 'A'}, {Cycle: 400, Key: 0}, {Cycle: 700, Key: 140}}}
+	exec(t, d, out, "step 20")
+	before := c.Save()
+	exec(t, d, out, "step 1000")
+	after := c.Save()
+	if c.RAM[cpu.KBD] != 140 {
+		t.Fatalf("KBD is %d after %d cycles, want 140", c.RAM[cpu.KBD], c.Cycles)
+	}
+	exec(t, d, out, "reverse-step 1000")
+	if differences := before.Diff(c.Save()); len(differences) > 0 {
+		t.Fatalf("reverse-step 1000 after step 1000 differs: %v", differences)
+	}
+	exec(t, d, out, "step 1000")
+	if differences := after.Diff(c.Save()); len(differences) > 0 {
+		t.Fatalf("step 1000 after reverse-step 1000 differs: %v", differences)
+	}
+}
+
+/*
+ * TestReverseContinue runs back from the third entry of Main.fibonacci to
+ * the second, and from past the return that stores the result in a watched
+ * word back to that return.
+ */
+func TestReverseContinue(t *testing.T) {
+	d, out := fibonacci(t)
+	c := d.CPU
+	exec(t, d, out, "break Main.fibonacci")
+	exec(t, d, out, "continue")
+	exec(t, d, out, "continue")
+	second := c.Save()
+	exec(t, d, out, "continue")
+	if got := exec(t, d, out, "reverse-continue"); !strings.HasPrefix(got, "breakpoint 1\n") {
+		t.Errorf("reverse-continue printed\n%s", got)
+	}
+	if differences := second.Diff(c.Save()); len(differences) > 0 {
+		t.Fatalf("reverse-continue to the second call differs: %v", differences)
+	}
+
+	exec(t, d, out, "delete")
+	exec(t, d, out, "watch 261")
+	exec(t, d, out, "continue")
+	exec(t, d, out, "step 10")
+	want := "watchpoint 2: RAM[261] was changed from 4 to 3 here\n(shared routines)\n"
+	if got := exec(t, d, out, "reverse-continue"); !strings.HasPrefix(got, want) {
+		t.Errorf("reverse-continue printed\n%swant\n%s", got, want)
+	}
+	if c.RAM[261] != 4 {
+		t.Errorf("RAM[261] is %d before the return, want 4", c.RAM[261])
+	}
+}
+
+/*
+ * TestReversePastHistory rewinds further than the history reaches, which
+ * stops at its start, as far back as its capacity.
+ */
+func TestReversePastHistory(t *testing.T) {
+	d, out := fibonacci(t)
+	c := d.CPU
+	d.SetHistory(100)
+	exec(t, d, out, "step 150")
+	oldest := c.Save()
+	exec(t, d, out, "step 100")
+	for i := 0; i < 2; i++ {
+		if got := exec(t, d, out, "reverse-step 300"); !strings.HasPrefix(got, "start of the recorded history\n") {
+			t.Errorf("reverse-step 300 printed\n%s", got)
+		}
+		if differences := oldest.Diff(c.Save()); len(differences) > 0 {
+			t.Fatalf("rewound to cycle %d, not to the oldest recorded: %v", c.Cycles, differences)
+		}
+	}
+
+	d.SetHistory(0)
+	exec(t, d, out, "step 10")
+	if got := exec(t, d, out, "reverse-step"); !strings.HasPrefix(got, "no history is recorded\n") {
+		t.Errorf("reverse-step without history printed\n%s", got)
+	}
+}
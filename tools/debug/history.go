@@ -0,0 +1,163 @@
+package debug
+
+import (
+	"fmt"
+
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+)
+
+/*
+ * DefaultHistory is how many instructions the debugger can undo unless told
+ * otherwise, at 12 bytes each.
+ */
+const DefaultHistory = 1 << 20
+
+/*
+ * noWrite marks a change of an instruction that wrote no RAM word.
+ */
+const noWrite = 0xffff
+
+/*
+ * change is what an instruction overwrote: the registers, the RAM word it
+ * stored to, if any, and the keyboard register, which a keyboard script may
+ * change on any step.
+ */
+type change struct {
+	pc      uint16
+	a, d    int16
+	address uint16
+	old     int16
+	key     int16
+}
+
+/*
+ * history is the undo log of the instructions executed, a ring buffer that
+ * forgets the oldest instruction when it is full.
+ */
+type history struct {
+	changes []change
+	start   int
+	size    int
+}
+
+func newHistory(capacity int) *history {
+	return &history{changes: make([]change, capacity)}
+}
+
+/*
+ * record notes what the instruction at PC is about to overwrite.
+ */
+func (h *history) record(c *cpu.CPU) {
+	if len(h.changes) == 0 {
+		return
+	}
+	instruction := c.ROM[c.PC&(cpu.ROMSize-1)]
+	entry := change{pc: c.PC, a: c.A, d: c.D, address: noWrite, key: c.RAM[cpu.KBD]}
+	if instruction&0x8008 == 0x8008 {
+		entry.address = uint16(c.A) & (cpu.RAMSize - 1)
+		entry.old = c.RAM[entry.address]
+	}
+	i := h.start + h.size
+	if h.size == len(h.changes) {
+		h.start = (h.start + 1) % len(h.changes)
+	} else {
+		h.size++
+	}
+	h.changes[i%len(h.changes)] = entry
+}
+
+/*
+ * last returns the change of the latest instruction; ok is false when the
+ * history is empty.
+ */
+func (h *history) last() (entry change, ok bool) {
+	if h.size == 0 {
+		return change{}, false
+	}
+	return h.changes[(h.start+h.size-1)%len(h.changes)], true
+}
+
+/*
+ * undo takes back the latest instruction.
+ */
+func (h *history) undo(c *cpu.CPU) bool {
+	entry, ok := h.last()
+	if !ok {
+		return false
+	}
+	h.size--
+	if entry.address != noWrite {
+		c.RAM[entry.address] = entry.old
+	}
+	c.RAM[cpu.KBD] = entry.key
+	c.PC, c.A, c.D = entry.pc, entry.a, entry.d
+	c.Cycles--
+	return true
+}
+
+func (h *history) clear() {
+	h.start, h.size = 0, 0
+}
+
+/*
+ * SetHistory sets how many instructions can be undone, 0 for none, and
+ * forgets those executed so far.
+ */
+func (d *Debugger) SetHistory(n int) {
+	d.history = newHistory(n)
+}
+
+/*
+ * reverse runs backwards n instructions, or without a limit if n is
+ * negative, stopping at breakpoints and before the last instruction that
+ * changed a watched word.
+ */
+func (d *Debugger) reverse(n int) {
+	c := d.CPU
+	d.interrupted.Store(false)
+	reason := ""
+	for i := 0; n < 0 || i < n; i++ {
+		entry, ok := d.history.last()
+		if !ok {
+			reason = "start of the recorded history"
+			if len(d.history.changes) == 0 {
+				reason = "no history is recorded"
+			}
+			break
+		}
+		changed := entry.address != noWrite && d.watched[entry.address] && c.RAM[entry.address] != entry.old
+		value := int16(0)
+		if changed {
+			value = c.RAM[entry.address]
+		}
+		d.history.undo(c)
+		if changed {
+			address := int(entry.address)
+			for _, p := range d.points {
+				if p.watch && p.lo <= address && address <= p.hi {
+					reason = fmt.Sprintf("watchpoint %d: %s was changed from %d to %d here", p.id, d.ramName(address), entry.old, value)
+					break
+				}
+			}
+			break
+		}
+		pc := int(c.PC & (cpu.ROMSize - 1))
+		if d.breakAt[pc] {
+			for _, p := range d.points {
+				if !p.watch && p.lo == pc {
+					reason = fmt.Sprintf("breakpoint %d", p.id)
+					break
+				}
+			}
+			break
+		}
+		if i&1023 == 0 && d.interrupted.Load() {
+			reason = "interrupted"
+			break
+		}
+	}
+	if reason != "" {
+		fmt.Fprintln(d.out, reason)
+	}
+	d.where()
+}
@@ -0,0 +1,267 @@
+package debug
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+/*
+ * vmCommands need the source map of the program.
+ */
+var vmCommands = map[string]bool{"into": true, "next": true, "finish": true, "backtrace": true, "frame": true}
+
+/*
+ * maxFrames bounds the call stack walk, which follows pointers a broken
+ * program may have corrupted.
+ */
+const maxFrames = 256
+
+/*
+ * frame is a VM function activation as the calling convention leaves it in
+ * RAM: the command being executed (for callers, their call) and the segment
+ * pointers. A callee's frame holds the caller's pointers at LCL-4 to LCL-1
+ * and the return address at LCL-5.
+ */
+type frame struct {
+	entry                vm.MapEntry
+	lcl, arg, this, that int
+}
+
+/*
+ * location writes a command with where it comes from, e.g.
+ * Main.vm:12 push argument 0 (in Main.fibonacci).
+ */
+func location(entry vm.MapEntry) string {
+	if entry.Command.File == "" {
+		return fmt.Sprintf("(%s)", entry.Command.Command)
+	}
+	text := fmt.Sprintf("%s.vm:%d %s", entry.Command.File, entry.Command.Line, entry.Command)
+	if entry.Function != "" {
+		text += fmt.Sprintf(" (in %s)", entry.Function)
+	}
+	return text
+}
+
+/*
+ * sourceAddress returns the ROM address of the code of the command on a line
+ * of a .vm file.
+ */
+func (d *Debugger) sourceAddress(file, line string) (int, error) {
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, fmt.Errorf("invalid line %q", line)
+	}
+	for _, entry := range d.Source.Entries {
+		if entry.Command.File == file && entry.Command.Line == n {
+			return entry.Address, nil
+		}
+	}
+	return 0, fmt.Errorf("no VM command at %s.vm:%d", file, n)
+}
+
+func (d *Debugger) execVM(name string, args []string) error {
+	if d.Source == nil {
+		return fmt.Errorf("%s needs a program translated from VM code", name)
+	}
+	c := d.CPU
+	starts := d.commandStarts()
+	switch name {
+	case "into":
+		d.run(-1, func(pc int) bool { return starts[pc] })
+	case "next", "finish":
+		lcl := int(c.RAM[cpu.LCL])
+		caller := -1
+		if lcl >= 5 && lcl < cpu.RAMSize {
+			caller = int(c.RAM[lcl-4])
+		}
+		if name == "finish" {
+			if caller < 0 {
+				return fmt.Errorf("not in a VM function")
+			}
+			d.run(-1, func(pc int) bool { return starts[pc] && int(c.RAM[cpu.LCL]) == caller })
+			break
+		}
+		// back at a command of this function, or of its caller after return
+		d.run(-1, func(pc int) bool {
+			frame := int(c.RAM[cpu.LCL])
+			return starts[pc] && (frame == lcl || frame == caller)
+		})
+	case "backtrace":
+		for i, f := range d.frames() {
+			fmt.Fprintf(d.out, "#%-3d %s\n", i, location(f.entry))
+		}
+	case "frame":
+		frames := d.frames()
+		n := 0
+		if len(args) > 1 {
+			return usage("frame")
+		}
+		if len(args) == 1 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 0 || n >= len(frames) {
+				return fmt.Errorf("no frame %s; backtrace lists %d", args[0], len(frames))
+			}
+		}
+		d.showFrame(frames, n)
+	}
+	return nil
+}
+
+/*
+ * commandStarts marks the ROM addresses where the code of a VM command of the
+ * program starts, as opposed to code the translator added.
+ */
+func (d *Debugger) commandStarts() *[cpu.ROMSize]bool {
+	starts := &[cpu.ROMSize]bool{}
+	entries := d.Source.Entries
+	for i, entry := range entries {
+		// of the commands at one address, only the last has code there
+		last := i == len(entries)-1 || entries[i+1].Address != entry.Address
+		if last && entry.Command.File != "" && entry.Address < cpu.ROMSize {
+			starts[entry.Address] = true
+		}
+	}
+	return starts
+}
+
+/*
+ * frames reconstructs the VM call stack from the saved frames, innermost
+ * first, down to the function the bootstrap called or to the first frame
+ * that does not look like one.
+ */
+func (d *Debugger) frames() []frame {
+	c := d.CPU
+	ram := func(address int) int {
+		if address < 0 || address >= cpu.RAMSize {
+			return -1
+		}
+		return int(c.RAM[address])
+	}
+	pc := int(c.PC & (cpu.ROMSize - 1))
+	f := frame{lcl: ram(cpu.LCL), arg: ram(cpu.ARG), this: ram(cpu.THIS), that: ram(cpu.THAT)}
+	var frames []frame
+	for len(frames) < maxFrames {
+		entry, ok := d.Source.Lookup(pc)
+		if !ok {
+			break
+		}
+		f.entry = entry
+		frames = append(frames, f)
+		if entry.Function == "" || f.lcl < 5 {
+			break
+		}
+		ret := ram(f.lcl - 5)
+		if ret <= 0 || ret >= cpu.ROMSize {
+			break
+		}
+		if caller, ok := d.Source.Lookup(ret - 1); !ok || caller.Command.CommandType != vm.C_CALL {
+			break
+		}
+		pc = ret - 1
+		f = frame{lcl: ram(f.lcl - 4), arg: ram(f.lcl - 3), this: ram(f.lcl - 2), that: ram(f.lcl - 1)}
+	}
+	return frames
+}
+
+/*
+ * showFrame prints the segments of frame n: argument and local sized by the
+ * call and the function, the first words of this and that, the statics of
+ * the frame's file, and for the current frame also pointer, temp and the
+ * working stack.
+ */
+func (d *Debugger) showFrame(frames []frame, n int) {
+	c := d.CPU
+	f := frames[n]
+	words := func(base, count int) string {
+		var values []string
+		for i := 0; i < count && base+i < cpu.RAMSize; i++ {
+			values = append(values, fmt.Sprintf("[%d]=%d", i, c.RAM[base+i]))
+		}
+		return strings.Join(values, " ")
+	}
+	// a segment without words ends at its pointer
+	segment := func(head, values string) {
+		if values != "" {
+			head += "  " + values
+		}
+		fmt.Fprintln(d.out, head)
+	}
+	fmt.Fprintf(d.out, "#%d %s\n", n, location(f.entry))
+	locals := d.locals(f.entry.Function)
+	if f.entry.Function != "" && f.lcl >= 5 && f.arg >= 0 {
+		if args := f.lcl - 5 - f.arg; args >= 0 && args < 256 {
+			segment(fmt.Sprintf("argument  ARG=%d", f.arg), words(f.arg, args))
+		}
+		segment(fmt.Sprintf("local     LCL=%d", f.lcl), words(f.lcl, locals))
+	}
+	for _, segment := range []struct {
+		name    string
+		pointer int
+	}{{"this", f.this}, {"that", f.that}} {
+		if segment.pointer > 0 {
+			fmt.Fprintf(d.out, "%-9s %s=%d  %s ...\n", segment.name, strings.ToUpper(segment.name), segment.pointer, words(segment.pointer, 4))
+		} else {
+			fmt.Fprintf(d.out, "%-9s %s=%d\n", segment.name, strings.ToUpper(segment.name), segment.pointer)
+		}
+	}
+	if statics := d.statics(f.entry.Command.File); statics != "" {
+		fmt.Fprintf(d.out, "static    %s\n", statics)
+	}
+	if n > 0 {
+		return
+	}
+	fmt.Fprintf(d.out, "pointer   %s\n", words(3, 2))
+	fmt.Fprintf(d.out, "temp      %s\n", words(5, 8))
+	sp := int(c.RAM[cpu.SP])
+	base := f.lcl + locals
+	if f.entry.Function == "" {
+		base = 256
+	}
+	if base >= 0 && sp >= base && sp-base <= 1024 {
+		var values []string
+		for address := base; address < sp; address++ {
+			values = append(values, fmt.Sprint(c.RAM[address]))
+		}
+		segment(fmt.Sprintf("stack     SP=%d", sp), strings.Join(values, " "))
+	}
+}
+
+/*
+ * locals returns the number of locals the named function declares.
+ */
+func (d *Debugger) locals(function string) int {
+	for _, entry := range d.Source.Entries {
+		if entry.Command.CommandType == vm.C_FUNCTION && entry.Command.Segment == function {
+			return int(entry.Command.Index)
+		}
+	}
+	return 0
+}
+
+/*
+ * statics writes the static variables of a .vm file, File.0, File.1, ..., in
+ * order with their values.
+ */
+func (d *Debugger) statics(file string) string {
+	type static struct {
+		index, address int
+	}
+	var found []static
+	for name, address := range d.variables {
+		index, err := strconv.Atoi(strings.TrimPrefix(name, file+"."))
+		if strings.HasPrefix(name, file+".") && err == nil {
+			found = append(found, static{index, address})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].index < found[j].index })
+	var values []string
+	for _, s := range found {
+		values = append(values, fmt.Sprintf("[%d]=%d", s.index, d.CPU.RAM[s.address]))
+	}
+	return strings.Join(values, " ")
+}
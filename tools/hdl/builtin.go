@@ -0,0 +1,324 @@
+package hdl
+
+import "fmt"
+
+/*
+ * builtin is a chip implemented in Go rather than in HDL. eval computes the
+ * outputs from the current inputs and state. As in the nand2tetris hardware
+ * simulator, clocked chips change state on tick but show it at their outputs
+ * only after tock, so a script reading PC[] between the two sees the new value.
+ */
+type builtin interface {
+	eval(values []bool)
+	tick(values []bool)
+	tock(values []bool)
+}
+
+/*
+ * memory is implemented by builtins whose state a test script can read and
+ * write as Name[] (registers) or Name[address] (memories).
+ */
+type memory interface {
+	size() int
+	read(address int) int
+	write(address, value int)
+}
+
+/*
+ * builtinChips are the interfaces of the builtin chips, as declared by the HDL
+ * stubs shipped with the nand2tetris tools.
+ */
+var builtinChips = map[string]*Chip{}
+
+/*
+ * newBuiltin creates the implementation of a builtin chip with its pins bound
+ * to the given nodes.
+ */
+var newBuiltin = map[string]func(pins map[string][]int32) builtin{}
+
+func defineBuiltin(name string, inputs, outputs []Pin, clocked []string, create func(pins map[string][]int32) builtin) {
+	builtinChips[name] = &Chip{
+		Name:    name,
+		File:    name + ".hdl",
+		Inputs:  inputs,
+		Outputs: outputs,
+		Builtin: name,
+		Clocked: clocked,
+	}
+	newBuiltin[name] = create
+}
+
+func init() {
+	register := func(width int) func(pins map[string][]int32) builtin {
+		return func(pins map[string][]int32) builtin {
+			return &registerChip{in: pins["in"], load: pins["load"][0], out: pins["out"], mask: 1<<uint(width) - 1}
+		}
+	}
+	defineBuiltin("Bit", []Pin{{"in", 1}, {"load", 1}}, []Pin{{"out", 1}}, []string{"in", "load"}, register(1))
+	for _, name := range []string{"Register", "ARegister", "DRegister"} {
+		defineBuiltin(name, []Pin{{"in", 16}, {"load", 1}}, []Pin{{"out", 16}}, []string{"in", "load"}, register(16))
+	}
+	defineBuiltin("PC", []Pin{{"in", 16}, {"load", 1}, {"inc", 1}, {"reset", 1}}, []Pin{{"out", 16}},
+		[]string{"in", "load", "inc", "reset"}, func(pins map[string][]int32) builtin {
+			return &pcChip{in: pins["in"], load: pins["load"][0], inc: pins["inc"][0], reset: pins["reset"][0], out: pins["out"]}
+		})
+	for _, ram := range []struct {
+		name  string
+		width int
+	}{{"RAM8", 3}, {"RAM64", 6}, {"RAM512", 9}, {"RAM4K", 12}, {"RAM16K", 14}, {"Screen", 13}} {
+		width := ram.width
+		defineBuiltin(ram.name, []Pin{{"in", 16}, {"load", 1}, {"address", width}}, []Pin{{"out", 16}},
+			[]string{"in", "load"}, func(pins map[string][]int32) builtin {
+				return &ramChip{in: pins["in"], load: pins["load"][0], address: pins["address"], out: pins["out"], words: make([]uint16, 1<<uint(width))}
+			})
+	}
+	defineBuiltin("ROM32K", []Pin{{"address", 15}}, []Pin{{"out", 16}}, nil, func(pins map[string][]int32) builtin {
+		return &ramChip{address: pins["address"], out: pins["out"], words: make([]uint16, 1<<15), readOnly: true}
+	})
+	defineBuiltin("Keyboard", nil, []Pin{{"out", 16}}, nil, func(pins map[string][]int32) builtin {
+		return &keyboardChip{out: pins["out"]}
+	})
+	defineBuiltin("ALU",
+		[]Pin{{"x", 16}, {"y", 16}, {"zx", 1}, {"nx", 1}, {"zy", 1}, {"ny", 1}, {"f", 1}, {"no", 1}},
+		[]Pin{{"out", 16}, {"zr", 1}, {"ng", 1}}, nil, func(pins map[string][]int32) builtin {
+			return &aluChip{pins: pins}
+		})
+}
+
+/*
+ * Builtins returns the names of the chips that have a builtin implementation,
+ * besides the primitives Nand and DFF.
+ */
+func Builtins() []string {
+	return []string{"Bit", "Register", "ARegister", "DRegister", "PC", "RAM8", "RAM64", "RAM512",
+		"RAM4K", "RAM16K", "ROM32K", "Screen", "Keyboard", "ALU"}
+}
+
+func read(values []bool, nodes []int32) int {
+	value := 0
+	for i, node := range nodes {
+		if values[node] {
+			value |= 1 << uint(i)
+		}
+	}
+	return value
+}
+
+func write(values []bool, nodes []int32, value int) {
+	for i, node := range nodes {
+		values[node] = value>>uint(i)&1 == 1
+	}
+}
+
+/*
+ * registerChip implements Bit, Register, ARegister and DRegister.
+ */
+type registerChip struct {
+	in    []int32
+	load  int32
+	out   []int32
+	mask  int
+	value int
+	shown int
+}
+
+func (r *registerChip) eval(values []bool) { write(values, r.out, r.shown) }
+
+func (r *registerChip) tick(values []bool) {
+	if values[r.load] {
+		r.value = read(values, r.in) & r.mask
+	}
+}
+
+func (r *registerChip) tock(values []bool) { r.shown = r.value }
+
+func (r *registerChip) size() int                { return 1 }
+func (r *registerChip) read(address int) int     { return signed(r.value, len(r.out)) }
+func (r *registerChip) write(address, value int) { r.value, r.shown = value&r.mask, value&r.mask }
+
+type pcChip struct {
+	in               []int32
+	load, inc, reset int32
+	out              []int32
+	value, shown     int
+}
+
+func (p *pcChip) eval(values []bool) { write(values, p.out, p.shown) }
+
+func (p *pcChip) tick(values []bool) {
+	switch {
+	case values[p.reset]:
+		p.value = 0
+	case values[p.load]:
+		p.value = read(values, p.in)
+	case values[p.inc]:
+		p.value = (p.value + 1) & 0xffff
+	}
+}
+
+func (p *pcChip) tock(values []bool) { p.shown = p.value }
+
+func (p *pcChip) size() int                { return 1 }
+func (p *pcChip) read(address int) int     { return signed(p.value, 16) }
+func (p *pcChip) write(address, value int) { p.value, p.shown = value&0xffff, value&0xffff }
+
+/*
+ * ramChip implements the RAMs, Screen and ROM32K. A write happens on tick; the
+ * word at address is output combinationally, so it shows after the next eval.
+ */
+type ramChip struct {
+	in       []int32
+	load     int32
+	address  []int32
+	out      []int32
+	words    []uint16
+	readOnly bool
+}
+
+func (r *ramChip) eval(values []bool) {
+	write(values, r.out, int(r.words[read(values, r.address)]))
+}
+
+func (r *ramChip) tick(values []bool) {
+	if !r.readOnly && values[r.load] {
+		r.words[read(values, r.address)] = uint16(read(values, r.in))
+	}
+}
+
+func (r *ramChip) tock([]bool) {}
+
+func (r *ramChip) size() int                { return len(r.words) }
+func (r *ramChip) read(address int) int     { return int(int16(r.words[address])) }
+func (r *ramChip) write(address, value int) { r.words[address] = uint16(value) }
+
+/*
+ * keyboardChip outputs the code of the key currently held down, set by the
+ * script as Keyboard[].
+ */
+type keyboardChip struct {
+	out []int32
+	key int
+}
+
+func (k *keyboardChip) eval(values []bool) { write(values, k.out, k.key) }
+func (k *keyboardChip) tick([]bool)        {}
+func (k *keyboardChip) tock([]bool)        {}
+
+func (k *keyboardChip) size() int                { return 1 }
+func (k *keyboardChip) read(address int) int     { return k.key }
+func (k *keyboardChip) write(address, value int) { k.key = value & 0xffff }
+
+type aluChip struct {
+	pins map[string][]int32
+}
+
+func (a *aluChip) eval(values []bool) {
+	bit := func(name string) bool { return values[a.pins[name][0]] }
+	x, y := read(values, a.pins["x"]), read(values, a.pins["y"])
+	out := alu(x, y, bit("zx"), bit("nx"), bit("zy"), bit("ny"), bit("f"), bit("no"))
+	write(values, a.pins["out"], out)
+	values[a.pins["zr"][0]] = out == 0
+	values[a.pins["ng"][0]] = out&0x8000 != 0
+}
+
+/*
+ * alu computes the 16-bit output of the Hack ALU for the given control bits.
+ */
+func alu(x, y int, zx, nx, zy, ny, f, no bool) int {
+	if zx {
+		x = 0
+	}
+	if nx {
+		x = ^x
+	}
+	if zy {
+		y = 0
+	}
+	if ny {
+		y = ^y
+	}
+	out := x & y
+	if f {
+		out = x + y
+	}
+	if no {
+		out = ^out
+	}
+	return out & 0xffff
+}
+
+func (a *aluChip) tick([]bool) {}
+func (a *aluChip) tock([]bool) {}
+
+/*
+ * signed interprets a 16-bit value as two's complement.
+ */
+func signed(value, width int) int {
+	if width == 16 {
+		return int(int16(value))
+	}
+	return value
+}
+
+/*
+ * builtinPart is a builtin chip placed in a circuit; its pins are bound when
+ * the netlist has been resolved.
+ */
+type builtinPart struct {
+	chip   *Chip
+	pins   map[string][]int32
+	impl   builtin
+	inputs []int32
+}
+
+/*
+ * combinationalInputs are the input nodes the part's outputs depend on without
+ * a clock edge in between.
+ */
+func (p *builtinPart) combinationalInputs() []int32 {
+	clocked := map[string]bool{}
+	for _, name := range p.chip.Clocked {
+		clocked[name] = true
+	}
+	var nodes []int32
+	for _, pin := range p.chip.Inputs {
+		if !clocked[pin.Name] {
+			nodes = append(nodes, p.pins[pin.Name]...)
+		}
+	}
+	return nodes
+}
+
+func (p *builtinPart) instantiate() {
+	p.impl = newBuiltin[p.chip.Name](p.pins)
+	p.inputs = p.combinationalInputs()
+}
+
+/*
+ * checkBuiltin verifies that a chip declared BUILTIN has the interface of the
+ * builtin it names, and returns that builtin's definition.
+ */
+func checkBuiltin(chip *Chip) (*Chip, error) {
+	def, ok := builtinChips[chip.Builtin]
+	if !ok {
+		return nil, fmt.Errorf("unknown builtin chip %s", chip.Builtin)
+	}
+	if chip == def {
+		return def, nil
+	}
+	same := func(a, b []Pin) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if !same(chip.Inputs, def.Inputs) || !same(chip.Outputs, def.Outputs) {
+		return nil, fmt.Errorf("chip %s does not have the pins of builtin chip %s", chip.Name, def.Name)
+	}
+	return def, nil
+}
@@ -0,0 +1,651 @@
+package hdl
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * Simulation is what Check drives: a circuit, or a behavioral model of a chip.
+ */
+type Simulation interface {
+	Set(name string, value int) error
+	Get(name string) (int, error)
+	Eval()
+	Tick()
+	Tock()
+	Reset()
+}
+
+/*
+ * exhaustiveBits is the largest number of input bits of a combinational chip
+ * for which Check tries every input vector rather than random ones.
+ */
+const exhaustiveBits = 20
+
+/*
+ * cycles is the length of each random input sequence a clocked chip is run
+ * for, starting from reset.
+ */
+const cycles = 64
+
+/*
+ * CheckResult is the outcome of checking a chip against its reference: the
+ * number of input vectors (clock cycles for clocked chips) tried, whether that
+ * was all of them, and the first mismatch, if any. Only an exhaustive check
+ * without a mismatch proves the chip equivalent to its reference; random
+ * vectors can miss inputs on which the two differ.
+ */
+type CheckResult struct {
+	Vectors    int
+	Exhaustive bool
+	Mismatch   *Mismatch
+}
+
+/*
+ * Mismatch is a counterexample: the inputs applied to the chip, one vector per
+ * clock cycle for a clocked chip, after which output Output was Got rather than
+ * Want. Clocked tells whether the outputs differed after the clock edge of the
+ * last cycle rather than before it.
+ */
+type Mismatch struct {
+	Chip    *Chip
+	Inputs  [][]int
+	Output  string
+	Got     int
+	Want    int
+	Clocked bool
+}
+
+func (m *Mismatch) String() string {
+	var b strings.Builder
+	vector := func(values []int) string {
+		var assignments []string
+		for i, pin := range m.Chip.Inputs {
+			assignments = append(assignments, fmt.Sprintf("%s=%s", pin.Name, format(values[i], pin.Width)))
+		}
+		return strings.Join(assignments, ", ")
+	}
+	width := 1
+	if pin, ok := findPin(m.Chip.Outputs, m.Output); ok {
+		width = pin.Width
+	}
+	result := fmt.Sprintf("%s is %s, expected %s", m.Output, format(m.Got, width), format(m.Want, width))
+	if len(m.Chip.Clocked) == 0 {
+		return vector(m.Inputs[0]) + ": " + result
+	}
+	for i, values := range m.Inputs {
+		fmt.Fprintf(&b, "cycle %d: %s", i, vector(values))
+		if i < len(m.Inputs)-1 {
+			b.WriteString("\n")
+		}
+	}
+	if m.Clocked {
+		result += " after the clock"
+	} else {
+		result += " before the clock"
+	}
+	return b.String() + ": " + result
+}
+
+/*
+ * format writes single bits as 0 or 1, buses in binary and 16-bit words also
+ * as a signed number.
+ */
+func format(value, width int) string {
+	if width == 1 {
+		return fmt.Sprint(value & 1)
+	}
+	bits := fmt.Sprintf("%0*b", width, value&(1<<uint(width)-1))
+	if width == 16 {
+		return fmt.Sprintf("%s (%d)", bits, int(int16(value)))
+	}
+	return bits
+}
+
+/*
+ * Reference returns a behavioral model of the named chip to check an HDL
+ * implementation against, and the chip's interface. The gates of projects 1
+ * and 2 are modeled in Go, the ALU and the chips of project 3 by their
+ * builtins and the CPU by an emulation of the Hack instruction set.
+ */
+func Reference(name string) (Simulation, *Chip, error) {
+	if m, ok := models[name]; ok {
+		model := *m
+		model.Reset()
+		return &model, model.chip, nil
+	}
+	if name == "CPU" {
+		model := &cpuModel{}
+		return model, cpuChip, nil
+	}
+	def, ok := builtinChips[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("there is no reference model of chip %s", name)
+	}
+	circuit, err := NewLoader().Build(def, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return circuit, def, nil
+}
+
+/*
+ * Check loads the chip in file and compares it with its reference model. A
+ * combinational chip with few enough input bits is tried on every input vector,
+ * otherwise on the given number of random ones; a clocked chip is run through
+ * random input sequences from reset. Random values favor 0, -1 and the other
+ * corners of a bus and repeat a few values per sequence, so that, for example,
+ * a RAM reads back addresses it has written. There is no solver behind the
+ * random checks: passing them makes equivalence likely, not certain.
+ */
+func (l *Loader) Check(file string, vectors int, seed int64) (*CheckResult, error) {
+	chip, err := l.ParseFile(file)
+	if err != nil {
+		return nil, err
+	}
+	reference, def, err := Reference(chip.Name)
+	if err != nil {
+		return nil, &Error{file, 1, err.Error()}
+	}
+	if !samePins(chip.Inputs, def.Inputs) || !samePins(chip.Outputs, def.Outputs) {
+		return nil, &Error{file, 1, fmt.Sprintf("chip %s does not have the pins of its reference model", chip.Name)}
+	}
+	circuit, err := l.Build(chip, filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+	return Check(circuit, reference, def, vectors, seed)
+}
+
+/*
+ * samePins compares two pin lists regardless of their order.
+ */
+func samePins(a, b []Pin) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, pin := range a {
+		if other, ok := findPin(b, pin.Name); !ok || other != pin {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * Check drives chip and reference with the same inputs, see Loader.Check, and
+ * compares their outputs after every change. Outputs a reference leaves
+ * unspecified for the current inputs, such as outM of the CPU when it does not
+ * write, are not compared.
+ */
+func Check(chip, reference Simulation, def *Chip, vectors int, seed int64) (*CheckResult, error) {
+	bits := 0
+	for _, pin := range def.Inputs {
+		bits += pin.Width
+	}
+	var inputs [][]int
+	apply := func(values []int) error {
+		inputs = append(inputs, values)
+		for i, pin := range def.Inputs {
+			if err := chip.Set(pin.Name, values[i]); err != nil {
+				return err
+			}
+			if err := reference.Set(pin.Name, values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	compare := func(clocked bool) (*Mismatch, error) {
+		for _, pin := range def.Outputs {
+			if p, ok := reference.(Partial); ok && !p.Specified(pin.Name) {
+				continue
+			}
+			got, err := chip.Get(pin.Name)
+			if err != nil {
+				return nil, err
+			}
+			want, err := reference.Get(pin.Name)
+			if err != nil {
+				return nil, err
+			}
+			if got != want {
+				return &Mismatch{def, inputs, pin.Name, got, want, clocked}, nil
+			}
+		}
+		return nil, nil
+	}
+	result := &CheckResult{}
+
+	if len(def.Clocked) == 0 {
+		random := newVectors(def, seed, false)
+		exhaustive := bits <= exhaustiveBits
+		if exhaustive {
+			vectors = 1 << uint(bits)
+		}
+		result.Exhaustive = exhaustive
+		for v := 0; v < vectors; v++ {
+			inputs = nil
+			var values []int
+			if exhaustive {
+				values = split(def.Inputs, v)
+			} else {
+				values = random.next()
+			}
+			if err := apply(values); err != nil {
+				return nil, err
+			}
+			chip.Eval()
+			reference.Eval()
+			result.Vectors++
+			mismatch, err := compare(false)
+			if mismatch != nil || err != nil {
+				result.Mismatch = mismatch
+				return result, err
+			}
+		}
+		return result, nil
+	}
+
+	random := newVectors(def, seed, true)
+	for result.Vectors < vectors {
+		chip.Reset()
+		reference.Reset()
+		inputs = nil
+		random.shuffle()
+		for cycle := 0; cycle < cycles && result.Vectors < vectors; cycle++ {
+			if err := apply(random.next()); err != nil {
+				return nil, err
+			}
+			result.Vectors++
+			chip.Eval()
+			reference.Eval()
+			if mismatch, err := compare(false); mismatch != nil || err != nil {
+				result.Mismatch = mismatch
+				return result, err
+			}
+			chip.Tick()
+			chip.Tock()
+			reference.Tick()
+			reference.Tock()
+			if mismatch, err := compare(true); mismatch != nil || err != nil {
+				result.Mismatch = mismatch
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+/*
+ * Vectors returns n input vectors for chip, one per clock cycle if it is
+ * clocked: every possible one, in counting order, if there are no more than
+ * n, otherwise random ones chosen as by Check.
+ */
+func Vectors(chip *Chip, n int, seed int64) [][]int {
+	bits := 0
+	for _, pin := range chip.Inputs {
+		bits += pin.Width
+	}
+	var vectors [][]int
+	if len(chip.Clocked) == 0 && bits < 31 && 1<<uint(bits) <= n {
+		for v := 0; v < 1<<uint(bits); v++ {
+			vectors = append(vectors, split(chip.Inputs, v))
+		}
+		return vectors
+	}
+	random := newVectors(chip, seed, len(chip.Clocked) > 0)
+	for len(vectors) < n {
+		vectors = append(vectors, random.next())
+	}
+	return vectors
+}
+
+/*
+ * split spreads the bits of v over the input pins, the first pin getting the
+ * lowest bits.
+ */
+func split(pins []Pin, v int) []int {
+	values := make([]int, len(pins))
+	for i, pin := range pins {
+		values[i] = v & (1<<uint(pin.Width) - 1)
+		v >>= uint(pin.Width)
+	}
+	return values
+}
+
+/*
+ * vectors generates random input vectors for a chip. Each bus takes a corner
+ * value (0, 1, all ones and for 16 bits the extremes of the signed range) a
+ * quarter of the time and one of a few values kept per sequence another
+ * quarter. Control bits of clocked chips are set a quarter of the time, so that
+ * a register holds its value now and then and a PC gets to count.
+ */
+type vectors struct {
+	pins    []Pin
+	rng     *rand.Rand
+	clocked bool
+	pool    [][]int
+}
+
+func newVectors(def *Chip, seed int64, clocked bool) *vectors {
+	v := &vectors{pins: def.Inputs, rng: rand.New(rand.NewSource(seed)), clocked: clocked}
+	v.shuffle()
+	return v
+}
+
+/*
+ * shuffle picks new values to repeat, for the next sequence.
+ */
+func (v *vectors) shuffle() {
+	v.pool = make([][]int, len(v.pins))
+	for i, pin := range v.pins {
+		for j := 0; j < 4; j++ {
+			v.pool[i] = append(v.pool[i], v.rng.Intn(1<<uint(pin.Width)))
+		}
+	}
+}
+
+func (v *vectors) next() []int {
+	values := make([]int, len(v.pins))
+	for i, pin := range v.pins {
+		mask := 1<<uint(pin.Width) - 1
+		switch choice := v.rng.Intn(4); {
+		case pin.Width == 1 && v.clocked:
+			if choice == 0 {
+				values[i] = 1
+			}
+		case pin.Width == 1:
+			values[i] = v.rng.Intn(2)
+		case choice == 0:
+			corners := []int{0, 1, mask}
+			if pin.Width == 16 {
+				corners = append(corners, 0x7fff, 0x8000)
+			}
+			values[i] = corners[v.rng.Intn(len(corners))]
+		case choice == 1:
+			values[i] = v.pool[i][v.rng.Intn(len(v.pool[i]))]
+		default:
+			values[i] = v.rng.Intn(mask + 1)
+		}
+	}
+	return values
+}
+
+/*
+ * Partial is implemented by references that specify some outputs only for
+ * some inputs.
+ */
+type Partial interface {
+	Specified(output string) bool
+}
+
+/*
+ * model is a behavioral model of a combinational chip: eval computes its
+ * outputs from its inputs, in any width; they are cut to the pins' widths.
+ */
+type model struct {
+	chip    *Chip
+	eval    func(in map[string]int) map[string]int
+	inputs  map[string]int
+	outputs map[string]int
+}
+
+/*
+ * models are the gates of projects 1 and 2 that have no builtin.
+ */
+var models = map[string]*model{}
+
+func defineModel(name string, inputs, outputs []Pin, eval func(in map[string]int) map[string]int) {
+	models[name] = &model{chip: &Chip{Name: name, File: name + ".hdl", Inputs: inputs, Outputs: outputs}, eval: eval}
+}
+
+/*
+ * NewModel turns a Go function computing the outputs of a combinational chip
+ * from its inputs into a Simulation of the chip. Inputs and outputs are keyed
+ * by pin name and hold unsigned values; outputs are cut to the pins' widths.
+ */
+func NewModel(chip *Chip, eval func(in map[string]int) map[string]int) Simulation {
+	m := &model{chip: chip, eval: eval}
+	m.Reset()
+	return m
+}
+
+/*
+ * pins declares pins of the same width.
+ */
+func pins(width int, names ...string) []Pin {
+	var list []Pin
+	for _, name := range names {
+		list = append(list, Pin{name, width})
+	}
+	return list
+}
+
+func (m *model) Set(name string, value int) error {
+	pin, ok := findPin(m.chip.Inputs, name)
+	if !ok {
+		return fmt.Errorf("%s is not an input pin of %s", name, m.chip.Name)
+	}
+	m.inputs[name] = value & (1<<uint(pin.Width) - 1)
+	return nil
+}
+
+func (m *model) Get(name string) (int, error) {
+	if pin, ok := findPin(m.chip.Inputs, name); ok {
+		return signed(m.inputs[name], pin.Width), nil
+	}
+	pin, ok := findPin(m.chip.Outputs, name)
+	if !ok {
+		return 0, fmt.Errorf("%s has no pin %s", m.chip.Name, name)
+	}
+	return signed(m.outputs[name]&(1<<uint(pin.Width)-1), pin.Width), nil
+}
+
+func (m *model) Eval() { m.outputs = m.eval(m.inputs) }
+func (m *model) Tick() { m.Eval() }
+func (m *model) Tock() { m.Eval() }
+
+func (m *model) Reset() {
+	m.inputs = map[string]int{}
+	m.Eval()
+}
+
+func init() {
+	bit := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	// selected is the output named by sel among outputs, for the DMux chips
+	selected := func(outputs []string, in map[string]int) map[string]int {
+		out := map[string]int{}
+		for _, name := range outputs {
+			out[name] = 0
+		}
+		out[outputs[in["sel"]]] = in["in"]
+		return out
+	}
+	// chosen is the input named by sel among inputs, for the Mux chips
+	chosen := func(inputs []string) func(in map[string]int) map[string]int {
+		return func(in map[string]int) map[string]int {
+			return map[string]int{"out": in[inputs[in["sel"]]]}
+		}
+	}
+
+	for _, width := range []int{1, 16} {
+		suffix := ""
+		if width == 16 {
+			suffix = "16"
+		}
+		defineModel("Not"+suffix, pins(width, "in"), pins(width, "out"), func(in map[string]int) map[string]int {
+			return map[string]int{"out": ^in["in"]}
+		})
+		defineModel("And"+suffix, pins(width, "a", "b"), pins(width, "out"), func(in map[string]int) map[string]int {
+			return map[string]int{"out": in["a"] & in["b"]}
+		})
+		defineModel("Or"+suffix, pins(width, "a", "b"), pins(width, "out"), func(in map[string]int) map[string]int {
+			return map[string]int{"out": in["a"] | in["b"]}
+		})
+		defineModel("Mux"+suffix, append(pins(width, "a", "b"), Pin{"sel", 1}), pins(width, "out"), chosen([]string{"a", "b"}))
+	}
+	defineModel("Xor", pins(1, "a", "b"), pins(1, "out"), func(in map[string]int) map[string]int {
+		return map[string]int{"out": in["a"] ^ in["b"]}
+	})
+	defineModel("Or8Way", pins(8, "in"), pins(1, "out"), func(in map[string]int) map[string]int {
+		return map[string]int{"out": bit(in["in"] != 0)}
+	})
+	defineModel("Or16Way", pins(16, "in"), pins(1, "out"), func(in map[string]int) map[string]int {
+		return map[string]int{"out": bit(in["in"] != 0)}
+	})
+	defineModel("Mux4Way16", append(pins(16, "a", "b", "c", "d"), Pin{"sel", 2}), pins(16, "out"),
+		chosen([]string{"a", "b", "c", "d"}))
+	defineModel("Mux8Way16", append(pins(16, "a", "b", "c", "d", "e", "f", "g", "h"), Pin{"sel", 3}), pins(16, "out"),
+		chosen([]string{"a", "b", "c", "d", "e", "f", "g", "h"}))
+	for _, dmux := range []struct {
+		name    string
+		sel     int
+		outputs []string
+	}{
+		{"DMux", 1, []string{"a", "b"}},
+		{"DMux4Way", 2, []string{"a", "b", "c", "d"}},
+		{"DMux8Way", 3, []string{"a", "b", "c", "d", "e", "f", "g", "h"}},
+	} {
+		outputs := dmux.outputs
+		defineModel(dmux.name, []Pin{{"in", 1}, {"sel", dmux.sel}}, pins(1, outputs...), func(in map[string]int) map[string]int {
+			return selected(outputs, in)
+		})
+	}
+	defineModel("HalfAdder", pins(1, "a", "b"), pins(1, "sum", "carry"), func(in map[string]int) map[string]int {
+		sum := in["a"] + in["b"]
+		return map[string]int{"sum": sum, "carry": sum >> 1}
+	})
+	defineModel("FullAdder", pins(1, "a", "b", "c"), pins(1, "sum", "carry"), func(in map[string]int) map[string]int {
+		sum := in["a"] + in["b"] + in["c"]
+		return map[string]int{"sum": sum, "carry": sum >> 1}
+	})
+	defineModel("Add16", pins(16, "a", "b"), pins(16, "out"), func(in map[string]int) map[string]int {
+		return map[string]int{"out": in["a"] + in["b"]}
+	})
+	defineModel("Inc16", pins(16, "in"), pins(16, "out"), func(in map[string]int) map[string]int {
+		return map[string]int{"out": in["in"] + 1}
+	})
+}
+
+/*
+ * cpuChip is the interface of the Hack CPU of project 5.
+ */
+var cpuChip = &Chip{
+	Name:    "CPU",
+	File:    "CPU.hdl",
+	Inputs:  []Pin{{"inM", 16}, {"instruction", 16}, {"reset", 1}},
+	Outputs: []Pin{{"outM", 16}, {"writeM", 1}, {"addressM", 15}, {"pc", 15}},
+	Clocked: []string{"reset"},
+}
+
+/*
+ * cpuModel executes Hack instructions as the CPU chip does: outM and writeM
+ * follow the instruction combinationally, while A, D and PC change on the clock
+ * and show after tock. outM is only specified while writeM is set.
+ */
+type cpuModel struct {
+	inM, instruction, reset int
+	a, d, pc                int
+	nextA, nextD, nextPC    int
+	outM                    int
+	writeM                  bool
+}
+
+func (c *cpuModel) Set(name string, value int) error {
+	switch name {
+	case "inM":
+		c.inM = value & 0xffff
+	case "instruction":
+		c.instruction = value & 0xffff
+	case "reset":
+		c.reset = value & 1
+	default:
+		return fmt.Errorf("%s is not an input pin of CPU", name)
+	}
+	return nil
+}
+
+func (c *cpuModel) Get(name string) (int, error) {
+	switch name {
+	case "inM":
+		return signed(c.inM, 16), nil
+	case "instruction":
+		return signed(c.instruction, 16), nil
+	case "reset":
+		return c.reset, nil
+	case "outM":
+		return signed(c.outM, 16), nil
+	case "writeM":
+		if c.writeM {
+			return 1, nil
+		}
+		return 0, nil
+	case "addressM":
+		return c.a & 0x7fff, nil
+	case "pc":
+		return c.pc & 0x7fff, nil
+	}
+	return 0, fmt.Errorf("CPU has no pin %s", name)
+}
+
+func (c *cpuModel) Specified(output string) bool {
+	return output != "outM" || c.writeM
+}
+
+func (c *cpuModel) Eval() {
+	i := c.instruction
+	bit := func(n uint) bool { return i>>n&1 == 1 }
+	computing := bit(15)
+	y := c.a
+	if bit(12) {
+		y = c.inM
+	}
+	c.outM = alu(c.d, y, bit(11), bit(10), bit(9), bit(8), bit(7), bit(6))
+	c.writeM = computing && bit(3)
+}
+
+func (c *cpuModel) Tick() {
+	c.Eval()
+	i := c.instruction
+	bit := func(n uint) bool { return i>>n&1 == 1 }
+	computing := bit(15)
+	c.nextA, c.nextD = c.a, c.d
+	switch {
+	case !computing:
+		c.nextA = i
+	case bit(5):
+		c.nextA = c.outM
+	}
+	if computing && bit(4) {
+		c.nextD = c.outM
+	}
+	negative, zero := c.outM&0x8000 != 0, c.outM == 0
+	jump := computing && (bit(2) && negative || bit(1) && zero || bit(0) && !negative && !zero)
+	switch {
+	case c.reset == 1:
+		c.nextPC = 0
+	case jump:
+		c.nextPC = c.a
+	default:
+		c.nextPC = (c.pc + 1) & 0xffff
+	}
+}
+
+func (c *cpuModel) Tock() {
+	c.a, c.d, c.pc = c.nextA, c.nextD, c.nextPC
+	c.Eval()
+}
+
+func (c *cpuModel) Reset() {
+	*c = cpuModel{}
+	c.Eval()
+}
@@ -0,0 +1,78 @@
+package hdl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * TestCheckFindsMismatch checks an Xor built from a single Nand, which
+ * differs from Xor only when both inputs are 0, and expects the exhaustive
+ * check to report that vector as the counterexample.
+ */
+func TestCheckFindsMismatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "Xor.hdl")
+	source := `CHIP Xor {
+    IN a, b;
+    OUT out;
+    PARTS:
+    Nand(a=a, b=b, out=out);
+}
+`
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewLoader().Check(file, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Exhaustive {
+		t.Errorf("Xor with 2 input bits was checked on random vectors")
+	}
+	if result.Mismatch == nil {
+		t.Fatalf("Nand passed as Xor after %d vectors", result.Vectors)
+	}
+	if got, want := result.Mismatch.String(), "a=0, b=0: out is 1, expected 0"; got != want {
+		t.Errorf("counterexample is %q, want %q", got, want)
+	}
+}
+
+/*
+ * TestCheckRandom checks an adder that drops its carries against Add16. With
+ * 32 input bits the check is random, and the first few vectors should give
+ * the adder away.
+ */
+func TestCheckRandom(t *testing.T) {
+	reference, def, err := Reference("Add16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	carryless := NewModel(def, func(in map[string]int) map[string]int {
+		return map[string]int{"out": in["a"] ^ in["b"]}
+	})
+	result, err := Check(carryless, reference, def, 1000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Exhaustive {
+		t.Errorf("Add16 with 32 input bits was checked exhaustively")
+	}
+	if result.Mismatch == nil {
+		t.Fatalf("a carryless adder passed as Add16 after %d vectors", result.Vectors)
+	}
+
+	// a correct adder passes every vector, which proves nothing
+	adder := NewModel(def, func(in map[string]int) map[string]int {
+		return map[string]int{"out": in["a"] + in["b"]}
+	})
+	reference.Reset()
+	result, err = Check(adder, reference, def, 1000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mismatch != nil || result.Vectors != 1000 || result.Exhaustive {
+		t.Errorf("Add16 against itself: %d vectors, exhaustive %v, mismatch %v",
+			result.Vectors, result.Exhaustive, result.Mismatch)
+	}
+}
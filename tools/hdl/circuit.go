@@ -0,0 +1,777 @@
+package hdl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Nand and DFF are the primitives every HDL chip is ultimately built from.
+ */
+var primitives = map[string]*Chip{
+	"Nand": {
+		Name:    "Nand",
+		Inputs:  []Pin{{"a", 1}, {"b", 1}},
+		Outputs: []Pin{{"out", 1}},
+		Builtin: "Nand",
+	},
+	"DFF": {
+		Name:    "DFF",
+		Inputs:  []Pin{{"in", 1}},
+		Outputs: []Pin{{"out", 1}},
+		Builtin: "DFF",
+		Clocked: []string{"in"},
+	},
+}
+
+/*
+ * Loader finds and parses the chips a circuit is built from. A part named X is
+ * looked up as X.hdl in the directory of the chip being loaded, then in each
+ * directory of Path; if there is no X.hdl, the builtin chip X is used.
+ *
+ * Builtin switches individual chips: true simulates the part with its builtin
+ * implementation even where X.hdl exists, false insists on the HDL. Scopes
+ * keeps the signals of every HDL part in Circuit.Scope, for tracing.
+ */
+type Loader struct {
+	Path    []string
+	Builtin map[string]bool
+	Scopes  bool
+	files   map[string]*Chip
+	found   map[[2]string]*Chip
+}
+
+func NewLoader(path ...string) *Loader {
+	return &Loader{Path: path, files: map[string]*Chip{}, found: map[[2]string]*Chip{}}
+}
+
+/*
+ * ParseFile parses the chip in the named .hdl file, caching the result.
+ */
+func (l *Loader) ParseFile(name string) (*Chip, error) {
+	if chip, ok := l.files[name]; ok {
+		return chip, nil
+	}
+	source, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	chip, err := Parse(name, string(source))
+	if err != nil {
+		return nil, err
+	}
+	if want := filepath.Base(name); chip.Name+".hdl" != want {
+		return nil, &Error{name, 1, fmt.Sprintf("chip %s must be defined in %s.hdl", chip.Name, chip.Name)}
+	}
+	l.files[name] = chip
+	return chip, nil
+}
+
+/*
+ * find returns the definition of the named chip, searching dir before Path.
+ */
+func (l *Loader) find(name, dir string) (*Chip, error) {
+	if chip, ok := primitives[name]; ok {
+		return chip, nil
+	}
+	useBuiltin, switched := l.Builtin[name]
+	if chip, ok := builtinChips[name]; ok && useBuiltin {
+		return chip, nil
+	} else if useBuiltin {
+		return nil, fmt.Errorf("there is no builtin chip %s", name)
+	}
+	if chip, ok := l.found[[2]string{dir, name}]; ok {
+		return chip, nil
+	}
+	for _, d := range append([]string{dir}, l.Path...) {
+		file := filepath.Join(d, name+".hdl")
+		if _, err := os.Stat(file); err == nil {
+			chip, err := l.ParseFile(file)
+			if err == nil {
+				l.found[[2]string{dir, name}] = chip
+			}
+			return chip, err
+		}
+	}
+	if chip, ok := builtinChips[name]; ok && !switched {
+		return chip, nil
+	}
+	return nil, fmt.Errorf("chip %s not found", name)
+}
+
+/*
+ * Load parses the named .hdl file and builds its circuit.
+ */
+func (l *Loader) Load(file string) (*Circuit, error) {
+	chip, err := l.ParseFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return l.Build(chip, filepath.Dir(file))
+}
+
+type nand struct {
+	a, b, out int32
+}
+
+type dff struct {
+	in, out int32
+	state   bool
+}
+
+/*
+ * Circuit is a chip flattened into a netlist of Nand gates, DFFs and builtin
+ * chips over single-bit nodes. Nodes 0 and 1 hold the constants false and true.
+ */
+type Circuit struct {
+	Chip   *Chip
+	pins   map[string][]int32
+	inputs map[string]bool
+	values []bool
+	nands  []nand
+	dffs   []dff
+	parts  []*builtinPart
+	steps  []step
+	// breakdown counts what each part of the chip was flattened into
+	breakdown []PartStats
+	scope     *Scope
+}
+
+/*
+ * step is one stage of Eval: a run of Nand gates or a builtin part.
+ */
+type step struct {
+	part   builtin
+	lo, hi int
+}
+
+const (
+	falseNode int32 = 0
+	trueNode  int32 = 1
+)
+
+/*
+ * builder elaborates a chip and its parts recursively into one netlist. Parts
+ * are connected by merging the node of a part's output with the node of the
+ * signal it drives.
+ */
+type builder struct {
+	loader    *Loader
+	parent    []int32
+	driven    []bool
+	nands     []nand
+	dffs      []dff
+	parts     []*builtinPart
+	stack     []string
+	breakdown []PartStats
+	scope     *Scope
+}
+
+type buildError struct {
+	err error
+}
+
+/*
+ * Build flattens chip, whose parts are looked up in dir and then in the
+ * loader's Path, into a circuit.
+ */
+func (l *Loader) Build(chip *Chip, dir string) (circuit *Circuit, err error) {
+	b := &builder{loader: l}
+	b.node(true)
+	b.node(true)
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(buildError)
+			if !ok {
+				panic(r)
+			}
+			circuit, err = nil, e.err
+		}
+	}()
+
+	inputs := map[string][]int32{}
+	for _, pin := range chip.Inputs {
+		inputs[pin.Name] = b.nodes(pin.Width, true)
+	}
+	root := &Scope{Name: chip.Name, Chip: chip}
+	b.scope = root
+	signals := b.elaborate(chip, dir, inputs)
+	root.setSignals(signals)
+	root.resolve(b.find)
+
+	circuit = &Circuit{Chip: chip, pins: map[string][]int32{}, inputs: map[string]bool{}, breakdown: b.breakdown, scope: root}
+	for name, nodes := range signals {
+		resolved := make([]int32, len(nodes))
+		for i, node := range nodes {
+			resolved[i] = b.find(node)
+		}
+		circuit.pins[name] = resolved
+	}
+	for _, pin := range chip.Inputs {
+		circuit.inputs[pin.Name] = true
+	}
+	for _, g := range b.nands {
+		circuit.nands = append(circuit.nands, nand{b.find(g.a), b.find(g.b), b.find(g.out)})
+	}
+	for _, d := range b.dffs {
+		circuit.dffs = append(circuit.dffs, dff{in: b.find(d.in), out: b.find(d.out)})
+	}
+	for _, part := range b.parts {
+		for name, nodes := range part.pins {
+			for i, node := range nodes {
+				nodes[i] = b.find(node)
+			}
+			part.pins[name] = nodes
+		}
+		part.instantiate()
+		circuit.parts = append(circuit.parts, part)
+	}
+	if err := circuit.sort(len(b.parent)); err != nil {
+		return nil, &Error{chip.File, 1, err.Error()}
+	}
+	circuit.values = make([]bool, len(b.parent))
+	circuit.values[trueNode] = true
+	circuit.Eval()
+	return circuit, nil
+}
+
+func (b *builder) node(driven bool) int32 {
+	n := int32(len(b.parent))
+	b.parent = append(b.parent, n)
+	b.driven = append(b.driven, driven)
+	return n
+}
+
+func (b *builder) nodes(width int, driven bool) []int32 {
+	nodes := make([]int32, width)
+	for i := range nodes {
+		nodes[i] = b.node(driven)
+	}
+	return nodes
+}
+
+func (b *builder) find(n int32) int32 {
+	for b.parent[n] != n {
+		b.parent[n] = b.parent[b.parent[n]]
+		n = b.parent[n]
+	}
+	return n
+}
+
+/*
+ * connect merges the node of a signal with the part output driving it.
+ */
+func (b *builder) connect(signal, output int32) bool {
+	rs, ro := b.find(signal), b.find(output)
+	if rs == ro {
+		return true
+	}
+	if b.driven[rs] && b.driven[ro] {
+		return false
+	}
+	b.parent[rs] = ro
+	b.driven[ro] = b.driven[ro] || b.driven[rs]
+	return true
+}
+
+func (b *builder) fail(chip *Chip, line int, format string, args ...interface{}) {
+	panic(buildError{&Error{chip.File, line, fmt.Sprintf(format, args...)}})
+}
+
+func findPin(pins []Pin, name string) (Pin, bool) {
+	for _, pin := range pins {
+		if pin.Name == name {
+			return pin, true
+		}
+	}
+	return Pin{}, false
+}
+
+/*
+ * span returns the bits of a pin a bus refers to.
+ */
+func span(bus Bus, width int) (lo, hi int, ok bool) {
+	if !bus.Sliced {
+		return 0, width - 1, true
+	}
+	return bus.Lo, bus.Hi, bus.Hi < width
+}
+
+/*
+ * elaborate adds the netlist of chip, with its inputs bound to the given nodes,
+ * and returns the nodes of all its pins and internal signals.
+ */
+func (b *builder) elaborate(chip *Chip, dir string, inputs map[string][]int32) map[string][]int32 {
+	switch chip.Builtin {
+	case "Nand":
+		out := b.node(true)
+		b.nands = append(b.nands, nand{inputs["a"][0], inputs["b"][0], out})
+		return map[string][]int32{"a": inputs["a"], "b": inputs["b"], "out": {out}}
+	case "DFF":
+		out := b.node(true)
+		b.dffs = append(b.dffs, dff{in: inputs["in"][0], out: out})
+		return map[string][]int32{"in": inputs["in"], "out": {out}}
+	case "":
+	default:
+		def, err := checkBuiltin(chip)
+		if err != nil {
+			b.fail(chip, 1, "%v", err)
+		}
+		pins := map[string][]int32{}
+		for name, nodes := range inputs {
+			pins[name] = append([]int32(nil), nodes...)
+		}
+		for _, pin := range def.Outputs {
+			pins[pin.Name] = b.nodes(pin.Width, true)
+		}
+		b.parts = append(b.parts, &builtinPart{chip: def, pins: pins})
+		signals := map[string][]int32{}
+		for name, nodes := range pins {
+			signals[name] = append([]int32(nil), nodes...)
+		}
+		return signals
+	}
+	for _, name := range b.stack {
+		if name == chip.Name {
+			b.fail(chip, 1, "chip %s is built from itself", chip.Name)
+		}
+	}
+	b.stack = append(b.stack, chip.Name)
+	defer func() { b.stack = b.stack[:len(b.stack)-1] }()
+
+	signals := map[string][]int32{}
+	for name, nodes := range inputs {
+		signals[name] = nodes
+	}
+	for _, pin := range chip.Outputs {
+		signals[pin.Name] = b.nodes(pin.Width, false)
+	}
+
+	// find the part definitions and create the internal signals they drive
+	defs := make([]*Chip, len(chip.Parts))
+	for i, part := range chip.Parts {
+		def, err := b.loader.find(part.Name, dir)
+		if err != nil {
+			if _, ok := err.(*Error); ok {
+				panic(buildError{err})
+			}
+			b.fail(chip, part.Line, "%v", err)
+		}
+		defs[i] = def
+		for _, c := range part.Connections {
+			pin, isOutput := findPin(def.Outputs, c.Pin.Name)
+			if !isOutput {
+				if _, isInput := findPin(def.Inputs, c.Pin.Name); !isInput {
+					b.fail(chip, part.Line, "%s has no pin %s", part.Name, c.Pin.Name)
+				}
+				continue
+			}
+			lo, hi, ok := span(c.Pin, pin.Width)
+			if !ok {
+				b.fail(chip, part.Line, "%s: sub bus out of range of %s[%d]", c.Pin, pin.Name, pin.Width)
+			}
+			name := c.Signal.Name
+			switch {
+			case name == "true" || name == "false":
+				b.fail(chip, part.Line, "output %s of %s cannot be connected to %s", c.Pin, part.Name, name)
+			case isInputPin(chip, name):
+				b.fail(chip, part.Line, "input pin %s cannot be driven by %s", name, part.Name)
+			case isOutputPin(chip, name):
+			case c.Signal.Sliced:
+				b.fail(chip, part.Line, "%s: sub bus of an internal signal may not be used", c.Signal)
+			default:
+				if _, exists := signals[name]; exists {
+					b.fail(chip, part.Line, "internal signal %s is driven by more than one part", name)
+				}
+				signals[name] = b.nodes(hi-lo+1, false)
+			}
+		}
+	}
+
+	instances := map[string]int{}
+	for i, part := range chip.Parts {
+		def := defs[i]
+		parent, child := b.scope, (*Scope)(nil)
+		if b.loader.Scopes && def.Builtin == "" && parent != nil {
+			child = &Scope{Name: fmt.Sprintf("%s_%d", part.Name, instances[part.Name]), Chip: def}
+			parent.Children = append(parent.Children, child)
+		}
+		instances[part.Name]++
+		partInputs := map[string][]int32{}
+		for _, pin := range def.Inputs {
+			partInputs[pin.Name] = make([]int32, pin.Width)
+		}
+		// inputs first, since the part must exist before its outputs are connected
+		for _, c := range part.Connections {
+			pin, isInput := findPin(def.Inputs, c.Pin.Name)
+			if !isInput {
+				continue
+			}
+			lo, hi, ok := span(c.Pin, pin.Width)
+			if !ok {
+				b.fail(chip, part.Line, "%s: sub bus out of range of %s[%d]", c.Pin, pin.Name, pin.Width)
+			}
+			source := b.source(chip, part, signals, c.Signal, hi-lo+1)
+			copy(partInputs[pin.Name][lo:hi+1], source)
+		}
+		nands, dffs, parts := len(b.nands), len(b.dffs), len(b.parts)
+		b.scope = child
+		outputs := b.elaborate(def, dir, partInputs)
+		b.scope = parent
+		if child != nil {
+			child.setSignals(outputs)
+		}
+		if len(b.stack) == 1 {
+			b.breakdown = append(b.breakdown, PartStats{part.Name, part.Line,
+				len(b.nands) - nands, len(b.dffs) - dffs, len(b.parts) - parts})
+		}
+		for _, c := range part.Connections {
+			pin, isOutput := findPin(def.Outputs, c.Pin.Name)
+			if !isOutput {
+				continue
+			}
+			lo, hi, _ := span(c.Pin, pin.Width)
+			target := signals[c.Signal.Name]
+			tlo, thi, ok := span(c.Signal, len(target))
+			if !ok {
+				b.fail(chip, part.Line, "%s: sub bus out of range of %s[%d]", c.Signal, c.Signal.Name, len(target))
+			}
+			if thi-tlo != hi-lo {
+				b.fail(chip, part.Line, "%s=%s: width %d does not match width %d", c.Pin, c.Signal, hi-lo+1, thi-tlo+1)
+			}
+			for k := 0; k <= hi-lo; k++ {
+				if !b.connect(target[tlo+k], outputs[pin.Name][lo+k]) {
+					b.fail(chip, part.Line, "%s is driven by more than one part", c.Signal)
+				}
+			}
+		}
+	}
+	return signals
+}
+
+/*
+ * source returns the nodes feeding a part input of the given width: a constant,
+ * an input pin of the chip (or a sub bus of one) or an internal signal.
+ */
+func (b *builder) source(chip *Chip, part Part, signals map[string][]int32, bus Bus, width int) []int32 {
+	nodes := make([]int32, width)
+	switch bus.Name {
+	case "true", "false":
+		if bus.Sliced {
+			b.fail(chip, part.Line, "%s: constants cannot have a sub bus", bus)
+		}
+		for i := range nodes {
+			nodes[i] = falseNode
+			if bus.Name == "true" {
+				nodes[i] = trueNode
+			}
+		}
+		return nodes
+	}
+	if isOutputPin(chip, bus.Name) {
+		b.fail(chip, part.Line, "output pin %s cannot feed a part; connect the part output to an internal signal as well", bus.Name)
+	}
+	signal, ok := signals[bus.Name]
+	if !ok {
+		b.fail(chip, part.Line, "undefined signal %s", bus.Name)
+	}
+	if bus.Sliced && !isInputPin(chip, bus.Name) {
+		b.fail(chip, part.Line, "%s: sub bus of an internal signal may not be used", bus)
+	}
+	lo, hi, ok := span(bus, len(signal))
+	if !ok {
+		b.fail(chip, part.Line, "%s: sub bus out of range of %s[%d]", bus, bus.Name, len(signal))
+	}
+	if hi-lo+1 != width {
+		b.fail(chip, part.Line, "%s: width %d does not match part pin width %d", bus, hi-lo+1, width)
+	}
+	copy(nodes, signal[lo:hi+1])
+	return nodes
+}
+
+func isInputPin(chip *Chip, name string) bool {
+	_, ok := findPin(chip.Inputs, name)
+	return ok
+}
+
+func isOutputPin(chip *Chip, name string) bool {
+	_, ok := findPin(chip.Outputs, name)
+	return ok
+}
+
+/*
+ * sort orders the Nand gates and builtin parts so that each comes after those
+ * feeding it, which lets Eval settle the circuit in one pass. Only DFFs and the
+ * clocked inputs of builtins may close a loop.
+ */
+func (c *Circuit) sort(nodes int) error {
+	// items 0..len(nands)-1 are gates, the rest builtin parts
+	driver := make([]int, nodes)
+	for i := range driver {
+		driver[i] = -1
+	}
+	for i, g := range c.nands {
+		driver[g.out] = i
+	}
+	for i, part := range c.parts {
+		for _, pin := range part.chip.Outputs {
+			for _, node := range part.pins[pin.Name] {
+				driver[node] = len(c.nands) + i
+			}
+		}
+	}
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]byte, len(c.nands)+len(c.parts))
+	var order []int
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("combinational loop: the circuit feeds back into itself without a DFF")
+		}
+		state[i] = visiting
+		var inputs []int32
+		if i < len(c.nands) {
+			inputs = []int32{c.nands[i].a, c.nands[i].b}
+		} else {
+			inputs = c.parts[i-len(c.nands)].inputs
+		}
+		for _, in := range inputs {
+			if j := driver[in]; j >= 0 {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = done
+		order = append(order, i)
+		return nil
+	}
+	for i := range state {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+
+	sorted := make([]nand, 0, len(c.nands))
+	c.steps = nil
+	for _, i := range order {
+		if i >= len(c.nands) {
+			c.steps = append(c.steps, step{part: c.parts[i-len(c.nands)].impl})
+			continue
+		}
+		sorted = append(sorted, c.nands[i])
+		if n := len(c.steps); n > 0 && c.steps[n-1].part == nil {
+			c.steps[n-1].hi++
+		} else {
+			c.steps = append(c.steps, step{lo: len(sorted) - 1, hi: len(sorted)})
+		}
+	}
+	c.nands = sorted
+	return nil
+}
+
+/*
+ * Eval settles the combinational logic after inputs have changed.
+ */
+func (c *Circuit) Eval() {
+	values := c.values
+	for _, s := range c.steps {
+		if s.part != nil {
+			s.part.eval(values)
+			continue
+		}
+		for _, g := range c.nands[s.lo:s.hi] {
+			values[g.out] = !(values[g.a] && values[g.b])
+		}
+	}
+}
+
+/*
+ * Tick is the rising edge of the clock: the DFFs and clocked builtins sample
+ * their inputs.
+ */
+func (c *Circuit) Tick() {
+	c.Eval()
+	for i := range c.dffs {
+		c.dffs[i].state = c.values[c.dffs[i].in]
+	}
+	for _, part := range c.parts {
+		part.impl.tick(c.values)
+	}
+}
+
+/*
+ * Tock is the falling edge of the clock: the DFFs output what they sampled and
+ * the clocked builtins update their state.
+ */
+func (c *Circuit) Tock() {
+	for _, d := range c.dffs {
+		c.values[d.out] = d.state
+	}
+	for _, part := range c.parts {
+		part.impl.tock(c.values)
+	}
+	c.Eval()
+}
+
+/*
+ * Width returns the width of a pin or internal signal of the chip.
+ */
+func (c *Circuit) Width(name string) (int, bool) {
+	nodes, ok := c.pins[name]
+	return len(nodes), ok
+}
+
+/*
+ * Set an input pin, or the state of a builtin part such as RAM16K[0] or PC[].
+ * The new value takes effect with the next Eval or Tick.
+ */
+func (c *Circuit) Set(name string, value int) error {
+	if m, address, ok, err := c.memory(name); ok {
+		if err != nil {
+			return err
+		}
+		m.write(address, value)
+		return nil
+	}
+	if !c.inputs[name] {
+		return fmt.Errorf("%s is not an input pin of %s", name, c.Chip.Name)
+	}
+	for i, node := range c.pins[name] {
+		c.values[node] = value>>uint(i)&1 == 1
+	}
+	return nil
+}
+
+/*
+ * Get the value of a pin, an internal signal or the state of a builtin part.
+ * 16-bit values are signed.
+ */
+func (c *Circuit) Get(name string) (int, error) {
+	if m, address, ok, err := c.memory(name); ok {
+		if err != nil {
+			return 0, err
+		}
+		return m.read(address), nil
+	}
+	nodes, ok := c.pins[name]
+	if !ok {
+		return 0, fmt.Errorf("%s has no pin %s", c.Chip.Name, name)
+	}
+	value := 0
+	for i, node := range nodes {
+		if c.values[node] {
+			value |= 1 << uint(i)
+		}
+	}
+	if len(nodes) == 16 {
+		value = int(int16(value))
+	}
+	return value, nil
+}
+
+/*
+ * memory resolves a reference to the state of a builtin part: Name[] for a
+ * register and Name[address] for a memory, where Name is the chip of the part.
+ * ok is false when name is not of that form.
+ */
+func (c *Circuit) memory(name string) (m memory, address int, ok bool, err error) {
+	open := strings.Index(name, "[")
+	if open < 0 || !strings.HasSuffix(name, "]") {
+		return nil, 0, false, nil
+	}
+	if _, isPin := c.pins[name[:open]]; isPin {
+		return nil, 0, true, fmt.Errorf("%s: sub buses of pins cannot be read or set", name)
+	}
+	chip, index := name[:open], name[open+1:len(name)-1]
+	part := c.part(chip)
+	if part == nil {
+		return nil, 0, true, fmt.Errorf("%s: %s has no builtin part %s", name, c.Chip.Name, chip)
+	}
+	m, isMemory := part.(memory)
+	if !isMemory {
+		return nil, 0, true, fmt.Errorf("%s: builtin chip %s has no state", name, chip)
+	}
+	if index != "" {
+		address, err = strconv.Atoi(index)
+		if err != nil {
+			return nil, 0, true, fmt.Errorf("%s: invalid address", name)
+		}
+	}
+	if address < 0 || address >= m.size() {
+		return nil, 0, true, fmt.Errorf("%s: address out of range", name)
+	}
+	return m, address, true, nil
+}
+
+/*
+ * part returns the first builtin part of the circuit implementing the named
+ * chip, or nil.
+ */
+func (c *Circuit) part(chip string) builtin {
+	for _, part := range c.parts {
+		if part.chip.Name == chip {
+			return part.impl
+		}
+	}
+	return nil
+}
+
+/*
+ * LoadMemory fills a builtin memory part of the circuit, e.g. ROM32K, from
+ * address 0.
+ */
+func (c *Circuit) LoadMemory(chip string, words []uint16) error {
+	m, ok := c.part(chip).(memory)
+	if !ok {
+		return fmt.Errorf("%s has no builtin memory %s", c.Chip.Name, chip)
+	}
+	if len(words) > m.size() {
+		return fmt.Errorf("%d words do not fit in %s", len(words), chip)
+	}
+	for i := 0; i < m.size(); i++ {
+		value := 0
+		if i < len(words) {
+			value = int(words[i])
+		}
+		m.write(i, value)
+	}
+	c.Eval()
+	return nil
+}
+
+/*
+ * Reset returns the circuit to its state after Build: every node low, the DFFs
+ * clear and the builtin parts, memories included, as new.
+ */
+func (c *Circuit) Reset() {
+	replaced := map[builtin]builtin{}
+	for _, part := range c.parts {
+		old := part.impl
+		part.instantiate()
+		replaced[old] = part.impl
+	}
+	for i := range c.steps {
+		if c.steps[i].part != nil {
+			c.steps[i].part = replaced[c.steps[i].part]
+		}
+	}
+	for i := range c.dffs {
+		c.dffs[i].state = false
+	}
+	for i := range c.values {
+		c.values[i] = false
+	}
+	c.values[trueNode] = true
+	c.Eval()
+}
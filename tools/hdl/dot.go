@@ -0,0 +1,130 @@
+package hdl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+/*
+ * WriteDOT writes a Graphviz graph of one level of chip: its input pins on the
+ * left, its output pins on the right and in between a node per part with the
+ * part's pins as ports. Each wire is an edge labeled with the signal it
+ * carries; buses are drawn thicker.
+ */
+func (l *Loader) WriteDOT(w io.Writer, chip *Chip, dir string) error {
+	if chip.Builtin != "" {
+		return &Error{chip.File, 1, fmt.Sprintf("chip %s is builtin and has no parts to draw", chip.Name)}
+	}
+	defs := make([]*Chip, len(chip.Parts))
+	for i, part := range chip.Parts {
+		def, err := l.find(part.Name, dir)
+		if err != nil {
+			if _, ok := err.(*Error); ok {
+				return err
+			}
+			return &Error{chip.File, part.Line, err.Error()}
+		}
+		defs[i] = def
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "digraph %q {\n", chip.Name)
+	fmt.Fprintln(out, "    rankdir=LR;")
+	fmt.Fprintln(out, "    node [fontname=\"Helvetica\", fontsize=11];")
+	fmt.Fprintln(out, "    edge [fontname=\"Helvetica\", fontsize=9];")
+
+	// where each signal comes from: an input pin or a part output port
+	drivers := map[string]string{}
+	fmt.Fprintln(out, "    { rank=source;")
+	for _, pin := range chip.Inputs {
+		id := "in_" + pin.Name
+		drivers[pin.Name] = id
+		fmt.Fprintf(out, "        %s [label=%q, shape=box, style=rounded];\n", id, pinLabel(pin))
+	}
+	fmt.Fprintln(out, "    }")
+	fmt.Fprintln(out, "    { rank=sink;")
+	for _, pin := range chip.Outputs {
+		fmt.Fprintf(out, "        out_%s [label=%q, shape=box, style=rounded];\n", pin.Name, pinLabel(pin))
+	}
+	fmt.Fprintln(out, "    }")
+
+	for i, def := range defs {
+		label := "{"
+		for j, pin := range def.Inputs {
+			if j > 0 {
+				label += "|"
+			}
+			label += fmt.Sprintf("<i_%s>%s", pin.Name, pin.Name)
+		}
+		label += "}|" + chip.Parts[i].Name + "|{"
+		for j, pin := range def.Outputs {
+			if j > 0 {
+				label += "|"
+			}
+			label += fmt.Sprintf("<o_%s>%s", pin.Name, pin.Name)
+		}
+		label += "}"
+		fmt.Fprintf(out, "    p%d [shape=record, label=%q];\n", i, label)
+		for _, c := range chip.Parts[i].Connections {
+			pin, isOutput := findPin(def.Outputs, c.Pin.Name)
+			if !isOutput || isOutputPin(chip, c.Signal.Name) {
+				continue
+			}
+			if _, driven := drivers[c.Signal.Name]; !driven {
+				drivers[c.Signal.Name] = fmt.Sprintf("p%d:o_%s", i, pin.Name)
+			}
+		}
+	}
+
+	constants := 0
+	edge := func(from, to, label string, width int) {
+		style := ""
+		if width > 1 {
+			style = ", penwidth=2"
+		}
+		fmt.Fprintf(out, "    %s -> %s [label=%q%s];\n", from, to, label, style)
+	}
+	for i, def := range defs {
+		for _, c := range chip.Parts[i].Connections {
+			label := c.Signal.String()
+			if c.Pin.Sliced {
+				label = c.Pin.String() + "=" + label
+			}
+			if pin, isOutput := findPin(def.Outputs, c.Pin.Name); isOutput {
+				if isOutputPin(chip, c.Signal.Name) {
+					lo, hi, _ := span(c.Pin, pin.Width)
+					edge(fmt.Sprintf("p%d:o_%s", i, pin.Name), "out_"+c.Signal.Name, label, hi-lo+1)
+				}
+				continue
+			}
+			pin, isInput := findPin(def.Inputs, c.Pin.Name)
+			if !isInput {
+				continue
+			}
+			lo, hi, _ := span(c.Pin, pin.Width)
+			to := fmt.Sprintf("p%d:i_%s", i, pin.Name)
+			from, driven := drivers[c.Signal.Name]
+			switch {
+			case c.Signal.Name == "true" || c.Signal.Name == "false":
+				from = fmt.Sprintf("const%d", constants)
+				constants++
+				fmt.Fprintf(out, "    %s [label=%q, shape=plaintext];\n", from, c.Signal.Name)
+			case !driven:
+				from = "undefined_" + c.Signal.Name
+				drivers[c.Signal.Name] = from
+				fmt.Fprintf(out, "    %s [label=%q, shape=plaintext, fontcolor=red];\n", from, c.Signal.Name+"?")
+			}
+			edge(from, to, label, hi-lo+1)
+		}
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+func pinLabel(pin Pin) string {
+	if pin.Width == 1 {
+		return pin.Name
+	}
+	return fmt.Sprintf("%s[%d]", pin.Name, pin.Width)
+}
@@ -0,0 +1,569 @@
+package hdl
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+ * Problem is a finding of Lint. Errors are mistakes the simulator rejects when
+ * the chip is loaded; warnings mark HDL that simulates but is probably not what
+ * was meant, such as an unconnected input (which reads as false) or a gate that
+ * only copies its input.
+ */
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+	Warning bool
+}
+
+func (p Problem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("%s:%d: warning: %s", p.File, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+/*
+ * Lint checks the chip in the named .hdl file without simulating it, reporting
+ * every problem rather than only the first: unknown parts and pins, unconnected
+ * input and output pins, bus width mismatches, sub buses of internal pins,
+ * pins with more than one driver, combinational loops and identity gates.
+ * Parts are looked up as by Load. The error is set only when the file itself
+ * cannot be read or parsed.
+ */
+func (l *Loader) Lint(file string) ([]Problem, error) {
+	chip, err := l.ParseFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lt := &linter{loader: l, dir: filepath.Dir(file), deps: map[*Chip]map[bitRef][]bitRef{}, active: map[*Chip]bool{}}
+	return lt.lint(chip), nil
+}
+
+/*
+ * check returns the first error Lint finds in chip, ignoring warnings.
+ */
+func (l *Loader) check(chip *Chip, dir string) error {
+	lt := &linter{loader: l, dir: dir, deps: map[*Chip]map[bitRef][]bitRef{}, active: map[*Chip]bool{}}
+	for _, problem := range lt.lint(chip) {
+		if !problem.Warning {
+			return &Error{problem.File, problem.Line, problem.Message}
+		}
+	}
+	return nil
+}
+
+/*
+ * bitRef is one bit of a pin or internal signal.
+ */
+type bitRef struct {
+	signal string
+	index  int
+}
+
+func (b bitRef) less(o bitRef) bool {
+	if b.signal != o.signal {
+		return b.signal < o.signal
+	}
+	return b.index < o.index
+}
+
+type linter struct {
+	loader   *Loader
+	dir      string
+	deps     map[*Chip]map[bitRef][]bitRef
+	active   map[*Chip]bool
+	chip     *Chip
+	problems []Problem
+}
+
+func (lt *linter) report(line int, format string, args ...interface{}) {
+	lt.problems = append(lt.problems, Problem{lt.chip.File, line, fmt.Sprintf(format, args...), false})
+}
+
+func (lt *linter) warn(line int, format string, args ...interface{}) {
+	lt.problems = append(lt.problems, Problem{lt.chip.File, line, fmt.Sprintf(format, args...), true})
+}
+
+func (lt *linter) lint(chip *Chip) []Problem {
+	lt.chip = chip
+	if chip.Builtin != "" {
+		if _, err := checkBuiltin(chip); err != nil && primitives[chip.Builtin] == nil {
+			lt.report(1, "%v", err)
+		}
+		return lt.problems
+	}
+
+	// internal signals: their width (0 when unknown) and the line of their driver
+	widths := map[string]int{}
+	drivers := map[string]int{}
+	used := map[string]bool{}
+	outputBits := map[string][]bool{}
+	for _, pin := range chip.Outputs {
+		outputBits[pin.Name] = make([]bool, pin.Width)
+	}
+
+	defs := make([]*Chip, len(chip.Parts))
+	complete := true
+	for i, part := range chip.Parts {
+		def, err := lt.loader.find(part.Name, lt.dir)
+		if err != nil {
+			lt.report(part.Line, "%v", err)
+			complete = false
+			continue
+		}
+		if lt.uses(def, chip.Name, map[*Chip]bool{}) {
+			lt.report(part.Line, "chip %s is built from itself", chip.Name)
+			complete = false
+			continue
+		}
+		defs[i] = def
+		for _, c := range part.Connections {
+			pin, isOutput := findPin(def.Outputs, c.Pin.Name)
+			if !isOutput {
+				if _, isInput := findPin(def.Inputs, c.Pin.Name); !isInput {
+					lt.report(part.Line, "%s has no pin %s", part.Name, c.Pin.Name)
+				}
+				continue
+			}
+			lo, hi, ok := span(c.Pin, pin.Width)
+			if !ok {
+				lt.report(part.Line, "%s: sub bus out of range of %s[%d]", c.Pin, pin.Name, pin.Width)
+				continue
+			}
+			name := c.Signal.Name
+			switch {
+			case name == "true" || name == "false":
+				lt.report(part.Line, "output %s of %s cannot be connected to %s", c.Pin, part.Name, name)
+			case isInputPin(chip, name):
+				lt.report(part.Line, "input pin %s cannot be driven by %s", name, part.Name)
+			case isOutputPin(chip, name):
+				bits := outputBits[name]
+				tlo, thi, ok := span(c.Signal, len(bits))
+				if !ok {
+					lt.report(part.Line, "%s: sub bus out of range of %s[%d]", c.Signal, name, len(bits))
+					continue
+				}
+				if thi-tlo != hi-lo {
+					lt.report(part.Line, "%s=%s: width %d does not match width %d", c.Pin, c.Signal, hi-lo+1, thi-tlo+1)
+				}
+				twice := false
+				for k := tlo; k <= thi; k++ {
+					twice = twice || bits[k]
+					bits[k] = true
+				}
+				if twice {
+					lt.report(part.Line, "%s is driven by more than one part", c.Signal)
+				}
+			case c.Signal.Sliced:
+				lt.report(part.Line, "%s: sub bus of an internal signal may not be used", c.Signal)
+				if _, exists := drivers[name]; !exists {
+					drivers[name], widths[name] = part.Line, 0
+				}
+			default:
+				if line, exists := drivers[name]; exists {
+					lt.report(part.Line, "internal signal %s is driven by more than one part (also on line %d)", name, line)
+					continue
+				}
+				drivers[name], widths[name] = part.Line, hi-lo+1
+			}
+		}
+	}
+
+	for i, part := range chip.Parts {
+		def := defs[i]
+		if def == nil {
+			continue
+		}
+		connected := map[string][]bool{}
+		for _, pin := range def.Inputs {
+			connected[pin.Name] = make([]bool, pin.Width)
+		}
+		for _, c := range part.Connections {
+			pin, isInput := findPin(def.Inputs, c.Pin.Name)
+			if !isInput {
+				continue
+			}
+			lo, hi, ok := span(c.Pin, pin.Width)
+			if !ok {
+				lt.report(part.Line, "%s: sub bus out of range of %s[%d]", c.Pin, pin.Name, pin.Width)
+				continue
+			}
+			twice := false
+			for k := lo; k <= hi; k++ {
+				twice = twice || connected[pin.Name][k]
+				connected[pin.Name][k] = true
+			}
+			if twice {
+				lt.report(part.Line, "input %s of %s is connected more than once", c.Pin, part.Name)
+			}
+			lt.source(part, c, hi-lo+1, widths, used)
+		}
+		// leaving some bits of a bus open, as in Add16(a=in, b[0]=true, ...), is a
+		// common way to feed zeros, so only pins left open entirely are reported
+		for _, pin := range def.Inputs {
+			if unconnected(connected[pin.Name]) {
+				lt.warn(part.Line, "input %s of %s is not connected and reads as false", pin.Name, part.Name)
+			}
+		}
+	}
+
+	for _, pin := range chip.Outputs {
+		if complete && unconnected(outputBits[pin.Name]) {
+			lt.warn(1, "output pin %s is not driven by any part", pin.Name)
+		}
+	}
+	var unused []string
+	for name := range drivers {
+		if complete && !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		lt.warn(drivers[name], "internal signal %s is never used", name)
+	}
+
+	for i, part := range chip.Parts {
+		copied, ok := identity(part)
+		switch {
+		case !ok || defs[i] == nil:
+		case !lt.drivesOutputsOnly(part):
+			lt.warn(part.Line, "%s only copies %s; use %s directly", part.Name, copied, copied)
+		case copied.Name != "true" && copied.Name != "false" && !isInputPin(chip, copied.Name):
+			lt.warn(part.Line, "%s only copies %s; connect the output pin to the part driving %s instead", part.Name, copied, copied.Name)
+		}
+	}
+
+	lt.loops()
+
+	sort.SliceStable(lt.problems, func(i, j int) bool { return lt.problems[i].Line < lt.problems[j].Line })
+	return lt.problems
+}
+
+/*
+ * uses reports whether chip is, or is built from, the chip with the given name.
+ */
+func (lt *linter) uses(chip *Chip, name string, visited map[*Chip]bool) bool {
+	if chip.Name == name {
+		return true
+	}
+	if visited[chip] {
+		return false
+	}
+	visited[chip] = true
+	for _, part := range chip.Parts {
+		if def, err := lt.loader.find(part.Name, lt.dir); err == nil && lt.uses(def, name, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * source checks the signal feeding a part input of the given width.
+ */
+func (lt *linter) source(part Part, c Connection, width int, widths map[string]int, used map[string]bool) {
+	chip, bus := lt.chip, c.Signal
+	switch {
+	case bus.Name == "true" || bus.Name == "false":
+		if bus.Sliced {
+			lt.report(part.Line, "%s: constants cannot have a sub bus", bus)
+		}
+	case isOutputPin(chip, bus.Name):
+		lt.report(part.Line, "output pin %s cannot feed a part; connect the part output to an internal signal as well", bus.Name)
+	case isInputPin(chip, bus.Name):
+		pin, _ := findPin(chip.Inputs, bus.Name)
+		lo, hi, ok := span(bus, pin.Width)
+		if !ok {
+			lt.report(part.Line, "%s: sub bus out of range of %s[%d]", bus, bus.Name, pin.Width)
+		} else if hi-lo+1 != width {
+			lt.report(part.Line, "%s=%s: width %d does not match width %d", c.Pin, bus, width, hi-lo+1)
+		}
+	default:
+		signalWidth, exists := widths[bus.Name]
+		used[bus.Name] = true
+		switch {
+		case !exists:
+			lt.report(part.Line, "undefined signal %s", bus.Name)
+		case bus.Sliced:
+			lt.report(part.Line, "%s: sub bus of an internal signal may not be used", bus)
+		case signalWidth > 0 && signalWidth != width:
+			lt.report(part.Line, "%s=%s: width %d does not match width %d", c.Pin, bus, width, signalWidth)
+		}
+	}
+}
+
+func unconnected(bits []bool) bool {
+	for _, bit := range bits {
+		if bit {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * identity reports whether a gate of project 01 only passes one of its inputs
+ * through, as in And(a=x, b=true, out=y) or Mux(a=x, b=x, sel=s, out=y), and
+ * returns that input.
+ */
+func identity(part Part) (Bus, bool) {
+	inputs := map[string]Bus{}
+	for _, c := range part.Connections {
+		if c.Pin.Sliced {
+			return Bus{}, false
+		}
+		if c.Pin.Name != "out" {
+			inputs[c.Pin.Name] = c.Signal
+		}
+	}
+	a, hasA := inputs["a"]
+	b, hasB := inputs["b"]
+	if !hasA || !hasB {
+		return Bus{}, false
+	}
+	constant := func(bus Bus, value string) bool { return bus.Name == value && !bus.Sliced }
+	switch part.Name {
+	case "And", "And16":
+		switch {
+		case constant(b, "true") || a == b:
+			return a, true
+		case constant(a, "true"):
+			return b, true
+		}
+	case "Or", "Or16", "Xor":
+		switch {
+		case constant(b, "false") || a == b && part.Name != "Xor":
+			return a, true
+		case constant(a, "false"):
+			return b, true
+		}
+	case "Mux", "Mux16":
+		sel := inputs["sel"]
+		switch {
+		case a == b || constant(sel, "false"):
+			return a, true
+		case constant(sel, "true"):
+			return b, true
+		}
+	}
+	return Bus{}, false
+}
+
+/*
+ * drivesOutputsOnly reports whether all outputs of a part go to output pins of
+ * the chip. HDL has no other way to drive an output pin from an input pin or a
+ * constant than through a gate, so such a copy is needed.
+ */
+func (lt *linter) drivesOutputsOnly(part Part) bool {
+	for _, c := range part.Connections {
+		if c.Pin.Name == "out" && !isOutputPin(lt.chip, c.Signal.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * graph returns the combinational dependencies between the bits of the pins and
+ * internal signals of chip: each bit driven by a part maps to the bits its value
+ * depends on without a clock edge in between. lines holds the line of the part
+ * driving each signal. Connections that do not make sense are skipped; lint
+ * reports them separately.
+ */
+func (lt *linter) graph(chip *Chip) (edges map[bitRef][]bitRef, lines map[string]int) {
+	edges, lines = map[bitRef][]bitRef{}, map[string]int{}
+	for _, part := range chip.Parts {
+		def, err := lt.loader.find(part.Name, lt.dir)
+		if err != nil {
+			continue
+		}
+		deps := lt.dependencies(def)
+		bound := map[bitRef]bitRef{}
+		for _, c := range part.Connections {
+			pin, isInput := findPin(def.Inputs, c.Pin.Name)
+			lo, hi, ok := span(c.Pin, pin.Width)
+			if !isInput || !ok || c.Signal.Name == "true" || c.Signal.Name == "false" {
+				continue
+			}
+			for k := 0; k <= hi-lo; k++ {
+				bound[bitRef{pin.Name, lo + k}] = bitRef{c.Signal.Name, c.Signal.Lo + k}
+			}
+		}
+		for _, c := range part.Connections {
+			pin, isOutput := findPin(def.Outputs, c.Pin.Name)
+			lo, hi, ok := span(c.Pin, pin.Width)
+			if !isOutput || !ok || c.Signal.Name == "true" || c.Signal.Name == "false" {
+				continue
+			}
+			if _, exists := lines[c.Signal.Name]; !exists {
+				lines[c.Signal.Name] = part.Line
+			}
+			for k := 0; k <= hi-lo; k++ {
+				target := bitRef{c.Signal.Name, c.Signal.Lo + k}
+				for _, in := range deps[bitRef{pin.Name, lo + k}] {
+					if source, ok := bound[in]; ok {
+						edges[target] = append(edges[target], source)
+					}
+				}
+			}
+		}
+	}
+	return edges, lines
+}
+
+/*
+ * dependencies returns, for each output bit of chip, the input bits it depends
+ * on combinationally. A DFF breaks the dependency, as do the clocked inputs of
+ * builtin chips.
+ */
+func (lt *linter) dependencies(chip *Chip) map[bitRef][]bitRef {
+	if deps, ok := lt.deps[chip]; ok {
+		return deps
+	}
+	deps := map[bitRef][]bitRef{}
+	switch chip.Builtin {
+	case "Nand":
+		deps[bitRef{"out", 0}] = []bitRef{{"a", 0}, {"b", 0}}
+	case "DFF":
+	case "":
+		if lt.active[chip] {
+			// a chip built from itself; Build reports it
+			return deps
+		}
+		lt.active[chip] = true
+		edges, _ := lt.graph(chip)
+		delete(lt.active, chip)
+		reached := map[bitRef][]bitRef{}
+		state := map[bitRef]int{}
+		var reach func(node bitRef) []bitRef
+		reach = func(node bitRef) []bitRef {
+			if isInputPin(chip, node.signal) {
+				return []bitRef{node}
+			}
+			if state[node] != 0 {
+				return reached[node]
+			}
+			state[node] = 1
+			seen := map[bitRef]bool{}
+			var inputs []bitRef
+			for _, source := range edges[node] {
+				for _, in := range reach(source) {
+					if !seen[in] {
+						seen[in] = true
+						inputs = append(inputs, in)
+					}
+				}
+			}
+			reached[node], state[node] = inputs, 2
+			return inputs
+		}
+		for _, pin := range chip.Outputs {
+			for k := 0; k < pin.Width; k++ {
+				out := bitRef{pin.Name, k}
+				deps[out] = reach(out)
+			}
+		}
+	default:
+		def, err := checkBuiltin(chip)
+		if err != nil {
+			break
+		}
+		var inputs []bitRef
+		for _, pin := range def.Inputs {
+			if clocked(def, pin.Name) {
+				continue
+			}
+			for k := 0; k < pin.Width; k++ {
+				inputs = append(inputs, bitRef{pin.Name, k})
+			}
+		}
+		for _, pin := range def.Outputs {
+			for k := 0; k < pin.Width; k++ {
+				deps[bitRef{pin.Name, k}] = inputs
+			}
+		}
+	}
+	lt.deps[chip] = deps
+	return deps
+}
+
+func clocked(chip *Chip, pin string) bool {
+	for _, name := range chip.Clocked {
+		if name == pin {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * loops reports the combinational loops of the chip, each as the chain of
+ * signals it runs through.
+ */
+func (lt *linter) loops() {
+	edges, lines := lt.graph(lt.chip)
+	var nodes []bitRef
+	for node := range edges {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].less(nodes[j]) })
+
+	state := map[bitRef]int{}
+	reported := map[string]bool{}
+	var path []bitRef
+	var visit func(node bitRef)
+	visit = func(node bitRef) {
+		switch state[node] {
+		case 1:
+			for i := range path {
+				if path[i] == node {
+					lt.loop(path[i:], lines, reported)
+				}
+			}
+			return
+		case 2:
+			return
+		}
+		state[node] = 1
+		path = append(path, node)
+		for _, source := range edges[node] {
+			visit(source)
+		}
+		path = path[:len(path)-1]
+		state[node] = 2
+	}
+	for _, node := range nodes {
+		visit(node)
+	}
+}
+
+/*
+ * loop reports the loop through the given bits unless one through the same
+ * signals, such as the next bit of the same buses, has been reported.
+ */
+func (lt *linter) loop(cycle []bitRef, lines map[string]int, reported map[string]bool) {
+	// edges point from a signal to its sources, so reverse to follow the data
+	var names []string
+	for i := len(cycle) - 1; i >= 0; i-- {
+		if name := cycle[i].signal; len(names) == 0 || names[len(names)-1] != name {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 1 && names[0] == names[len(names)-1] {
+		names = names[:len(names)-1]
+	}
+	key := append([]string(nil), names...)
+	sort.Strings(key)
+	if reported[strings.Join(key, " ")] {
+		return
+	}
+	reported[strings.Join(key, " ")] = true
+	names = append(names, names[0])
+	lt.report(lines[names[0]], "combinational loop without a DFF: %s", strings.Join(names, " -> "))
+}
@@ -0,0 +1,336 @@
+package hdl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ * Chip is a parsed chip definition: its interface and either the parts it is
+ * built from or, for chips declared BUILTIN, the name of a native implementation.
+ */
+type Chip struct {
+	Name    string
+	File    string
+	Inputs  []Pin
+	Outputs []Pin
+	Parts   []Part
+	Builtin string
+	Clocked []string
+}
+
+type Pin struct {
+	Name  string
+	Width int
+}
+
+/*
+ * Part is one line of the PARTS section, e.g. Mux16(a=x, sel=zx, out=xout).
+ */
+type Part struct {
+	Name        string
+	Connections []Connection
+	Line        int
+}
+
+/*
+ * Connection binds a pin of a part to a signal of the enclosing chip:
+ * Pin=Signal, where either side may be a sub-bus such as instruction[0..14].
+ */
+type Connection struct {
+	Pin    Bus
+	Signal Bus
+}
+
+/*
+ * Bus names a pin or signal, optionally narrowed to bits Lo..Hi. true and
+ * false are signals of any width.
+ */
+type Bus struct {
+	Name   string
+	Lo, Hi int
+	Sliced bool
+}
+
+func (b Bus) String() string {
+	switch {
+	case !b.Sliced:
+		return b.Name
+	case b.Lo == b.Hi:
+		return fmt.Sprintf("%s[%d]", b.Name, b.Lo)
+	}
+	return fmt.Sprintf("%s[%d..%d]", b.Name, b.Lo, b.Hi)
+}
+
+/*
+ * Error reports a problem in an HDL file.
+ */
+type Error struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+type token struct {
+	text   string
+	line   int
+	number bool
+}
+
+/*
+ * tokenize splits HDL source into identifiers, numbers and symbols, dropping
+ * line and block comments.
+ */
+func tokenize(file, source string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(source[i:], "//"):
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return nil, &Error{file, line, "unterminated comment"}
+			}
+			line += strings.Count(source[i:i+2+end], "\n")
+			i += end + 4
+		case strings.HasPrefix(source[i:], ".."):
+			tokens = append(tokens, token{"..", line, false})
+			i += 2
+		case strings.ContainsRune("{}()[],;=:", rune(c)):
+			tokens = append(tokens, token{string(c), line, false})
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && source[i] >= '0' && source[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, token{source[start:i], line, true})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(source) && (source[i] == '_' || unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{source[start:i], line, false})
+		default:
+			return nil, &Error{file, line, fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	file   string
+	tokens []token
+	pos    int
+}
+
+type syntaxError struct {
+	err *Error
+}
+
+/*
+ * Parse an HDL source file into its chip definition.
+ */
+func Parse(file, source string) (chip *Chip, err error) {
+	tokens, err := tokenize(file, source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{file: file, tokens: tokens}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(syntaxError)
+			if !ok {
+				panic(r)
+			}
+			chip, err = nil, e.err
+		}
+	}()
+	chip = p.chip()
+	if p.pos < len(p.tokens) {
+		p.fail("expected end of file after chip, found %q", p.peek().text)
+	}
+	return chip, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	line := 1
+	if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+	return token{text: "end of file", line: line}
+}
+
+func (p *parser) next() token {
+	token := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return token
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(syntaxError{&Error{p.file, p.peek().line, fmt.Sprintf(format, args...)}})
+}
+
+func (p *parser) is(text string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].text == text
+}
+
+func (p *parser) expect(text string) token {
+	if !p.is(text) {
+		p.fail("expected %q, found %q", text, p.peek().text)
+	}
+	return p.next()
+}
+
+func (p *parser) identifier(what string) token {
+	token := p.peek()
+	if p.pos >= len(p.tokens) || token.number || len(token.text) == 0 || !(token.text[0] == '_' || unicode.IsLetter(rune(token.text[0]))) {
+		p.fail("expected %s, found %q", what, token.text)
+	}
+	return p.next()
+}
+
+func (p *parser) number() int {
+	token := p.peek()
+	if !token.number {
+		p.fail("expected a number, found %q", token.text)
+	}
+	p.next()
+	n, _ := strconv.Atoi(token.text)
+	return n
+}
+
+/*
+ * chip: 'CHIP' name '{' 'IN' pins ';' 'OUT' pins ';' (PARTS: part* | BUILTIN name ';' (CLOCKED names ';')?) '}'
+ */
+func (p *parser) chip() *Chip {
+	p.expect("CHIP")
+	chip := &Chip{Name: p.identifier("chip name").text, File: p.file}
+	p.expect("{")
+	if p.is("IN") {
+		p.next()
+		chip.Inputs = p.pins()
+	}
+	if p.is("OUT") {
+		p.next()
+		chip.Outputs = p.pins()
+	}
+	switch {
+	case p.is("PARTS"):
+		p.next()
+		p.expect(":")
+		for !p.is("}") {
+			chip.Parts = append(chip.Parts, p.part())
+		}
+	case p.is("BUILTIN"):
+		p.next()
+		chip.Builtin = p.identifier("builtin chip name").text
+		p.expect(";")
+		if p.is("CLOCKED") {
+			p.next()
+			for {
+				chip.Clocked = append(chip.Clocked, p.identifier("pin name").text)
+				if !p.is(",") {
+					break
+				}
+				p.next()
+			}
+			p.expect(";")
+		}
+	default:
+		p.fail("expected \"PARTS:\" or \"BUILTIN\", found %q", p.peek().text)
+	}
+	p.expect("}")
+	return chip
+}
+
+/*
+ * pins: name ('[' width ']')? (',' name ('[' width ']')?)* ';'
+ */
+func (p *parser) pins() []Pin {
+	var pins []Pin
+	for {
+		pin := Pin{Name: p.identifier("pin name").text, Width: 1}
+		if p.is("[") {
+			p.next()
+			pin.Width = p.number()
+			if pin.Width < 1 || pin.Width > 16 {
+				p.fail("pin %s: width must be between 1 and 16", pin.Name)
+			}
+			p.expect("]")
+		}
+		pins = append(pins, pin)
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect(";")
+	return pins
+}
+
+/*
+ * part: name '(' connection (',' connection)* ')' ';'
+ */
+func (p *parser) part() Part {
+	name := p.identifier("part name")
+	part := Part{Name: name.text, Line: name.line}
+	p.expect("(")
+	for {
+		var connection Connection
+		connection.Pin = p.bus()
+		p.expect("=")
+		connection.Signal = p.bus()
+		part.Connections = append(part.Connections, connection)
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect(")")
+	p.expect(";")
+	return part
+}
+
+/*
+ * bus: name ('[' n ']' | '[' lo '..' hi ']')?
+ */
+func (p *parser) bus() Bus {
+	bus := Bus{Name: p.identifier("pin name").text}
+	if p.is("[") {
+		p.next()
+		bus.Sliced = true
+		bus.Lo = p.number()
+		bus.Hi = bus.Lo
+		if p.is("..") {
+			p.next()
+			bus.Hi = p.number()
+		}
+		if bus.Hi < bus.Lo {
+			p.fail("%s: bad sub bus", bus)
+		}
+		p.expect("]")
+	}
+	return bus
+}
@@ -0,0 +1,103 @@
+package hdl
+
+import (
+	"sort"
+	"strings"
+)
+
+/*
+ * Scope is one chip instance of a circuit with its pins and internal signals.
+ * The root scope is the loaded chip; when the loader keeps scopes, each HDL part
+ * is a child named after its chip and its position among the parts of that
+ * chip, e.g. Register_0 and, inside it, Bit_15.
+ */
+type Scope struct {
+	Name     string
+	Chip     *Chip
+	Signals  []Signal
+	Children []*Scope
+}
+
+/*
+ * Signal is a pin or internal signal of a scope.
+ */
+type Signal struct {
+	Name  string
+	Width int
+	nodes []int32
+}
+
+/*
+ * setSignals orders the signals of the scope as the chip declares its pins,
+ * followed by the internal signals in alphabetical order.
+ */
+func (s *Scope) setSignals(nodes map[string][]int32) {
+	s.Signals = nil
+	seen := map[string]bool{}
+	for _, pins := range [][]Pin{s.Chip.Inputs, s.Chip.Outputs} {
+		for _, pin := range pins {
+			if n, ok := nodes[pin.Name]; ok {
+				s.Signals = append(s.Signals, Signal{pin.Name, len(n), n})
+				seen[pin.Name] = true
+			}
+		}
+	}
+	var internal []string
+	for name := range nodes {
+		if !seen[name] {
+			internal = append(internal, name)
+		}
+	}
+	sort.Strings(internal)
+	for _, name := range internal {
+		s.Signals = append(s.Signals, Signal{name, len(nodes[name]), nodes[name]})
+	}
+}
+
+/*
+ * resolve replaces the nodes of the signals in the scope tree by the nodes they
+ * were merged into.
+ */
+func (s *Scope) resolve(find func(int32) int32) {
+	for i := range s.Signals {
+		resolved := make([]int32, len(s.Signals[i].nodes))
+		for j, node := range s.Signals[i].nodes {
+			resolved[j] = find(node)
+		}
+		s.Signals[i].nodes = resolved
+	}
+	for _, child := range s.Children {
+		child.resolve(find)
+	}
+}
+
+/*
+ * Scope returns the root of the circuit's scope tree.
+ */
+func (c *Circuit) Scope() *Scope {
+	return c.scope
+}
+
+/*
+ * Value returns the bits of a signal as an unsigned number.
+ */
+func (c *Circuit) Value(signal Signal) int {
+	return read(c.values, signal.nodes)
+}
+
+/*
+ * Walk calls visit for each signal of the scope tree with its name relative to
+ * the root, e.g. out or Register_0.Bit_3.out.
+ */
+func (s *Scope) Walk(visit func(name string, signal Signal)) {
+	s.walk(nil, visit)
+}
+
+func (s *Scope) walk(path []string, visit func(name string, signal Signal)) {
+	for _, signal := range s.Signals {
+		visit(strings.Join(append(path, signal.Name), "."), signal)
+	}
+	for _, child := range s.Children {
+		child.walk(append(path, child.Name), visit)
+	}
+}
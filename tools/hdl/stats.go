@@ -0,0 +1,127 @@
+package hdl
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+ * Stats measures a circuit: how many Nand gates and DFFs it was flattened into,
+ * how many builtin parts remain, and its critical path, the longest chain of
+ * Nand gates between an input pin or DFF and an output pin or DFF.
+ */
+type Stats struct {
+	Nands    int
+	DFFs     int
+	Builtins int
+	Depth    int
+	// Path names the signals of the chip the critical path runs through
+	Path  []string
+	Parts []PartStats
+}
+
+/*
+ * PartStats is the share of one line of the PARTS section.
+ */
+type PartStats struct {
+	Name     string
+	Line     int
+	Nands    int
+	DFFs     int
+	Builtins int
+}
+
+/*
+ * Stats counts the primitives of the circuit and finds its critical path.
+ * Builtin parts have no gates of their own, so a path through one counts only
+ * the Nand gates before and after it.
+ */
+func (c *Circuit) Stats() Stats {
+	stats := Stats{Nands: len(c.nands), DFFs: len(c.dffs), Builtins: len(c.parts), Parts: c.breakdown}
+
+	depth := make([]int, len(c.values))
+	from := make([]int32, len(c.values))
+	for i := range from {
+		from[i] = -1
+	}
+	parts := map[builtin]*builtinPart{}
+	for _, part := range c.parts {
+		parts[part.impl] = part
+	}
+	deeper := func(out int32, inputs []int32, gates int) {
+		for _, in := range inputs {
+			if d := depth[in] + gates; d > depth[out] || from[out] < 0 && d == depth[out] {
+				depth[out], from[out] = d, in
+			}
+		}
+	}
+	for _, s := range c.steps {
+		if s.part != nil {
+			part := parts[s.part]
+			for _, pin := range part.chip.Outputs {
+				for _, out := range part.pins[pin.Name] {
+					deeper(out, part.inputs, 0)
+				}
+			}
+			continue
+		}
+		for _, g := range c.nands[s.lo:s.hi] {
+			deeper(g.out, []int32{g.a, g.b}, 1)
+		}
+	}
+
+	end := int32(-1)
+	for node, d := range depth {
+		if d > stats.Depth {
+			stats.Depth, end = d, int32(node)
+		}
+	}
+	if end < 0 {
+		return stats
+	}
+	names := c.nodeNames()
+	for node := end; node >= 0; node = from[node] {
+		name, ok := names[node]
+		if ok && (len(stats.Path) == 0 || stats.Path[len(stats.Path)-1] != name) {
+			stats.Path = append(stats.Path, name)
+		}
+	}
+	for i, j := 0, len(stats.Path)-1; i < j; i, j = i+1, j-1 {
+		stats.Path[i], stats.Path[j] = stats.Path[j], stats.Path[i]
+	}
+	return stats
+}
+
+/*
+ * nodeNames names the nodes of the chip's pins and internal signals, e.g. x[3].
+ * Where several signals share a node, pins come first, then the signal first
+ * in alphabetical order.
+ */
+func (c *Circuit) nodeNames() map[int32]string {
+	var signals []string
+	for name := range c.pins {
+		signals = append(signals, name)
+	}
+	isPin := func(name string) bool { return isInputPin(c.Chip, name) || isOutputPin(c.Chip, name) }
+	sort.Slice(signals, func(i, j int) bool {
+		if isPin(signals[i]) != isPin(signals[j]) {
+			return isPin(signals[i])
+		}
+		return signals[i] < signals[j]
+	})
+	names := map[int32]string{}
+	for _, name := range signals {
+		nodes := c.pins[name]
+		for i, node := range nodes {
+			if _, named := names[node]; named || node == falseNode || node == trueNode {
+				continue
+			}
+			if len(nodes) == 1 {
+				names[node] = name
+			} else {
+				names[node] = fmt.Sprintf("%s[%d]", name, i)
+			}
+		}
+	}
+	return names
+}
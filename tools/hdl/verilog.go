@@ -0,0 +1,482 @@
+package hdl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*
+ * WriteVerilog writes chip as structural Verilog: one module per chip it is
+ * built from, down to Nand and DFF, followed by behavioral modules for the
+ * builtin parts it uses. Every module with clocked parts gets an input clk; the
+ * Hack clock ticks on its rising edge. Every module with a Keyboard part gets an
+ * input key, the code of the key pressed, which the Keyboard module passes on.
+ */
+func (l *Loader) WriteVerilog(w io.Writer, chip *Chip, dir string) error {
+	var order []*Chip
+	seen := map[string]bool{}
+	var collect func(chip *Chip, stack []string) error
+	collect = func(chip *Chip, stack []string) error {
+		name := moduleName(chip)
+		if seen[name] {
+			return nil
+		}
+		for _, parent := range stack {
+			if parent == name {
+				return &Error{chip.File, 1, fmt.Sprintf("chip %s is built from itself", name)}
+			}
+		}
+		if chip.Builtin != "" {
+			if _, err := checkBuiltin(chip); err != nil && primitives[chip.Builtin] == nil {
+				return &Error{chip.File, 1, err.Error()}
+			}
+			seen[name] = true
+			order = append(order, chip)
+			return nil
+		}
+		for _, part := range chip.Parts {
+			def, err := l.find(part.Name, dir)
+			if err != nil {
+				if _, ok := err.(*Error); ok {
+					return err
+				}
+				return &Error{chip.File, part.Line, err.Error()}
+			}
+			if err := collect(def, append(stack, name)); err != nil {
+				return err
+			}
+		}
+		seen[name] = true
+		order = append(order, chip)
+		return nil
+	}
+	if err := collect(chip, nil); err != nil {
+		return err
+	}
+	// the module writer takes well-formed chips for granted
+	for _, c := range order {
+		if err := l.check(c, dir); err != nil {
+			return err
+		}
+	}
+
+	clocked, keyed := map[string]bool{}, map[string]bool{}
+	for _, c := range order {
+		name := moduleName(c)
+		if c.Builtin != "" {
+			clocked[name] = len(builtinChipDef(c).Clocked) > 0
+			keyed[name] = c.Builtin == "Keyboard"
+			continue
+		}
+		for _, part := range c.Parts {
+			def, _ := l.find(part.Name, dir)
+			clocked[name] = clocked[name] || clocked[moduleName(def)]
+			keyed[name] = keyed[name] || keyed[moduleName(def)]
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "// %s, exported from %s\n", chip.Name, chip.File)
+	var builtins []string
+	for i := len(order) - 1; i >= 0; i-- {
+		c := order[i]
+		if c.Builtin != "" {
+			builtins = append(builtins, moduleName(c))
+			continue
+		}
+		fmt.Fprintln(out)
+		l.writeModule(out, c, dir, clocked, keyed)
+	}
+	sort.Strings(builtins)
+	for _, name := range builtins {
+		fmt.Fprintln(out)
+		fmt.Fprint(out, verilogBuiltins[name])
+	}
+	return out.Flush()
+}
+
+/*
+ * moduleName is the Verilog module implementing a chip; a chip declared
+ * BUILTIN X is implemented by module X.
+ */
+func moduleName(chip *Chip) string {
+	if chip.Builtin != "" {
+		return chip.Builtin
+	}
+	return chip.Name
+}
+
+func builtinChipDef(chip *Chip) *Chip {
+	if def, ok := primitives[chip.Builtin]; ok {
+		return def
+	}
+	return builtinChips[chip.Builtin]
+}
+
+/*
+ * verilogKeywords are the reserved words of Verilog, and of SystemVerilog, that
+ * are valid HDL names, like type in CPU.hdl.
+ */
+var verilogKeywords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`always and assign begin bit buf byte case class const default
+		else end endcase endmodule enum for function if initial inout input int integer interface logic
+		module nand negedge nor not or output parameter posedge reg string struct supply0 supply1 table
+		task time tri type union var void wait wand while wire wor xnor xor`) {
+		verilogKeywords[word] = true
+	}
+}
+
+func verilogName(name string) string {
+	if verilogKeywords[name] || name == "clk" || name == "key" {
+		return name + "_"
+	}
+	return name
+}
+
+func vector(width int) string {
+	if width == 1 {
+		return ""
+	}
+	return fmt.Sprintf("[%d:0] ", width-1)
+}
+
+/*
+ * writeModule writes the module of an HDL chip, instantiating one module per
+ * part. Part outputs bound several times or to sub buses go through a wire of
+ * the part's own.
+ */
+func (l *Loader) writeModule(out *bufio.Writer, chip *Chip, dir string, clocked, keyed map[string]bool) {
+	var ports []string
+	if clocked[chip.Name] {
+		ports = append(ports, "input clk")
+	}
+	if keyed[chip.Name] {
+		ports = append(ports, "input [15:0] key")
+	}
+	for _, pin := range chip.Inputs {
+		ports = append(ports, "input "+vector(pin.Width)+verilogName(pin.Name))
+	}
+	for _, pin := range chip.Outputs {
+		ports = append(ports, "output "+vector(pin.Width)+verilogName(pin.Name))
+	}
+	fmt.Fprintf(out, "module %s (\n    %s\n);\n", chip.Name, strings.Join(ports, ",\n    "))
+
+	widths := map[string]int{}
+	for _, pin := range chip.Inputs {
+		widths[pin.Name] = pin.Width
+	}
+	for _, pin := range chip.Outputs {
+		widths[pin.Name] = pin.Width
+	}
+	defs := make([]*Chip, len(chip.Parts))
+	for i, part := range chip.Parts {
+		defs[i], _ = l.find(part.Name, dir)
+		for _, c := range part.Connections {
+			pin, isOutput := findPin(defs[i].Outputs, c.Pin.Name)
+			if _, known := widths[c.Signal.Name]; isOutput && !known {
+				lo, hi, _ := span(c.Pin, pin.Width)
+				widths[c.Signal.Name] = hi - lo + 1
+				fmt.Fprintf(out, "    wire %s%s;\n", vector(hi-lo+1), verilogName(c.Signal.Name))
+			}
+		}
+	}
+
+	for i, part := range chip.Parts {
+		def := defs[i]
+		instance := fmt.Sprintf("part%d", i)
+		var bindings, assigns []string
+		if clocked[moduleName(def)] {
+			bindings = append(bindings, ".clk(clk)")
+		}
+		if keyed[moduleName(def)] {
+			bindings = append(bindings, ".key(key)")
+		}
+		for _, pin := range def.Inputs {
+			bindings = append(bindings, fmt.Sprintf(".%s(%s)", pin.Name, inputExpression(part, pin, widths)))
+		}
+		for _, pin := range def.Outputs {
+			var targets []Connection
+			for _, c := range part.Connections {
+				if c.Pin.Name == pin.Name {
+					targets = append(targets, c)
+				}
+			}
+			switch {
+			case len(targets) == 0:
+				bindings = append(bindings, fmt.Sprintf(".%s()", pin.Name))
+			case len(targets) == 1 && !targets[0].Pin.Sliced && !targets[0].Signal.Sliced &&
+				widths[targets[0].Signal.Name] == pin.Width:
+				bindings = append(bindings, fmt.Sprintf(".%s(%s)", pin.Name, verilogName(targets[0].Signal.Name)))
+			default:
+				wire := instance + "_" + pin.Name
+				fmt.Fprintf(out, "    wire %s%s;\n", vector(pin.Width), wire)
+				bindings = append(bindings, fmt.Sprintf(".%s(%s)", pin.Name, wire))
+				for _, c := range targets {
+					lo, hi, _ := span(c.Pin, pin.Width)
+					assigns = append(assigns, fmt.Sprintf("    assign %s = %s;\n",
+						busExpression(c.Signal, widths[c.Signal.Name]), slice(wire, pin.Width, lo, hi)))
+				}
+			}
+		}
+		fmt.Fprintf(out, "    %s %s (%s);\n", moduleName(def), instance, strings.Join(bindings, ", "))
+		for _, assign := range assigns {
+			out.WriteString(assign)
+		}
+	}
+	fmt.Fprintln(out, "endmodule")
+}
+
+/*
+ * inputExpression is the value fed to an input pin of a part: a signal, or a
+ * concatenation of the sub buses bound to it with unbound bits reading 0.
+ */
+func inputExpression(part Part, pin Pin, widths map[string]int) string {
+	type piece struct {
+		lo, hi int
+		value  string
+	}
+	var pieces []piece
+	for _, c := range part.Connections {
+		if c.Pin.Name != pin.Name {
+			continue
+		}
+		lo, hi, _ := span(c.Pin, pin.Width)
+		value := ""
+		switch c.Signal.Name {
+		case "true":
+			value = fmt.Sprintf("%d'b%s", hi-lo+1, strings.Repeat("1", hi-lo+1))
+		case "false":
+			value = fmt.Sprintf("%d'b0", hi-lo+1)
+		default:
+			value = busExpression(c.Signal, widths[c.Signal.Name])
+		}
+		pieces = append(pieces, piece{lo, hi, value})
+	}
+	sort.Slice(pieces, func(i, j int) bool { return pieces[i].lo < pieces[j].lo })
+	if len(pieces) == 1 && pieces[0].lo == 0 && pieces[0].hi == pin.Width-1 {
+		return pieces[0].value
+	}
+	var values []string
+	next := 0
+	for _, p := range pieces {
+		if p.lo > next {
+			values = append(values, fmt.Sprintf("%d'b0", p.lo-next))
+		}
+		values = append(values, p.value)
+		next = p.hi + 1
+	}
+	if next < pin.Width {
+		values = append(values, fmt.Sprintf("%d'b0", pin.Width-next))
+	}
+	// Verilog concatenations list the most significant part first
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
+	}
+	return "{" + strings.Join(values, ", ") + "}"
+}
+
+func busExpression(bus Bus, width int) string {
+	lo, hi, _ := span(bus, width)
+	return slice(verilogName(bus.Name), width, lo, hi)
+}
+
+func slice(name string, width, lo, hi int) string {
+	switch {
+	case lo == 0 && hi == width-1:
+		return name
+	case lo == hi:
+		return fmt.Sprintf("%s[%d]", name, lo)
+	}
+	return fmt.Sprintf("%s[%d:%d]", name, hi, lo)
+}
+
+/*
+ * WriteVerilog writes the flattened circuit as one Verilog module over a vector
+ * of nodes n_: a continuous assignment per Nand gate, a register per DFF and an
+ * instance per builtin part, whose modules follow. A Keyboard part reads the
+ * input key.
+ */
+func (c *Circuit) WriteVerilog(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "// %s, flattened from %s: %d Nand, %d DFF\n\n", c.Chip.Name, c.Chip.File, len(c.nands), len(c.dffs))
+	ports := []string{"input clk"}
+	for _, part := range c.parts {
+		if part.chip.Name == "Keyboard" {
+			ports = append(ports, "input [15:0] key")
+			break
+		}
+	}
+	for _, pin := range c.Chip.Inputs {
+		ports = append(ports, "input "+vector(pin.Width)+verilogName(pin.Name))
+	}
+	for _, pin := range c.Chip.Outputs {
+		ports = append(ports, "output "+vector(pin.Width)+verilogName(pin.Name))
+	}
+	fmt.Fprintf(out, "module %s (\n    %s\n);\n", c.Chip.Name, strings.Join(ports, ",\n    "))
+	fmt.Fprintf(out, "    wire [%d:0] n_;\n", len(c.values)-1)
+
+	node := func(n int32) string { return fmt.Sprintf("n_[%d]", n) }
+	nodes := func(list []int32) string {
+		var names []string
+		for i := len(list) - 1; i >= 0; i-- {
+			names = append(names, node(list[i]))
+		}
+		if len(names) == 1 {
+			return names[0]
+		}
+		return "{" + strings.Join(names, ", ") + "}"
+	}
+	driven := map[int32]bool{falseNode: true, trueNode: true}
+	fmt.Fprintf(out, "    assign %s = 1'b0;\n    assign %s = 1'b1;\n", node(falseNode), node(trueNode))
+	for _, pin := range c.Chip.Inputs {
+		for i, n := range c.pins[pin.Name] {
+			if !driven[n] {
+				driven[n] = true
+				fmt.Fprintf(out, "    assign %s = %s;\n", node(n), slice(verilogName(pin.Name), pin.Width, i, i))
+			}
+		}
+	}
+	for _, g := range c.nands {
+		driven[g.out] = true
+		fmt.Fprintf(out, "    assign %s = ~(%s & %s);\n", node(g.out), node(g.a), node(g.b))
+	}
+	if len(c.dffs) > 0 {
+		fmt.Fprintf(out, "    reg [%d:0] q_ = 0;\n", len(c.dffs)-1)
+		fmt.Fprintln(out, "    always @(posedge clk) begin")
+		for i, d := range c.dffs {
+			fmt.Fprintf(out, "        q_[%d] <= %s;\n", i, node(d.in))
+		}
+		fmt.Fprintln(out, "    end")
+		for i, d := range c.dffs {
+			driven[d.out] = true
+			fmt.Fprintf(out, "    assign %s = q_[%d];\n", node(d.out), i)
+		}
+	}
+	modules := map[string]bool{}
+	for i, part := range c.parts {
+		modules[part.chip.Name] = true
+		var bindings []string
+		if len(part.chip.Clocked) > 0 {
+			bindings = append(bindings, ".clk(clk)")
+		}
+		if part.chip.Name == "Keyboard" {
+			bindings = append(bindings, ".key(key)")
+		}
+		for _, pin := range part.chip.Inputs {
+			bindings = append(bindings, fmt.Sprintf(".%s(%s)", pin.Name, nodes(part.pins[pin.Name])))
+		}
+		for _, pin := range part.chip.Outputs {
+			for _, n := range part.pins[pin.Name] {
+				driven[n] = true
+			}
+			bindings = append(bindings, fmt.Sprintf(".%s(%s)", pin.Name, nodes(part.pins[pin.Name])))
+		}
+		fmt.Fprintf(out, "    %s part%d (%s);\n", part.chip.Name, i, strings.Join(bindings, ", "))
+	}
+	for _, pin := range c.Chip.Outputs {
+		for _, n := range c.pins[pin.Name] {
+			if !driven[n] {
+				// an output no part drives reads as false
+				driven[n] = true
+				fmt.Fprintf(out, "    assign %s = 1'b0;\n", node(n))
+			}
+		}
+		fmt.Fprintf(out, "    assign %s = %s;\n", verilogName(pin.Name), nodes(c.pins[pin.Name]))
+	}
+	fmt.Fprintln(out, "endmodule")
+
+	var names []string
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(out)
+		fmt.Fprint(out, verilogBuiltins[name])
+	}
+	return out.Flush()
+}
+
+/*
+ * verilogBuiltins are behavioral modules for the primitives and builtin chips.
+ * ROM32K loads its program from the file named by its FILE parameter, one
+ * 16-digit binary word per line as in a .hack file. Keyboard outputs its key
+ * input, which on a board comes from the key scanner.
+ */
+var verilogBuiltins = map[string]string{
+	"Nand": `module Nand (input a, input b, output out);
+    assign out = ~(a & b);
+endmodule
+`,
+	"DFF": `module DFF (input clk, input in, output out);
+    reg state = 0;
+    always @(posedge clk) state <= in;
+    assign out = state;
+endmodule
+`,
+	"Bit": `module Bit (input clk, input in, input load, output out);
+    reg state = 0;
+    always @(posedge clk) if (load) state <= in;
+    assign out = state;
+endmodule
+`,
+	"PC": `module PC (input clk, input [15:0] in, input load, input inc, input reset, output [15:0] out);
+    reg [15:0] state = 0;
+    always @(posedge clk)
+        if (reset) state <= 0;
+        else if (load) state <= in;
+        else if (inc) state <= state + 1;
+    assign out = state;
+endmodule
+`,
+	"ROM32K": `module ROM32K (input [14:0] address, output [15:0] out);
+    parameter FILE = "ROM32K.hack";
+    reg [15:0] words [0:32767];
+    initial $readmemb(FILE, words);
+    assign out = words[address];
+endmodule
+`,
+	"Keyboard": `module Keyboard (input [15:0] key, output [15:0] out);
+    assign out = key;
+endmodule
+`,
+	"ALU": `module ALU (input [15:0] x, input [15:0] y, input zx, input nx, input zy, input ny, input f, input no,
+        output [15:0] out, output zr, output ng);
+    wire [15:0] x1 = zx ? 16'b0 : x;
+    wire [15:0] x2 = nx ? ~x1 : x1;
+    wire [15:0] y1 = zy ? 16'b0 : y;
+    wire [15:0] y2 = ny ? ~y1 : y1;
+    wire [15:0] sum = f ? x2 + y2 : x2 & y2;
+    assign out = no ? ~sum : sum;
+    assign zr = out == 16'b0;
+    assign ng = out[15];
+endmodule
+`,
+}
+
+func init() {
+	for _, name := range []string{"Register", "ARegister", "DRegister"} {
+		verilogBuiltins[name] = fmt.Sprintf(`module %s (input clk, input [15:0] in, input load, output [15:0] out);
+    reg [15:0] state = 0;
+    always @(posedge clk) if (load) state <= in;
+    assign out = state;
+endmodule
+`, name)
+	}
+	for _, ram := range []struct {
+		name  string
+		width int
+	}{{"RAM8", 3}, {"RAM64", 6}, {"RAM512", 9}, {"RAM4K", 12}, {"RAM16K", 14}, {"Screen", 13}} {
+		verilogBuiltins[ram.name] = fmt.Sprintf(`module %s (input clk, input [15:0] in, input load, input [%d:0] address, output [15:0] out);
+    reg [15:0] words [0:%d];
+    always @(posedge clk) if (load) words[address] <= in;
+    assign out = words[address];
+endmodule
+`, ram.name, ram.width-1, 1<<uint(ram.width)-1)
+	}
+}
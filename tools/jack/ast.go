@@ -0,0 +1,178 @@
+package jack
+
+/*
+ * The AST mirrors the Jack grammar closely enough to reproduce the official
+ * parse tree XML: every node keeps the names, types and operators it was built
+ * from, and its position for error reporting.
+ */
+
+type Class struct {
+	Name        string
+	Vars        []*ClassVarDec
+	Subroutines []*Subroutine
+	Pos         Pos
+}
+
+/*
+ * ClassVarDec is `static|field type name, name, ...;`.
+ */
+type ClassVarDec struct {
+	Kind  string
+	Type  string
+	Names []string
+	Pos   Pos
+}
+
+/*
+ * Subroutine is a constructor, function or method declaration with its body.
+ */
+type Subroutine struct {
+	Kind       string
+	ReturnType string
+	Name       string
+	Params     []*Param
+	Locals     []*VarDec
+	Body       []Statement
+	Pos        Pos
+	End        Pos
+}
+
+type Param struct {
+	Type string
+	Name string
+	Pos  Pos
+}
+
+/*
+ * VarDec is `var type name, name, ...;`.
+ */
+type VarDec struct {
+	Type  string
+	Names []string
+	Pos   Pos
+}
+
+type Statement interface {
+	Position() Pos
+}
+
+/*
+ * LetStatement is `let name = value;` or `let name[index] = value;`.
+ */
+type LetStatement struct {
+	Name  string
+	Index *Expression
+	Value *Expression
+	Pos   Pos
+}
+
+type IfStatement struct {
+	Condition *Expression
+	Then      []Statement
+	Else      []Statement
+	HasElse   bool
+	Pos       Pos
+}
+
+type WhileStatement struct {
+	Condition *Expression
+	Body      []Statement
+	Pos       Pos
+}
+
+type DoStatement struct {
+	Call *CallTerm
+	Pos  Pos
+}
+
+type ReturnStatement struct {
+	Value *Expression
+	Pos   Pos
+}
+
+func (s *LetStatement) Position() Pos    { return s.Pos }
+func (s *IfStatement) Position() Pos     { return s.Pos }
+func (s *WhileStatement) Position() Pos  { return s.Pos }
+func (s *DoStatement) Position() Pos     { return s.Pos }
+func (s *ReturnStatement) Position() Pos { return s.Pos }
+
+/*
+ * Expression is term (op term)*. Jack has no operator precedence, so the terms
+ * are combined strictly from left to right: Ops[i] joins Terms[i] and Terms[i+1].
+ */
+type Expression struct {
+	Terms []Term
+	Ops   []string
+	Pos   Pos
+}
+
+type Term interface {
+	Position() Pos
+}
+
+type IntegerConstant struct {
+	Value int
+	Pos   Pos
+}
+
+type StringConstant struct {
+	Value string
+	Pos   Pos
+}
+
+/*
+ * KeywordConstant is true, false, null or this.
+ */
+type KeywordConstant struct {
+	Value string
+	Pos   Pos
+}
+
+type VarTerm struct {
+	Name string
+	Pos  Pos
+}
+
+/*
+ * IndexTerm is an array access name[index].
+ */
+type IndexTerm struct {
+	Name  string
+	Index *Expression
+	Pos   Pos
+}
+
+/*
+ * CallTerm is a subroutine call: name(args) or receiver.name(args), where the
+ * receiver is a class or a variable name.
+ */
+type CallTerm struct {
+	Receiver string
+	Name     string
+	Args     []*Expression
+	Pos      Pos
+}
+
+type ParenTerm struct {
+	Expression *Expression
+	Pos        Pos
+}
+
+/*
+ * UnaryTerm is -term or ~term.
+ */
+type UnaryTerm struct {
+	Op   string
+	Term Term
+	Pos  Pos
+}
+
+func (t *Expression) Position() Pos      { return t.Pos }
+func (t *IntegerConstant) Position() Pos { return t.Pos }
+func (t *StringConstant) Position() Pos  { return t.Pos }
+func (t *KeywordConstant) Position() Pos { return t.Pos }
+func (t *VarTerm) Position() Pos         { return t.Pos }
+func (t *IndexTerm) Position() Pos       { return t.Pos }
+func (t *CallTerm) Position() Pos        { return t.Pos }
+func (t *ParenTerm) Position() Pos       { return t.Pos }
+func (t *UnaryTerm) Position() Pos       { return t.Pos }
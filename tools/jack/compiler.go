@@ -0,0 +1,355 @@
+package jack
+
+import (
+	"fmt"
+
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+/*
+ * compiler generates VM code for one class, following the standard Jack OS
+ * calling convention: methods receive the object as argument 0, constructors
+ * allocate their fields with Memory.alloc, and arrays and strings are built
+ * with the Array and String classes.
+ */
+type compiler struct {
+	file       string
+	class      *Class
+	symbols    *SymbolTable
+	sub        *Subroutine
+	commands   []vm.Command
+	ifCount    int
+	whileCount int
+}
+
+type compileError struct {
+	err *Error
+}
+
+/*
+ * Compile generates the VM commands of a parsed class. file names the source in
+ * error messages.
+ */
+func Compile(file string, class *Class) (commands []vm.Command, err error) {
+	c := &compiler{file: file, class: class, symbols: NewSymbolTable()}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			commands, err = nil, e.err
+		}
+	}()
+	c.compileClass()
+	for i := range c.commands {
+		c.commands[i].File = class.Name
+		c.commands[i].Line = i + 1
+	}
+	return c.commands, nil
+}
+
+/*
+ * CompileSource parses and compiles a Jack source file.
+ */
+func CompileSource(file, source string) ([]vm.Command, error) {
+	class, err := Parse(file, source)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(file, class)
+}
+
+func (c *compiler) fail(pos Pos, format string, args ...interface{}) {
+	panic(compileError{&Error{File: c.file, Pos: pos, Message: fmt.Sprintf(format, args...)}})
+}
+
+func (c *compiler) emit(commandType vm.CommandType, command, segment string, index int) {
+	c.commands = append(c.commands, vm.Command{CommandType: commandType, Command: command, Segment: segment, Index: uint(index)})
+}
+
+func (c *compiler) push(segment string, index int) {
+	c.emit(vm.C_PUSH, "push", segment, index)
+}
+
+func (c *compiler) pop(segment string, index int) {
+	c.emit(vm.C_POP, "pop", segment, index)
+}
+
+func (c *compiler) arithmetic(command string) {
+	c.emit(vm.C_ARITHMETIC, command, "", 0)
+}
+
+func (c *compiler) label(name string) {
+	c.emit(vm.C_LABEL, "label", name, 0)
+}
+
+func (c *compiler) gotoLabel(name string) {
+	c.emit(vm.C_GOTO, "goto", name, 0)
+}
+
+func (c *compiler) ifGoto(name string) {
+	c.emit(vm.C_IF, "if-goto", name, 0)
+}
+
+func (c *compiler) call(name string, argc int) {
+	c.emit(vm.C_CALL, "call", name, argc)
+}
+
+func (c *compiler) compileClass() {
+	for _, dec := range c.class.Vars {
+		kind := STATIC
+		if dec.Kind == "field" {
+			kind = FIELD
+		}
+		for _, name := range dec.Names {
+			if !c.symbols.Define(name, dec.Type, kind) {
+				c.fail(dec.Pos, "%s already defined in class %s", name, c.class.Name)
+			}
+		}
+	}
+	seen := map[string]bool{}
+	for _, sub := range c.class.Subroutines {
+		if seen[sub.Name] {
+			c.fail(sub.Pos, "subroutine %s already defined in class %s", sub.Name, c.class.Name)
+		}
+		seen[sub.Name] = true
+		c.compileSubroutine(sub)
+	}
+}
+
+func (c *compiler) compileSubroutine(sub *Subroutine) {
+	c.sub = sub
+	c.ifCount, c.whileCount = 0, 0
+	c.symbols.StartSubroutine()
+	if sub.Kind == "method" {
+		// argument 0 is the object the method operates on
+		c.symbols.Define("this", c.class.Name, ARG)
+	}
+	for _, param := range sub.Params {
+		if !c.symbols.Define(param.Name, param.Type, ARG) {
+			c.fail(param.Pos, "parameter %s already defined", param.Name)
+		}
+	}
+	for _, dec := range sub.Locals {
+		for _, name := range dec.Names {
+			if !c.symbols.Define(name, dec.Type, VAR) {
+				c.fail(dec.Pos, "variable %s already defined", name)
+			}
+		}
+	}
+
+	c.emit(vm.C_FUNCTION, "function", c.class.Name+"."+sub.Name, c.symbols.VarCount(VAR))
+	switch sub.Kind {
+	case "constructor":
+		c.push("constant", c.symbols.VarCount(FIELD))
+		c.call("Memory.alloc", 1)
+		c.pop("pointer", 0)
+	case "method":
+		c.push("argument", 0)
+		c.pop("pointer", 0)
+	}
+	c.statements(sub.Body)
+}
+
+func (c *compiler) statements(statements []Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *LetStatement:
+			c.letStatement(s)
+		case *IfStatement:
+			c.ifStatement(s)
+		case *WhileStatement:
+			c.whileStatement(s)
+		case *DoStatement:
+			c.callTerm(s.Call)
+			// discard the return value
+			c.pop("temp", 0)
+		case *ReturnStatement:
+			if s.Value != nil {
+				if c.sub.ReturnType == "void" {
+					c.fail(s.Pos, "void %s %s returns a value", c.sub.Kind, c.sub.Name)
+				}
+				c.expression(s.Value)
+			} else {
+				if c.sub.ReturnType != "void" {
+					c.fail(s.Pos, "%s %s must return a value", c.sub.Kind, c.sub.Name)
+				}
+				c.push("constant", 0)
+			}
+			c.emit(vm.C_RETURN, "return", "", 0)
+		}
+	}
+}
+
+func (c *compiler) variable(name string, pos Pos) *Symbol {
+	symbol, ok := c.symbols.Lookup(name)
+	if !ok {
+		c.fail(pos, "undefined variable %s", name)
+	}
+	if symbol.Kind == FIELD && c.sub.Kind == "function" {
+		c.fail(pos, "field %s used in function %s", name, c.sub.Name)
+	}
+	return symbol
+}
+
+func (c *compiler) pushVariable(symbol *Symbol) {
+	c.push(kindSegments[symbol.Kind], symbol.Index)
+}
+
+func (c *compiler) letStatement(s *LetStatement) {
+	symbol := c.variable(s.Name, s.Pos)
+	if s.Index == nil {
+		c.expression(s.Value)
+		c.pop(kindSegments[symbol.Kind], symbol.Index)
+		return
+	}
+	// the value is evaluated before THAT is set, since it may use arrays itself
+	c.pushVariable(symbol)
+	c.expression(s.Index)
+	c.arithmetic("add")
+	c.expression(s.Value)
+	c.pop("temp", 0)
+	c.pop("pointer", 1)
+	c.push("temp", 0)
+	c.pop("that", 0)
+}
+
+func (c *compiler) ifStatement(s *IfStatement) {
+	n := c.ifCount
+	c.ifCount++
+	isTrue := fmt.Sprintf("IF_TRUE%d", n)
+	isFalse := fmt.Sprintf("IF_FALSE%d", n)
+	end := fmt.Sprintf("IF_END%d", n)
+
+	c.expression(s.Condition)
+	c.ifGoto(isTrue)
+	c.gotoLabel(isFalse)
+	c.label(isTrue)
+	c.statements(s.Then)
+	if s.HasElse {
+		c.gotoLabel(end)
+	}
+	c.label(isFalse)
+	if s.HasElse {
+		c.statements(s.Else)
+		c.label(end)
+	}
+}
+
+func (c *compiler) whileStatement(s *WhileStatement) {
+	n := c.whileCount
+	c.whileCount++
+	start := fmt.Sprintf("WHILE_EXP%d", n)
+	end := fmt.Sprintf("WHILE_END%d", n)
+
+	c.label(start)
+	c.expression(s.Condition)
+	c.arithmetic("not")
+	c.ifGoto(end)
+	c.statements(s.Body)
+	c.gotoLabel(start)
+	c.label(end)
+}
+
+var binaryCommands = map[string]string{
+	"+": "add",
+	"-": "sub",
+	"&": "and",
+	"|": "or",
+	"<": "lt",
+	">": "gt",
+	"=": "eq",
+}
+
+func (c *compiler) expression(expression *Expression) {
+	c.term(expression.Terms[0])
+	for i, op := range expression.Ops {
+		c.term(expression.Terms[i+1])
+		switch op {
+		case "*":
+			c.call("Math.multiply", 2)
+		case "/":
+			c.call("Math.divide", 2)
+		default:
+			c.arithmetic(binaryCommands[op])
+		}
+	}
+}
+
+func (c *compiler) term(term Term) {
+	switch t := term.(type) {
+	case *IntegerConstant:
+		c.push("constant", t.Value)
+	case *StringConstant:
+		c.push("constant", len([]rune(t.Value)))
+		c.call("String.new", 1)
+		for _, char := range t.Value {
+			c.push("constant", int(char))
+			c.call("String.appendChar", 2)
+		}
+	case *KeywordConstant:
+		switch t.Value {
+		case "true":
+			c.push("constant", 0)
+			c.arithmetic("not")
+		case "false", "null":
+			c.push("constant", 0)
+		case "this":
+			if c.sub.Kind == "function" {
+				c.fail(t.Pos, "this used in function %s", c.sub.Name)
+			}
+			c.push("pointer", 0)
+		}
+	case *VarTerm:
+		c.pushVariable(c.variable(t.Name, t.Pos))
+	case *IndexTerm:
+		c.pushVariable(c.variable(t.Name, t.Pos))
+		c.expression(t.Index)
+		c.arithmetic("add")
+		c.pop("pointer", 1)
+		c.push("that", 0)
+	case *CallTerm:
+		c.callTerm(t)
+	case *ParenTerm:
+		c.expression(t.Expression)
+	case *UnaryTerm:
+		c.term(t.Term)
+		if t.Op == "-" {
+			c.arithmetic("neg")
+		} else {
+			c.arithmetic("not")
+		}
+	}
+}
+
+/*
+ * callTerm compiles the three forms of subroutine call: f() calls a method on
+ * this, v.f() a method on the object in variable v, and C.f() a function or
+ * constructor of class C.
+ */
+func (c *compiler) callTerm(call *CallTerm) {
+	argc := len(call.Args)
+	var name string
+	switch {
+	case call.Receiver == "":
+		if c.sub.Kind == "function" {
+			c.fail(call.Pos, "method %s called from function %s; use %s.%s for a function", call.Name, c.sub.Name, c.class.Name, call.Name)
+		}
+		c.push("pointer", 0)
+		argc++
+		name = c.class.Name + "." + call.Name
+	default:
+		if symbol, ok := c.symbols.Lookup(call.Receiver); ok {
+			c.pushVariable(c.variable(call.Receiver, call.Pos))
+			argc++
+			name = symbol.Type + "." + call.Name
+		} else {
+			name = call.Receiver + "." + call.Name
+		}
+	}
+	for _, arg := range call.Args {
+		c.expression(arg)
+	}
+	c.call(name, argc)
+}
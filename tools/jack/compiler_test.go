@@ -0,0 +1,112 @@
+package jack_test
+
+import (
+	"testing"
+
+	"github.com/christopher-weiss/nand2tetris/tools/build"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/jack"
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+const point = `class Point {
+  field int x, y;
+
+  constructor Point new(int ax, int ay) {
+    let x = ax;
+    let y = ay;
+    return this;
+  }
+
+  method int getX() { return x; }
+  method int getY() { return y; }
+  method int sum() { return x + y; }
+
+  method Point plus(Point other) {
+    return Point.new(x + other.getX(), y + other.getY());
+  }
+}
+`
+
+const program = `class Main {
+  function void main() {
+    var Array out, a;
+    var Point p, q;
+    var String s;
+    var int i, total;
+    let out = 8000;
+
+    let p = Point.new(3, 4);
+    let q = p.plus(Point.new(10, -20));
+    let out[0] = p.sum();
+    let out[1] = q.getX();
+    let out[2] = q.getY();
+
+    let a = Array.new(5);
+    let i = 0;
+    while (i < 5) {
+      let a[i] = i * i;
+      let i = i + 1;
+    }
+    let total = 0;
+    let i = 0;
+    while (i < 5) {
+      let total = total + a[i];
+      let i = i + 1;
+    }
+    let out[3] = total;
+    let out[4] = a[a[2]];
+
+    let s = "Hack!";
+    let out[5] = s.length();
+    let out[6] = s.charAt(4);
+
+    let out[7] = -7 * 6;
+    let out[8] = -3 * -200;
+    let out[9] = -45 / 7;
+    let out[10] = 45 / -7;
+    let out[11] = -45 / -7;
+    let out[12] = -32767 / 2;
+    let out[13] = 32000 / 3;
+    return;
+  }
+}
+`
+
+/*
+ * TestCompiledProgram compiles a program, links it with the Jack OS and runs
+ * it, checking the values it stores from RAM[8000] on: objects built by a
+ * constructor and used through methods, an array, a string constant and
+ * multiplication and division with negative operands.
+ */
+func TestCompiledProgram(t *testing.T) {
+	var commands []vm.Command
+	for name, source := range map[string]string{"Point.jack": point, "Main.jack": program} {
+		compiled, err := jack.CompileSource(name, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, compiled...)
+	}
+	linked, _, err := build.LinkMapped(commands, vm.ProgramFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := build.Assemble(linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := cpu.ParseWords(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cpu.New(words)
+	c.Run(2000000)
+
+	want := []int16{7, 13, -16, 30, 16, 5, '!', -42, 600, -6, -6, 6, -16383, 10666}
+	for i, value := range want {
+		if got := c.RAM[8000+i]; got != value {
+			t.Errorf("out[%d] is %d, want %d", i, got, value)
+		}
+	}
+}
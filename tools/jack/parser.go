@@ -0,0 +1,387 @@
+package jack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ * parser is a recursive-descent parser over the token stream, one method per
+ * grammar rule. The first syntax error aborts the parse.
+ */
+type parser struct {
+	file   string
+	tokens []Token
+	pos    int
+}
+
+type syntaxError struct {
+	err *Error
+}
+
+/*
+ * Parse tokenizes and parses a Jack source file into its class.
+ */
+func Parse(file, source string) (*Class, error) {
+	tokens, err := Tokenize(file, source)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTokens(file, tokens)
+}
+
+/*
+ * ParseTokens parses a token stream produced by Tokenize.
+ */
+func ParseTokens(file string, tokens []Token) (class *Class, err error) {
+	p := &parser{file: file, tokens: tokens}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(syntaxError)
+			if !ok {
+				panic(r)
+			}
+			class, err = nil, e.err
+		}
+	}()
+	class = p.class()
+	if p.peek().Type != EOF {
+		p.fail("expected end of file after class, found %s", p.peek())
+	}
+	return class, nil
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() Token {
+	token := p.tokens[p.pos]
+	if token.Type != EOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(syntaxError{&Error{File: p.file, Pos: p.peek().Pos, Message: fmt.Sprintf(format, args...)}})
+}
+
+/*
+ * is reports whether the next token is the given keyword or symbol.
+ */
+func (p *parser) is(text string) bool {
+	token := p.peek()
+	return (token.Type == KEYWORD || token.Type == SYMBOL) && token.Text == text
+}
+
+/*
+ * expect consumes one of the given keywords or symbols.
+ */
+func (p *parser) expect(texts ...string) Token {
+	for _, text := range texts {
+		if p.is(text) {
+			return p.next()
+		}
+	}
+	p.fail("expected %s, found %s", quoteAll(texts), p.peek())
+	return Token{}
+}
+
+func (p *parser) identifier(what string) Token {
+	if p.peek().Type != IDENTIFIER {
+		p.fail("expected %s, found %s", what, p.peek())
+	}
+	return p.next()
+}
+
+func quoteAll(texts []string) string {
+	quoted := make([]string, len(texts))
+	for i, text := range texts {
+		quoted[i] = "'" + text + "'"
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+/*
+ * class: 'class' className '{' classVarDec* subroutineDec* '}'
+ */
+func (p *parser) class() *Class {
+	class := &Class{Pos: p.expect("class").Pos}
+	class.Name = p.identifier("class name").Text
+	p.expect("{")
+	for p.is("static") || p.is("field") {
+		class.Vars = append(class.Vars, p.classVarDec())
+	}
+	for p.is("constructor") || p.is("function") || p.is("method") {
+		class.Subroutines = append(class.Subroutines, p.subroutineDec())
+	}
+	p.expect("}")
+	return class
+}
+
+/*
+ * classVarDec: ('static'|'field') type varName (',' varName)* ';'
+ */
+func (p *parser) classVarDec() *ClassVarDec {
+	kind := p.expect("static", "field")
+	dec := &ClassVarDec{Kind: kind.Text, Pos: kind.Pos}
+	dec.Type = p.typeName(false)
+	dec.Names = p.varNames()
+	return dec
+}
+
+/*
+ * varNames: varName (',' varName)* ';'
+ */
+func (p *parser) varNames() []string {
+	names := []string{p.identifier("variable name").Text}
+	for p.is(",") {
+		p.next()
+		names = append(names, p.identifier("variable name").Text)
+	}
+	p.expect(";")
+	return names
+}
+
+/*
+ * type: 'int'|'char'|'boolean'|className, plus 'void' for return types.
+ */
+func (p *parser) typeName(allowVoid bool) string {
+	token := p.peek()
+	if token.Type == IDENTIFIER {
+		return p.next().Text
+	}
+	if allowVoid {
+		return p.expect("int", "char", "boolean", "void").Text
+	}
+	return p.expect("int", "char", "boolean").Text
+}
+
+/*
+ * subroutineDec: ('constructor'|'function'|'method') ('void'|type) subroutineName
+ *                '(' parameterList ')' subroutineBody
+ */
+func (p *parser) subroutineDec() *Subroutine {
+	kind := p.expect("constructor", "function", "method")
+	sub := &Subroutine{Kind: kind.Text, Pos: kind.Pos}
+	sub.ReturnType = p.typeName(true)
+	sub.Name = p.identifier("subroutine name").Text
+	p.expect("(")
+	if !p.is(")") {
+		for {
+			param := &Param{Pos: p.peek().Pos}
+			param.Type = p.typeName(false)
+			param.Name = p.identifier("parameter name").Text
+			sub.Params = append(sub.Params, param)
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	p.expect(")")
+
+	// subroutineBody: '{' varDec* statements '}'
+	p.expect("{")
+	for p.is("var") {
+		dec := &VarDec{Pos: p.next().Pos}
+		dec.Type = p.typeName(false)
+		dec.Names = p.varNames()
+		sub.Locals = append(sub.Locals, dec)
+	}
+	sub.Body = p.statements()
+	sub.End = p.expect("}").Pos
+	return sub
+}
+
+/*
+ * statements: statement*
+ */
+func (p *parser) statements() []Statement {
+	var statements []Statement
+	for {
+		switch {
+		case p.is("let"):
+			statements = append(statements, p.letStatement())
+		case p.is("if"):
+			statements = append(statements, p.ifStatement())
+		case p.is("while"):
+			statements = append(statements, p.whileStatement())
+		case p.is("do"):
+			statements = append(statements, p.doStatement())
+		case p.is("return"):
+			statements = append(statements, p.returnStatement())
+		case p.is("}"):
+			return statements
+		default:
+			p.fail("expected statement or '}', found %s", p.peek())
+		}
+	}
+}
+
+/*
+ * letStatement: 'let' varName ('[' expression ']')? '=' expression ';'
+ */
+func (p *parser) letStatement() *LetStatement {
+	statement := &LetStatement{Pos: p.expect("let").Pos}
+	statement.Name = p.identifier("variable name").Text
+	if p.is("[") {
+		p.next()
+		statement.Index = p.expression()
+		p.expect("]")
+	}
+	p.expect("=")
+	statement.Value = p.expression()
+	p.expect(";")
+	return statement
+}
+
+/*
+ * ifStatement: 'if' '(' expression ')' '{' statements '}' ('else' '{' statements '}')?
+ */
+func (p *parser) ifStatement() *IfStatement {
+	statement := &IfStatement{Pos: p.expect("if").Pos}
+	p.expect("(")
+	statement.Condition = p.expression()
+	p.expect(")")
+	p.expect("{")
+	statement.Then = p.statements()
+	p.expect("}")
+	if p.is("else") {
+		p.next()
+		statement.HasElse = true
+		p.expect("{")
+		statement.Else = p.statements()
+		p.expect("}")
+	}
+	return statement
+}
+
+/*
+ * whileStatement: 'while' '(' expression ')' '{' statements '}'
+ */
+func (p *parser) whileStatement() *WhileStatement {
+	statement := &WhileStatement{Pos: p.expect("while").Pos}
+	p.expect("(")
+	statement.Condition = p.expression()
+	p.expect(")")
+	p.expect("{")
+	statement.Body = p.statements()
+	p.expect("}")
+	return statement
+}
+
+/*
+ * doStatement: 'do' subroutineCall ';'
+ */
+func (p *parser) doStatement() *DoStatement {
+	statement := &DoStatement{Pos: p.expect("do").Pos}
+	name := p.identifier("subroutine call")
+	statement.Call = p.subroutineCall(name)
+	p.expect(";")
+	return statement
+}
+
+/*
+ * returnStatement: 'return' expression? ';'
+ */
+func (p *parser) returnStatement() *ReturnStatement {
+	statement := &ReturnStatement{Pos: p.expect("return").Pos}
+	if !p.is(";") {
+		statement.Value = p.expression()
+	}
+	p.expect(";")
+	return statement
+}
+
+const binaryOps = "+-*/&|<>="
+
+/*
+ * expression: term (op term)*
+ */
+func (p *parser) expression() *Expression {
+	expression := &Expression{Pos: p.peek().Pos}
+	expression.Terms = append(expression.Terms, p.term())
+	for p.peek().Type == SYMBOL && strings.Contains(binaryOps, p.peek().Text) {
+		expression.Ops = append(expression.Ops, p.next().Text)
+		expression.Terms = append(expression.Terms, p.term())
+	}
+	return expression
+}
+
+/*
+ * term: integerConstant | stringConstant | keywordConstant | varName |
+ *       varName '[' expression ']' | subroutineCall | '(' expression ')' | unaryOp term
+ */
+func (p *parser) term() Term {
+	token := p.peek()
+	switch token.Type {
+	case INT_CONST:
+		p.next()
+		value, _ := strconv.Atoi(token.Text)
+		return &IntegerConstant{Value: value, Pos: token.Pos}
+	case STRING_CONST:
+		p.next()
+		return &StringConstant{Value: token.Text, Pos: token.Pos}
+	case KEYWORD:
+		switch token.Text {
+		case "true", "false", "null", "this":
+			p.next()
+			return &KeywordConstant{Value: token.Text, Pos: token.Pos}
+		}
+	case IDENTIFIER:
+		p.next()
+		switch {
+		case p.is("["):
+			p.next()
+			term := &IndexTerm{Name: token.Text, Index: p.expression(), Pos: token.Pos}
+			p.expect("]")
+			return term
+		case p.is("(") || p.is("."):
+			return p.subroutineCall(token)
+		}
+		return &VarTerm{Name: token.Text, Pos: token.Pos}
+	case SYMBOL:
+		switch token.Text {
+		case "(":
+			p.next()
+			term := &ParenTerm{Expression: p.expression(), Pos: token.Pos}
+			p.expect(")")
+			return term
+		case "-", "~":
+			p.next()
+			return &UnaryTerm{Op: token.Text, Term: p.term(), Pos: token.Pos}
+		}
+	}
+	p.fail("expected expression, found %s", token)
+	return nil
+}
+
+/*
+ * subroutineCall: subroutineName '(' expressionList ')' |
+ *                 (className|varName) '.' subroutineName '(' expressionList ')'
+ * The first name has already been consumed.
+ */
+func (p *parser) subroutineCall(first Token) *CallTerm {
+	call := &CallTerm{Name: first.Text, Pos: first.Pos}
+	if p.is(".") {
+		p.next()
+		call.Receiver = first.Text
+		call.Name = p.identifier("subroutine name").Text
+	}
+	p.expect("(")
+	if !p.is(")") {
+		call.Args = append(call.Args, p.expression())
+		for p.is(",") {
+			p.next()
+			call.Args = append(call.Args, p.expression())
+		}
+	}
+	p.expect(")")
+	return call
+}
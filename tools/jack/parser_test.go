@@ -0,0 +1,45 @@
+package jack
+
+import "testing"
+
+/*
+ * TestErrors feeds the analyzer bad tokens and bad syntax and checks that the
+ * first error is reported as file:line:column: message, the column being that
+ * of the offending token.
+ */
+func TestErrors(t *testing.T) {
+	for _, test := range []struct {
+		source, err string
+	}{
+		// tokens
+		{"class Main {\n  /* never closed\n}\n",
+			"Main.jack:2:3: unterminated comment"},
+		{"class Main {\n  function void main() {\n    do f(40000);\n  }\n}\n",
+			"Main.jack:3:10: integer constant 40000 out of range (0..32767)"},
+		{"class Main {\n  field String s;\n  method void m() { let s = \"open\n; }\n}\n",
+			"Main.jack:3:29: unterminated string constant"},
+		{"class Main {\n  field int x;\n  # \n}\n",
+			"Main.jack:3:3: unexpected character '#'"},
+		// syntax
+		{"class Main {\n  function void main() {\n    let x 1;\n  }\n}\n",
+			"Main.jack:3:11: expected '=', found '1'"},
+		{"class Main {\n  function void main() {\n    let x = ;\n  }\n}\n",
+			"Main.jack:3:13: expected expression, found ';'"},
+		{"class Main {\n  function void main() {\n    x = 1;\n  }\n}\n",
+			"Main.jack:3:5: expected statement or '}', found 'x'"},
+		{"class Main {\n  function main() { return; }\n}\n",
+			"Main.jack:2:16: expected subroutine name, found '('"},
+		{"class Main {\n}\nclass Other {\n}\n",
+			"Main.jack:3:1: expected end of file after class, found 'class'"},
+		{"class Main {\n  function void main() {\n    return;\n  }\n",
+			"Main.jack:5:1: expected '}', found end of file"},
+	} {
+		tokens, err := Tokenize("Main.jack", test.source)
+		if err == nil {
+			_, err = ParseTokens("Main.jack", tokens)
+		}
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: error %v, want %s", test.source, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package jack
+
+type Kind int
+
+const (
+	STATIC Kind = iota
+	FIELD
+	ARG
+	VAR
+)
+
+/*
+ * Segments the variables of each kind live in.
+ */
+var kindSegments = map[Kind]string{
+	STATIC: "static",
+	FIELD:  "this",
+	ARG:    "argument",
+	VAR:    "local",
+}
+
+type Symbol struct {
+	Name  string
+	Type  string
+	Kind  Kind
+	Index int
+}
+
+/*
+ * SymbolTable holds the class scope (static and field variables) and the scope
+ * of the subroutine being compiled (arguments and locals), which shadows it.
+ */
+type SymbolTable struct {
+	class      map[string]*Symbol
+	subroutine map[string]*Symbol
+	counts     map[Kind]int
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		class:      map[string]*Symbol{},
+		subroutine: map[string]*Symbol{},
+		counts:     map[Kind]int{},
+	}
+}
+
+/*
+ * StartSubroutine clears the subroutine scope.
+ */
+func (t *SymbolTable) StartSubroutine() {
+	t.subroutine = map[string]*Symbol{}
+	t.counts[ARG] = 0
+	t.counts[VAR] = 0
+}
+
+/*
+ * Define adds a variable and assigns it the next index of its kind. It returns
+ * false if the name is already defined in the same scope.
+ */
+func (t *SymbolTable) Define(name, typeName string, kind Kind) bool {
+	scope := t.subroutine
+	if kind == STATIC || kind == FIELD {
+		scope = t.class
+	}
+	if _, exists := scope[name]; exists {
+		return false
+	}
+	scope[name] = &Symbol{Name: name, Type: typeName, Kind: kind, Index: t.counts[kind]}
+	t.counts[kind]++
+	return true
+}
+
+/*
+ * Lookup finds a variable, looking in the subroutine scope first.
+ */
+func (t *SymbolTable) Lookup(name string) (*Symbol, bool) {
+	if symbol, ok := t.subroutine[name]; ok {
+		return symbol, true
+	}
+	symbol, ok := t.class[name]
+	return symbol, ok
+}
+
+/*
+ * VarCount returns the number of variables of kind defined so far.
+ */
+func (t *SymbolTable) VarCount(kind Kind) int {
+	return t.counts[kind]
+}
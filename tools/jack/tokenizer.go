@@ -0,0 +1,172 @@
+package jack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type TokenType int
+
+const (
+	KEYWORD TokenType = iota
+	SYMBOL
+	INT_CONST
+	STRING_CONST
+	IDENTIFIER
+	EOF
+)
+
+/*
+ * Names of the token types as used by the XML output.
+ */
+var tokenTypeNames = map[TokenType]string{
+	KEYWORD:      "keyword",
+	SYMBOL:       "symbol",
+	INT_CONST:    "integerConstant",
+	STRING_CONST: "stringConstant",
+	IDENTIFIER:   "identifier",
+	EOF:          "end of file",
+}
+
+func (t TokenType) String() string {
+	return tokenTypeNames[t]
+}
+
+var keywords = map[string]bool{
+	"class": true, "constructor": true, "function": true, "method": true,
+	"field": true, "static": true, "var": true,
+	"int": true, "char": true, "boolean": true, "void": true,
+	"true": true, "false": true, "null": true, "this": true,
+	"let": true, "do": true, "if": true, "else": true, "while": true, "return": true,
+}
+
+const symbols = "{}()[].,;+-*/&|<>=~"
+
+/*
+ * Pos is a position in a source file; lines and columns start at 1.
+ */
+type Pos struct {
+	Line   int
+	Column int
+}
+
+type Token struct {
+	Type TokenType
+	Text string
+	Pos  Pos
+}
+
+func (t Token) String() string {
+	switch t.Type {
+	case EOF:
+		return "end of file"
+	case STRING_CONST:
+		return strconv.Quote(t.Text)
+	}
+	return fmt.Sprintf("'%s'", t.Text)
+}
+
+/*
+ * Error is a tokenizer, parser or compiler error at a source position.
+ */
+type Error struct {
+	File    string
+	Pos     Pos
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Pos.Line, e.Pos.Column, e.Message)
+}
+
+/*
+ * Tokenize splits Jack source into tokens, dropping whitespace and comments.
+ * The returned slice always ends with an EOF token.
+ */
+func Tokenize(file, source string) ([]Token, error) {
+	var tokens []Token
+	runes := []rune(source)
+	line, column := 1, 1
+	i := 0
+
+	advance := func() {
+		if runes[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+		i++
+	}
+	fail := func(pos Pos, format string, args ...interface{}) ([]Token, error) {
+		return nil, &Error{File: file, Pos: pos, Message: fmt.Sprintf(format, args...)}
+	}
+
+	for i < len(runes) {
+		r := runes[i]
+		pos := Pos{Line: line, Column: column}
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			advance()
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				advance()
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			advance()
+			advance()
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				advance()
+			}
+			if i >= len(runes) {
+				return fail(pos, "unterminated comment")
+			}
+			advance()
+			advance()
+		case strings.ContainsRune(symbols, r):
+			tokens = append(tokens, Token{Type: SYMBOL, Text: string(r), Pos: pos})
+			advance()
+		case r >= '0' && r <= '9':
+			start := i
+			for i < len(runes) && runes[i] >= '0' && runes[i] <= '9' {
+				advance()
+			}
+			text := string(runes[start:i])
+			if value, err := strconv.Atoi(text); err != nil || value > 32767 {
+				return fail(pos, "integer constant %s out of range (0..32767)", text)
+			}
+			tokens = append(tokens, Token{Type: INT_CONST, Text: text, Pos: pos})
+		case r == '"':
+			advance()
+			start := i
+			for i < len(runes) && runes[i] != '"' && runes[i] != '\n' {
+				advance()
+			}
+			if i >= len(runes) || runes[i] != '"' {
+				return fail(pos, "unterminated string constant")
+			}
+			tokens = append(tokens, Token{Type: STRING_CONST, Text: string(runes[start:i]), Pos: pos})
+			advance()
+		case isIdentifierStart(r):
+			start := i
+			for i < len(runes) && (isIdentifierStart(runes[i]) || (runes[i] >= '0' && runes[i] <= '9')) {
+				advance()
+			}
+			text := string(runes[start:i])
+			tokenType := IDENTIFIER
+			if keywords[text] {
+				tokenType = KEYWORD
+			}
+			tokens = append(tokens, Token{Type: tokenType, Text: text, Pos: pos})
+		default:
+			return fail(pos, "unexpected character %q", r)
+		}
+	}
+	tokens = append(tokens, Token{Type: EOF, Pos: Pos{Line: line, Column: column}})
+	return tokens, nil
+}
+
+func isIdentifierStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
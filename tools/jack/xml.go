@@ -0,0 +1,261 @@
+package jack
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+/*
+ * WriteTokensXML writes the tokens in the format of the official XxxT.xml files.
+ */
+func WriteTokensXML(w io.Writer, tokens []Token) error {
+	x := &xmlWriter{w: w}
+	x.line("<tokens>")
+	for _, token := range tokens {
+		if token.Type != EOF {
+			x.token(token.Type, token.Text)
+		}
+	}
+	x.line("</tokens>")
+	return x.err
+}
+
+/*
+ * WriteXML writes the parse tree of class in the format of the official Xxx.xml
+ * files produced by the JackAnalyzer.
+ */
+func WriteXML(w io.Writer, class *Class) error {
+	x := &xmlWriter{w: w}
+	x.open("class")
+	x.keyword("class")
+	x.identifier(class.Name)
+	x.symbol("{")
+	for _, dec := range class.Vars {
+		x.open("classVarDec")
+		x.keyword(dec.Kind)
+		x.typeName(dec.Type)
+		x.names(dec.Names)
+		x.close("classVarDec")
+	}
+	for _, sub := range class.Subroutines {
+		x.subroutine(sub)
+	}
+	x.symbol("}")
+	x.close("class")
+	return x.err
+}
+
+type xmlWriter struct {
+	w      io.Writer
+	indent int
+	err    error
+}
+
+func (x *xmlWriter) line(text string) {
+	if x.err != nil {
+		return
+	}
+	_, x.err = fmt.Fprintf(x.w, "%s%s\n", strings.Repeat("  ", x.indent), text)
+}
+
+func (x *xmlWriter) open(tag string) {
+	x.line("<" + tag + ">")
+	x.indent++
+}
+
+func (x *xmlWriter) close(tag string) {
+	x.indent--
+	x.line("</" + tag + ">")
+}
+
+func (x *xmlWriter) token(tokenType TokenType, text string) {
+	name := tokenType.String()
+	x.line(fmt.Sprintf("<%s> %s </%s>", name, xmlEscaper.Replace(text), name))
+}
+
+func (x *xmlWriter) keyword(text string)    { x.token(KEYWORD, text) }
+func (x *xmlWriter) symbol(text string)     { x.token(SYMBOL, text) }
+func (x *xmlWriter) identifier(text string) { x.token(IDENTIFIER, text) }
+
+/*
+ * typeName writes a type, which is a keyword for the primitive types and an
+ * identifier for class names.
+ */
+func (x *xmlWriter) typeName(name string) {
+	if keywords[name] {
+		x.keyword(name)
+	} else {
+		x.identifier(name)
+	}
+}
+
+/*
+ * names writes `name, name, ... ;`.
+ */
+func (x *xmlWriter) names(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			x.symbol(",")
+		}
+		x.identifier(name)
+	}
+	x.symbol(";")
+}
+
+func (x *xmlWriter) subroutine(sub *Subroutine) {
+	x.open("subroutineDec")
+	x.keyword(sub.Kind)
+	x.typeName(sub.ReturnType)
+	x.identifier(sub.Name)
+	x.symbol("(")
+	x.open("parameterList")
+	for i, param := range sub.Params {
+		if i > 0 {
+			x.symbol(",")
+		}
+		x.typeName(param.Type)
+		x.identifier(param.Name)
+	}
+	x.close("parameterList")
+	x.symbol(")")
+	x.open("subroutineBody")
+	x.symbol("{")
+	for _, dec := range sub.Locals {
+		x.open("varDec")
+		x.keyword("var")
+		x.typeName(dec.Type)
+		x.names(dec.Names)
+		x.close("varDec")
+	}
+	x.statements(sub.Body)
+	x.symbol("}")
+	x.close("subroutineBody")
+	x.close("subroutineDec")
+}
+
+func (x *xmlWriter) statements(statements []Statement) {
+	x.open("statements")
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *LetStatement:
+			x.open("letStatement")
+			x.keyword("let")
+			x.identifier(s.Name)
+			if s.Index != nil {
+				x.symbol("[")
+				x.expression(s.Index)
+				x.symbol("]")
+			}
+			x.symbol("=")
+			x.expression(s.Value)
+			x.symbol(";")
+			x.close("letStatement")
+		case *IfStatement:
+			x.open("ifStatement")
+			x.keyword("if")
+			x.symbol("(")
+			x.expression(s.Condition)
+			x.symbol(")")
+			x.symbol("{")
+			x.statements(s.Then)
+			x.symbol("}")
+			if s.HasElse {
+				x.keyword("else")
+				x.symbol("{")
+				x.statements(s.Else)
+				x.symbol("}")
+			}
+			x.close("ifStatement")
+		case *WhileStatement:
+			x.open("whileStatement")
+			x.keyword("while")
+			x.symbol("(")
+			x.expression(s.Condition)
+			x.symbol(")")
+			x.symbol("{")
+			x.statements(s.Body)
+			x.symbol("}")
+			x.close("whileStatement")
+		case *DoStatement:
+			x.open("doStatement")
+			x.keyword("do")
+			x.call(s.Call)
+			x.symbol(";")
+			x.close("doStatement")
+		case *ReturnStatement:
+			x.open("returnStatement")
+			x.keyword("return")
+			if s.Value != nil {
+				x.expression(s.Value)
+			}
+			x.symbol(";")
+			x.close("returnStatement")
+		}
+	}
+	x.close("statements")
+}
+
+func (x *xmlWriter) expression(expression *Expression) {
+	x.open("expression")
+	for i, term := range expression.Terms {
+		if i > 0 {
+			x.symbol(expression.Ops[i-1])
+		}
+		x.term(term)
+	}
+	x.close("expression")
+}
+
+func (x *xmlWriter) term(term Term) {
+	x.open("term")
+	switch t := term.(type) {
+	case *IntegerConstant:
+		x.token(INT_CONST, strconv.Itoa(t.Value))
+	case *StringConstant:
+		x.token(STRING_CONST, t.Value)
+	case *KeywordConstant:
+		x.keyword(t.Value)
+	case *VarTerm:
+		x.identifier(t.Name)
+	case *IndexTerm:
+		x.identifier(t.Name)
+		x.symbol("[")
+		x.expression(t.Index)
+		x.symbol("]")
+	case *CallTerm:
+		x.call(t)
+	case *ParenTerm:
+		x.symbol("(")
+		x.expression(t.Expression)
+		x.symbol(")")
+	case *UnaryTerm:
+		x.symbol(t.Op)
+		x.term(t.Term)
+	}
+	x.close("term")
+}
+
+/*
+ * call writes a subroutine call; the grammar has no element of its own for it.
+ */
+func (x *xmlWriter) call(call *CallTerm) {
+	if call.Receiver != "" {
+		x.identifier(call.Receiver)
+		x.symbol(".")
+	}
+	x.identifier(call.Name)
+	x.symbol("(")
+	x.open("expressionList")
+	for i, arg := range call.Args {
+		if i > 0 {
+			x.symbol(",")
+		}
+		x.expression(arg)
+	}
+	x.close("expressionList")
+	x.symbol(")")
+}
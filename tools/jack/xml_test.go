@@ -0,0 +1,210 @@
+package jack
+
+import (
+	"strings"
+	"testing"
+)
+
+/*
+ * xmlLines splits analyzer output into its elements, one per line, without
+ * the indentation and line endings, which differ between the official
+ * comparison files and ours.
+ */
+func xmlLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+/*
+ * analyze returns the token and parse tree XML of a Jack source.
+ */
+func analyze(t *testing.T, name, source string) (tokensXML, treeXML string) {
+	t.Helper()
+	tokens, err := Tokenize(name, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	class, err := ParseTokens(name, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokenOut, treeOut strings.Builder
+	if err := WriteTokensXML(&tokenOut, tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteXML(&treeOut, class); err != nil {
+		t.Fatal(err)
+	}
+	return tokenOut.String(), treeOut.String()
+}
+
+/*
+ * sameXML compares analyzer output with the expected file element by element.
+ */
+func sameXML(t *testing.T, name, got, want string) {
+	t.Helper()
+	gotLines, wantLines := xmlLines(got), xmlLines(want)
+	for i := range wantLines {
+		if i >= len(gotLines) {
+			t.Fatalf("%s: output ends at element %d, expected %s", name, i+1, wantLines[i])
+		}
+		if gotLines[i] != wantLines[i] {
+			t.Fatalf("%s: element %d is %s, expected %s", name, i+1, gotLines[i], wantLines[i])
+		}
+	}
+	if len(gotLines) > len(wantLines) {
+		t.Fatalf("%s: extra element %d: %s", name, len(wantLines)+1, gotLines[len(wantLines)])
+	}
+}
+
+/*
+ * TestWriteXML checks the analyzer output for a class that uses every kind
+ * of token, including symbols that must be escaped, against XML written out
+ * by hand in the format of the official comparison files.
+ */
+func TestWriteXML(t *testing.T) {
+	source := `// a class for the analyzer
+class Main {
+  field int x;
+  method void run() {
+    while (x < 10) {
+      let x = x + 1;
+    }
+    do Output.printString("x & y");
+    return;
+  }
+}
+`
+	wantTokens := `<tokens>
+<keyword> class </keyword>
+<identifier> Main </identifier>
+<symbol> { </symbol>
+<keyword> field </keyword>
+<keyword> int </keyword>
+<identifier> x </identifier>
+<symbol> ; </symbol>
+<keyword> method </keyword>
+<keyword> void </keyword>
+<identifier> run </identifier>
+<symbol> ( </symbol>
+<symbol> ) </symbol>
+<symbol> { </symbol>
+<keyword> while </keyword>
+<symbol> ( </symbol>
+<identifier> x </identifier>
+<symbol> &lt; </symbol>
+<integerConstant> 10 </integerConstant>
+<symbol> ) </symbol>
+<symbol> { </symbol>
+<keyword> let </keyword>
+<identifier> x </identifier>
+<symbol> = </symbol>
+<identifier> x </identifier>
+<symbol> + </symbol>
+<integerConstant> 1 </integerConstant>
+<symbol> ; </symbol>
+<symbol> } </symbol>
+<keyword> do </keyword>
+<identifier> Output </identifier>
+<symbol> . </symbol>
+<identifier> printString </identifier>
+<symbol> ( </symbol>
+<stringConstant> x &amp; y </stringConstant>
+<symbol> ) </symbol>
+<symbol> ; </symbol>
+<keyword> return </keyword>
+<symbol> ; </symbol>
+<symbol> } </symbol>
+<symbol> } </symbol>
+</tokens>
+`
+	wantTree := `<class>
+  <keyword> class </keyword>
+  <identifier> Main </identifier>
+  <symbol> { </symbol>
+  <classVarDec>
+    <keyword> field </keyword>
+    <keyword> int </keyword>
+    <identifier> x </identifier>
+    <symbol> ; </symbol>
+  </classVarDec>
+  <subroutineDec>
+    <keyword> method </keyword>
+    <keyword> void </keyword>
+    <identifier> run </identifier>
+    <symbol> ( </symbol>
+    <parameterList>
+    </parameterList>
+    <symbol> ) </symbol>
+    <subroutineBody>
+      <symbol> { </symbol>
+      <statements>
+        <whileStatement>
+          <keyword> while </keyword>
+          <symbol> ( </symbol>
+          <expression>
+            <term>
+              <identifier> x </identifier>
+            </term>
+            <symbol> &lt; </symbol>
+            <term>
+              <integerConstant> 10 </integerConstant>
+            </term>
+          </expression>
+          <symbol> ) </symbol>
+          <symbol> { </symbol>
+          <statements>
+            <letStatement>
+              <keyword> let </keyword>
+              <identifier> x </identifier>
+              <symbol> = </symbol>
+              <expression>
+                <term>
+                  <identifier> x </identifier>
+                </term>
+                <symbol> + </symbol>
+                <term>
+                  <integerConstant> 1 </integerConstant>
+                </term>
+              </expression>
+              <symbol> ; </symbol>
+            </letStatement>
+          </statements>
+          <symbol> } </symbol>
+        </whileStatement>
+        <doStatement>
+          <keyword> do </keyword>
+          <identifier> Output </identifier>
+          <symbol> . </symbol>
+          <identifier> printString </identifier>
+          <symbol> ( </symbol>
+          <expressionList>
+            <expression>
+              <term>
+                <stringConstant> x &amp; y </stringConstant>
+              </term>
+            </expression>
+          </expressionList>
+          <symbol> ) </symbol>
+          <symbol> ; </symbol>
+        </doStatement>
+        <returnStatement>
+          <keyword> return </keyword>
+          <symbol> ; </symbol>
+        </returnStatement>
+      </statements>
+      <symbol> } </symbol>
+    </subroutineBody>
+  </subroutineDec>
+  <symbol> } </symbol>
+</class>
+`
+	tokensXML, treeXML := analyze(t, "Main.jack", source)
+	sameXML(t, "MainT.xml", tokensXML, wantTokens)
+	sameXML(t, "Main.xml", treeXML, wantTree)
+}
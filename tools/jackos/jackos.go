@@ -0,0 +1,129 @@
+package jackos
+
+import (
+	"bytes"
+	"embed"
+	"sort"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+/*
+ * The OS classes ship both as Jack source and as the VM code our compiler
+ * produced from it; regenerate the .vm files with `n2t jack tools/jackos`
+ * after editing a class.
+ */
+//go:embed *.jack *.vm
+var files embed.FS
+
+/*
+ * Classes lists the OS classes, in the order Sys.init initializes them.
+ */
+var Classes = []string{"Memory", "Math", "Output", "Screen", "Keyboard", "String", "Array", "Sys"}
+
+/*
+ * Source returns the Jack source of an OS class.
+ */
+func Source(class string) (string, bool) {
+	data, err := files.ReadFile(class + ".jack")
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+/*
+ * VMSource returns the precompiled VM code of an OS class.
+ */
+func VMSource(class string) (string, bool) {
+	data, err := files.ReadFile(class + ".vm")
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+/*
+ * Commands returns the precompiled VM commands of an OS class.
+ */
+func Commands(class string) ([]vm.Command, error) {
+	data, err := files.ReadFile(class + ".vm")
+	if err != nil {
+		return nil, err
+	}
+	return vm.Parse(class+".vm", bytes.NewReader(data))
+}
+
+/*
+ * Link appends the OS classes a program needs but does not define itself: any
+ * class with a called function that is defined nowhere, plus whatever those
+ * classes call in turn. A program with Main.main but no Sys.init also gets
+ * Sys, which initializes the OS and calls Main.main. Classes the program
+ * defines always take precedence, so a project can replace part of the OS.
+ */
+func Link(commands []vm.Command) ([]vm.Command, error) {
+	defined := map[string]bool{}
+	classes := map[string]bool{}
+	for _, command := range commands {
+		if command.CommandType == vm.C_FUNCTION {
+			defined[command.Segment] = true
+			classes[className(command.Segment)] = true
+		}
+	}
+	isOS := map[string]bool{}
+	for _, class := range Classes {
+		isOS[class] = true
+	}
+
+	pending := map[string]bool{}
+	need := func(commands []vm.Command) {
+		for _, command := range commands {
+			if command.CommandType != vm.C_CALL || defined[command.Segment] {
+				continue
+			}
+			class := className(command.Segment)
+			if isOS[class] && !classes[class] {
+				pending[class] = true
+			}
+		}
+	}
+	need(commands)
+	if defined["Main.main"] && !defined["Sys.init"] && !classes["Sys"] {
+		pending["Sys"] = true
+	}
+
+	linked := append([]vm.Command(nil), commands...)
+	for len(pending) > 0 {
+		var names []string
+		for class := range pending {
+			names = append(names, class)
+		}
+		sort.Strings(names)
+		pending = map[string]bool{}
+		var library []vm.Command
+		for _, class := range names {
+			commands, err := Commands(class)
+			if err != nil {
+				return nil, err
+			}
+			classes[class] = true
+			for _, command := range commands {
+				if command.CommandType == vm.C_FUNCTION {
+					defined[command.Segment] = true
+				}
+			}
+			library = append(library, commands...)
+		}
+		linked = append(linked, library...)
+		need(library)
+	}
+	return linked, nil
+}
+
+func className(function string) string {
+	if i := strings.IndexByte(function, '.'); i >= 0 {
+		return function[:i]
+	}
+	return function
+}
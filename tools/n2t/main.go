@@ -0,0 +1,942 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christopher-weiss/nand2tetris/tools/asm"
+	"github.com/christopher-weiss/nand2tetris/tools/build"
+	"github.com/christopher-weiss/nand2tetris/tools/cover"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/debug"
+	"github.com/christopher-weiss/nand2tetris/tools/hdl"
+	"github.com/christopher-weiss/nand2tetris/tools/jack"
+	"github.com/christopher-weiss/nand2tetris/tools/tst"
+	"github.com/christopher-weiss/nand2tetris/tools/tui"
+	"github.com/christopher-weiss/nand2tetris/tools/vcd"
+	"github.com/christopher-weiss/nand2tetris/tools/vm"
+)
+
+type subcommand struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"asm", "assemble an .asm file into a .hack file", runAsm},
+		{"vm", "translate .vm files (or a directory) straight into a .hack file", runVM},
+		{"run", "run a program on the Hack emulator and print its registers", runRun},
+		{"debug", "debug a program on the Hack emulator with breakpoints and watchpoints", runDebug},
+		{"diff", "print the registers and RAM words that differ between two machine snapshots", runDiff},
+		{"play", "run a program interactively in the terminal, with its screen and keyboard", runPlay},
+		{"test", "run .tst scripts and compare their output with the .cmp files", runTest},
+		{"jack", "compile .jack files (or a directory) into .vm files", runJack},
+		{"lint", "check .hdl chips (or a directory) for wiring mistakes", runLint},
+		{"export", "export an .hdl chip as Verilog or as a Graphviz graph", runExport},
+		{"stats", "count the Nand gates and DFFs of .hdl chips and find their critical path", runStats},
+		{"check", "check .hdl chips against reference models: exhaustively, or probabilistically on random inputs", runCheck},
+		{"gen", "generate a .tst script and .cmp file for a reference chip (one n2t check knows) from its model", runGen},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, command := range subcommands {
+		if command.name == os.Args[1] {
+			if err := command.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: n2t <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, command := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-6s %s\n", command.name, command.summary)
+	}
+}
+
+/*
+ * replaceExt swaps the extension of a file name, e.g. Max.asm -> Max.hack.
+ */
+func replaceExt(name, ext string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ext
+}
+
+/*
+ * outputName is the default output for a program path: X.vm -> X<ext>, and
+ * dir -> dir/<dir><ext> for a directory of .vm files.
+ */
+func outputName(path, ext string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		clean := filepath.Clean(path)
+		return filepath.Join(clean, filepath.Base(clean)+ext)
+	}
+	return replaceExt(path, ext)
+}
+
+func runAsm(args []string) error {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	out := flags.String("o", "", "output file (default: <file>.hack)")
+	symbols := flags.Bool("symbols", false, "print the symbol table")
+	dbg := flags.Bool("dbg", false, "also write the debug info (source lines, labels, variables) to <out>.dbg")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: n2t asm [-o out.hack] [-symbols] [-dbg] <file.asm>")
+	}
+	path := flags.Arg(0)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	program, err := asm.Parse(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if *symbols {
+		program.WriteSymbolTable(os.Stdout)
+	}
+	code, err := program.Translate()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if *out == "" {
+		*out = replaceExt(path, ".hack")
+	}
+	if *dbg {
+		dbgFile := replaceExt(*out, ".dbg")
+		if err := program.DebugInfo(asm.SourceName(dbgFile, path)).WriteFile(dbgFile); err != nil {
+			return err
+		}
+	}
+	return build.WriteLines(*out, code)
+}
+
+func runVM(args []string) error {
+	flags := flag.NewFlagSet("vm", flag.ExitOnError)
+	out := flags.String("o", "", "output file (default: <file>.hack, or <dir>/<dir>.hack)")
+	keepAsm := flags.Bool("keep-asm", false, "also write the intermediate .asm next to the .hack file")
+	stackOnly := flags.Bool("stack-only", false, "accept only stack arithmetic and memory access commands (project 07)")
+	noOS := flags.Bool("no-os", false, "do not link the Jack OS classes the program calls")
+	dbg := flags.Bool("dbg", false, "also write the debug info (VM source lines, labels, variables) to <out>.dbg")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: n2t vm [-o out.hack] [-keep-asm] [-stack-only] [-no-os] [-dbg] <file.vm|dir>...")
+	}
+
+	var files []string
+	for _, path := range flags.Args() {
+		names, err := build.VMFiles(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, names...)
+	}
+	features := vm.ProgramFlow
+	if *stackOnly {
+		features = vm.StackArithmetic
+	}
+	commands, err := build.ParseVM(files)
+	if err != nil {
+		return err
+	}
+	var program []string
+	var source *vm.SourceMap
+	if *noOS {
+		program, source, err = vm.TranslateMapped(commands, features)
+	} else {
+		program, source, err = build.LinkMapped(commands, features)
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = outputName(flags.Arg(0), ".hack")
+	}
+	if *keepAsm {
+		if err := build.WriteLines(replaceExt(*out, ".asm"), program); err != nil {
+			return err
+		}
+	}
+	dbgFile := replaceExt(*out, ".dbg")
+	code, info, err := build.AssembleDebug(program, replaceExt(*out, ".asm"), source, filepath.Dir(dbgFile))
+	if err != nil {
+		return fmt.Errorf("assembling translated program: %v", err)
+	}
+	if *dbg {
+		if err := info.WriteFile(dbgFile); err != nil {
+			return err
+		}
+	}
+	return build.WriteLines(*out, code)
+}
+
+func runRun(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	cycles := flags.Uint64("cycles", 1000000, "number of instructions to execute")
+	ram := flags.String("ram", "0-15", "RAM addresses to print, e.g. 0-15,256,261")
+	trace := flags.String("vcd", "", "write the waveform of the run to this file")
+	signals := flags.String("signals", "", "what to trace, e.g. RAM[0],RAM[25?] (default: A, D, PC and the instruction; all adds RAM[0-15])")
+	log := flags.String("trace", "", "log every instruction executed to this file (- for standard output)")
+	profile := flags.Bool("profile", false, "report the cycles spent per label and at the busiest ROM addresses")
+	top := flags.Int("top", 20, "ROM addresses to list in the profile (0 for all)")
+	screen := flags.String("png", "", "write the screen at the end of the run to this PNG file")
+	golden := flags.String("golden", "", "fail unless the screen at the end of the run matches this PNG file")
+	animation := flags.String("gif", "", "record the screen as an animated GIF in this file")
+	from := flags.Uint64("from", 0, "cycle of the first GIF frame")
+	every := flags.Uint64("every", 10000, "cycles between GIF frames")
+	keys := flags.String("keys", "", "press the keys of this keyboard script")
+	load := flags.String("load", "", "start from the machine state in this snapshot file")
+	save := flags.String("save", "", "save the machine state at the end of the run to this snapshot file")
+	coverTo := flags.String("cover", "", "write the line coverage of the sources to this file (.html for HTML, - for standard output)")
+	flags.Parse(args)
+	if flags.NArg() > 1 || flags.NArg() == 0 && *load == "" {
+		return fmt.Errorf("usage: n2t run [-cycles n] [-ram list] [-keys file] [-load file] [-save file] [-vcd file] [-signals list] [-trace file] [-profile [-top n]] [-cover file] [-png file] [-golden file] [-gif file [-from n] [-every n]] <file.hack|file.asm|file.vm|file.jack|dir>")
+	}
+	if *every == 0 {
+		return fmt.Errorf("-every must be at least 1")
+	}
+	addresses, err := parseAddresses(*ram)
+	if err != nil {
+		return err
+	}
+
+	// with a snapshot, the program only names the ROM addresses
+	var program []uint16
+	var symbols build.Symbols
+	if flags.NArg() == 1 {
+		if program, symbols, err = build.HackSymbols(flags.Arg(0)); err != nil {
+			return err
+		}
+	}
+	machine := cpu.New(program)
+	if *load != "" {
+		snapshot, err := cpu.ReadSnapshot(*load)
+		if err != nil {
+			return err
+		}
+		machine.Restore(snapshot)
+	}
+	if *keys != "" {
+		if machine.Keyboard, err = cpu.ReadKeyboard(*keys); err != nil {
+			return err
+		}
+	}
+	end := machine.Cycles + *cycles
+	labels := cpu.NewLabels(symbols.Labels)
+	step := machine.Step
+	var waveform *vcd.Writer
+	var tracer *cpu.Tracer
+	if *trace != "" {
+		file, err := os.Create(*trace)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		waveform = vcd.NewWriter(file, "1 ns")
+		simulator := &tst.CPUSimulator{CPU: machine}
+		if err := simulator.Trace(waveform, splitList(*signals)); err != nil {
+			return err
+		}
+		step = func() { simulator.Exec("ticktock", nil) }
+	}
+	if *log != "" {
+		w := os.Stdout
+		if *log != "-" {
+			file, err := os.Create(*log)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		tracer = cpu.NewTracer(w, labels)
+		execute := step
+		step = func() {
+			tracer.Before(machine)
+			execute()
+			tracer.After(machine)
+		}
+	}
+	if *profile || *coverTo != "" {
+		machine.Profile = &cpu.Profile{}
+	}
+	var coverage cover.Coverage
+	if *coverTo != "" {
+		if symbols.Debug == nil {
+			return fmt.Errorf("-cover needs the debug info of the program: run its sources or assemble it with -dbg")
+		}
+		coverage.Add(machine.Profile, program, symbols.Debug.Lines, sourceDir(flags.Arg(0)))
+		if symbols.Source != nil {
+			coverage.AddVMSource(symbols.Source)
+		}
+	}
+	var frames *cpu.Animation
+	if *animation != "" {
+		// 25 frames a second
+		frames = cpu.NewAnimation(4)
+		execute := step
+		step = func() {
+			if machine.Cycles >= *from && (machine.Cycles-*from)%*every == 0 {
+				frames.Add(machine)
+			}
+			execute()
+		}
+	}
+	if *trace == "" && *log == "" && frames == nil {
+		// nothing to do between instructions: run at full speed
+		machine.Run(*cycles)
+	}
+	for machine.Cycles < end {
+		step()
+	}
+	if waveform != nil {
+		if err := waveform.Flush(); err != nil {
+			return err
+		}
+	}
+	if tracer != nil {
+		if err := tracer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if frames != nil {
+		if machine.Cycles >= *from {
+			frames.Add(machine)
+		}
+		if err := writeFile(*animation, func(w *os.File) error { return frames.Encode(w) }); err != nil {
+			return err
+		}
+	}
+	if *screen != "" {
+		if err := writeFile(*screen, func(w *os.File) error { return machine.WriteScreenPNG(w) }); err != nil {
+			return err
+		}
+	}
+	if *save != "" {
+		if err := machine.Save().WriteFile(*save); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("cycles %d  PC %d  A %d  D %d\n", machine.Cycles, machine.PC, machine.A, machine.D)
+	for _, address := range addresses {
+		fmt.Printf("RAM[%d] = %d\n", address, machine.RAM[address])
+	}
+	if *golden != "" {
+		if err := compareScreen(machine, *golden); err != nil {
+			return err
+		}
+	}
+	if *coverTo != "" {
+		if err := writeCoverage(*coverTo, &coverage); err != nil {
+			return err
+		}
+	}
+	if *profile {
+		fmt.Println()
+		return machine.Profile.Write(os.Stdout, machine, labels, *top)
+	}
+	return nil
+}
+
+/*
+ * sourceDir is the directory the sources of a program path are in.
+ */
+func sourceDir(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return path
+	}
+	return filepath.Dir(path)
+}
+
+/*
+ * writeCoverage writes a coverage report, as HTML if the file name ends in
+ * .html and as text otherwise; - is standard output.
+ */
+func writeCoverage(path string, coverage *cover.Coverage) error {
+	files := coverage.Files()
+	if path == "-" {
+		return cover.WriteText(os.Stdout, files)
+	}
+	return writeFile(path, func(w *os.File) error {
+		if filepath.Ext(path) == ".html" {
+			return cover.WriteHTML(w, files)
+		}
+		return cover.WriteText(w, files)
+	})
+}
+
+func runDebug(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	script := flags.String("x", "", "execute the debugger commands in this file first")
+	keys := flags.String("keys", "", "press the keys of this keyboard script")
+	history := flags.Int("history", debug.DefaultHistory, "instructions that can be undone (12 bytes each, 0 for none)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: n2t debug [-x commands] [-keys file] [-history n] <file.hack|file.asm|file.vm|file.jack|dir>")
+	}
+	if *history < 0 {
+		return fmt.Errorf("-history must not be negative")
+	}
+	program, symbols, err := build.HackSymbols(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	machine := cpu.New(program)
+	if *keys != "" {
+		if machine.Keyboard, err = cpu.ReadKeyboard(*keys); err != nil {
+			return err
+		}
+	}
+	debugger := debug.New(machine, symbols.Labels, symbols.Variables, os.Stdout)
+	debugger.Source, debugger.Debug = symbols.Source, symbols.Debug
+	if *history != debug.DefaultHistory {
+		debugger.SetHistory(*history)
+	}
+
+	// Ctrl-C stops the program rather than the debugger
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			debugger.Interrupt()
+		}
+	}()
+
+	if *script != "" {
+		file, err := os.Open(*script)
+		if err != nil {
+			return err
+		}
+		err = debugger.Run(file, false)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("debugging %s; type help for the commands\n", flags.Arg(0))
+	return debugger.Run(os.Stdin, info.Mode()&os.ModeCharDevice != 0)
+}
+
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: n2t diff <old.snap> <new.snap>")
+	}
+	old, err := cpu.ReadSnapshot(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	changed, err := cpu.ReadSnapshot(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	differences := old.Diff(changed)
+	for _, line := range differences {
+		fmt.Println(line)
+	}
+	if len(differences) > 0 {
+		return fmt.Errorf("%d differences", len(differences))
+	}
+	return nil
+}
+
+func runPlay(args []string) error {
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	mode := flags.String("mode", "braille", "draw the screen with braille (2x4 pixels per character) or half blocks (1x2)")
+	scale := flags.Int("scale", 0, "pixels per dot or half block across and down (default: fit the terminal)")
+	speed := flags.Uint64("speed", 4000000, "cycles per second (0 for as fast as possible)")
+	hold := flags.Duration("hold", 150*time.Millisecond, "how long a key stays down after the terminal last sent it")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: n2t play [-mode braille|half] [-scale n] [-speed n] [-hold d] <file.hack|file.asm|file.vm|file.jack|dir>")
+	}
+	drawing, err := tui.ParseMode(*mode)
+	if err != nil {
+		return err
+	}
+	if *scale < 0 {
+		return fmt.Errorf("-scale must not be negative")
+	}
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("play needs a terminal")
+	}
+	program, err := build.Hack(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return tui.Run(cpu.New(program), os.Stdin, os.Stdout, tui.Options{Mode: drawing, Scale: *scale, Speed: *speed, Hold: *hold})
+}
+
+/*
+ * parseAddresses reads a comma separated list of addresses and ranges (a-b).
+ */
+func parseAddresses(list string) ([]int, error) {
+	var addresses []int
+	if list == "" {
+		return addresses, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q", part)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(to); err != nil {
+				return nil, fmt.Errorf("invalid address %q", part)
+			}
+		}
+		if first < 0 || last >= cpu.RAMSize || first > last {
+			return nil, fmt.Errorf("invalid address %q", part)
+		}
+		for address := first; address <= last; address++ {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, nil
+}
+
+func runTest(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	builtin := flags.String("builtin", "", "chips to simulate with their builtin implementations, e.g. RAM16K,ALU (or all)")
+	useHDL := flags.String("hdl", "", "chips to simulate from their HDL even where a script reads their state")
+	trace := flags.Bool("vcd", false, "write the waveform of each script to <script>.vcd")
+	signals := flags.String("signals", "", "signals to trace, e.g. out,Register_0.*,RAM[0] (default: the chip's own, or the CPU registers; all for everything)")
+	keys := flags.String("keys", "", "press the keys of this keyboard script in every program or chip loaded")
+	coverTo := flags.String("cover", "", "write the line coverage of the programs the scripts load to this file (.html for HTML, - for standard output)")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: n2t test [-builtin chips] [-hdl chips] [-keys file] [-vcd] [-signals list] [-cover file] <file.tst>...")
+	}
+	switches := builtinSwitches(*builtin, *useHDL)
+	var keyboard *cpu.Keyboard
+	if *keys != "" {
+		var err error
+		if keyboard, err = cpu.ReadKeyboard(*keys); err != nil {
+			return err
+		}
+	}
+	var coverage *cover.Coverage
+	if *coverTo != "" {
+		coverage = &cover.Coverage{}
+	}
+	failed := 0
+	for _, path := range flags.Args() {
+		runner := &tst.Runner{Builtin: switches, TraceSignals: splitList(*signals), Keyboard: keyboard, Coverage: coverage}
+		var err error
+		if *trace {
+			err = writeFile(replaceExt(path, ".vcd"), func(w *os.File) error {
+				runner.Trace = vcd.NewWriter(w, "1 ns")
+				err := runner.RunFile(path)
+				if flushErr := runner.Trace.Flush(); err == nil {
+					err = flushErr
+				}
+				return err
+			})
+		} else {
+			err = runner.RunFile(path)
+		}
+		if err != nil {
+			fmt.Printf("FAIL %v\n", err)
+			failed++
+		} else {
+			fmt.Printf("ok   %s\n", path)
+		}
+	}
+	if coverage != nil {
+		if err := writeCoverage(*coverTo, coverage); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scripts failed", failed, flags.NArg())
+	}
+	return nil
+}
+
+/*
+ * builtinSwitches turns the -builtin and -hdl flags into Loader.Builtin.
+ */
+func builtinSwitches(builtin, useHDL string) map[string]bool {
+	switches := map[string]bool{}
+	for _, chip := range splitList(builtin) {
+		if chip == "all" {
+			for _, name := range hdl.Builtins() {
+				switches[name] = true
+			}
+			continue
+		}
+		switches[chip] = true
+	}
+	for _, chip := range splitList(useHDL) {
+		switches[chip] = false
+	}
+	return switches
+}
+
+/*
+ * splitList splits a comma-separated flag value, ignoring empty entries.
+ */
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func runJack(args []string) error {
+	flags := flag.NewFlagSet("jack", flag.ExitOnError)
+	xml := flags.Bool("xml", false, "also write XxxT.xml (tokens) and Xxx.xml (parse tree) next to each source")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: n2t jack [-xml] <file.jack|dir>...")
+	}
+
+	var files []string
+	for _, path := range flags.Args() {
+		names, err := build.JackFiles(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, names...)
+	}
+	for _, name := range files {
+		source, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tokens, err := jack.Tokenize(name, string(source))
+		if err != nil {
+			return err
+		}
+		class, err := jack.ParseTokens(name, tokens)
+		if err != nil {
+			return err
+		}
+		if *xml {
+			if err := writeFile(replaceExt(name, "T.xml"), func(w *os.File) error { return jack.WriteTokensXML(w, tokens) }); err != nil {
+				return err
+			}
+			if err := writeFile(replaceExt(name, ".xml"), func(w *os.File) error { return jack.WriteXML(w, class) }); err != nil {
+				return err
+			}
+		}
+		commands, err := jack.Compile(name, class)
+		if err != nil {
+			return err
+		}
+		var lines []string
+		for _, command := range commands {
+			lines = append(lines, command.String())
+		}
+		if err := build.WriteLines(replaceExt(name, ".vm"), lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(name string, write func(w *os.File) error) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+/*
+ * compareScreen checks the screen against a golden PNG image of it.
+ */
+func compareScreen(machine *cpu.CPU, golden string) error {
+	file, err := os.Open(golden)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", golden, err)
+	}
+	count, first, err := machine.CompareScreen(img)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s: %v", golden, err)
+	case count > 0:
+		return fmt.Errorf("screen differs from %s in %d pixels, the first at x=%d, y=%d", golden, count, first.X, first.Y)
+	}
+	fmt.Printf("screen matches %s\n", golden)
+	return nil
+}
+
+func runLint(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: n2t lint <file.hdl|dir>...")
+	}
+
+	var files []string
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		names, err := filepath.Glob(filepath.Join(path, "*.hdl"))
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("%s: no .hdl files", path)
+		}
+		files = append(files, names...)
+	}
+	found := 0
+	for _, name := range files {
+		loader := hdl.NewLoader(tst.ProjectPath(filepath.Dir(name))...)
+		problems, err := loader.Lint(name)
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		found += len(problems)
+	}
+	switch {
+	case found == 1:
+		return fmt.Errorf("1 problem found")
+	case found > 1:
+		return fmt.Errorf("%d problems found", found)
+	}
+	return nil
+}
+
+func runCheck(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	vectors := flags.Int("vectors", 10000, "random input vectors (clock cycles for clocked chips) per chip too wide to check exhaustively")
+	seed := flags.Int64("seed", 1, "seed of the random input vectors")
+	builtin := flags.String("builtin", "", "chips to simulate as builtin parts, e.g. RAM4K (or all)")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: n2t check [-vectors n] [-seed s] [-builtin chips] <file.hdl>...")
+	}
+
+	failed := 0
+	for _, name := range flags.Args() {
+		loader := hdl.NewLoader(tst.ProjectPath(filepath.Dir(name))...)
+		loader.Builtin = builtinSwitches(*builtin, "")
+		_, def, err := hdl.Reference(strings.TrimSuffix(filepath.Base(name), ".hdl"))
+		if err != nil {
+			fmt.Printf("%s: skipped, %v\n", name, err)
+			continue
+		}
+		result, err := loader.Check(name, *vectors, *seed)
+		if err != nil {
+			return err
+		}
+		tried := fmt.Sprintf("%d random input vectors", result.Vectors)
+		switch {
+		case result.Exhaustive:
+			tried = fmt.Sprintf("all %d input vectors", result.Vectors)
+		case len(def.Clocked) > 0:
+			tried = fmt.Sprintf("%d random clock cycles", result.Vectors)
+		}
+		switch {
+		case result.Mismatch != nil:
+			fmt.Printf("%s: FAIL after %s\n%s\n", name, tried, result.Mismatch)
+			failed++
+		case result.Exhaustive:
+			fmt.Printf("%s: ok, equivalent on %s\n", name, tried)
+		default:
+			// random vectors are a sample, not a proof
+			fmt.Printf("%s: ok, no mismatch in %s (probabilistic)\n", name, tried)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d chips differ from their reference", failed, flags.NArg())
+	}
+	return nil
+}
+
+func runGen(args []string) error {
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	vectors := flags.Int("vectors", 64, "input vectors (clock cycles for clocked chips); all of them if there are no more")
+	seed := flags.Int64("seed", 1, "seed of the random input vectors")
+	force := flags.Bool("f", false, "overwrite existing .tst and .cmp files")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: n2t gen [-vectors n] [-seed s] [-f] <file.hdl>...")
+	}
+
+	for _, name := range flags.Args() {
+		chip, err := hdl.NewLoader().ParseFile(name)
+		if err != nil {
+			return err
+		}
+		model, def, err := hdl.Reference(chip.Name)
+		if err != nil {
+			return &hdl.Error{File: name, Line: 1, Message: err.Error() + "; gen works on reference chips only"}
+		}
+		script, compare := replaceExt(name, ".tst"), replaceExt(name, ".cmp")
+		if !*force {
+			for _, file := range []string{script, compare} {
+				if _, err := os.Stat(file); err == nil {
+					return fmt.Errorf("%s exists; use -f to overwrite it", file)
+				}
+			}
+		}
+		// the pins as the chip declares them, clocked as its model
+		pins := *chip
+		pins.Clocked = def.Clocked
+		var scriptText, compareText strings.Builder
+		if err := tst.Generate(&pins, model, hdl.Vectors(&pins, *vectors, *seed), &scriptText, &compareText); err != nil {
+			return &hdl.Error{File: name, Line: 1, Message: err.Error()}
+		}
+		if err := os.WriteFile(script, []byte(scriptText.String()), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(compare, []byte(compareText.String()), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("%s: wrote %s and %s\n", name, script, compare)
+	}
+	return nil
+}
+
+func runStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	builtin := flags.String("builtin", "", "chips to leave as builtin parts instead of counting their gates, e.g. RAM16K (or all)")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: n2t stats [-builtin chips] <file.hdl>...")
+	}
+
+	for i, name := range flags.Args() {
+		loader := hdl.NewLoader(tst.ProjectPath(filepath.Dir(name))...)
+		loader.Builtin = builtinSwitches(*builtin, "")
+		circuit, err := loader.Load(name)
+		if err != nil {
+			return err
+		}
+		stats := circuit.Stats()
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s: %d Nand, %d DFF", name, stats.Nands, stats.DFFs)
+		if stats.Builtins > 0 {
+			fmt.Printf(", %d builtin", stats.Builtins)
+		}
+		fmt.Printf(", critical path %d Nand\n", stats.Depth)
+		if len(stats.Parts) > 0 {
+			fmt.Printf("  %-5s %-16s %7s %5s\n", "line", "part", "Nand", "DFF")
+			for _, part := range stats.Parts {
+				fmt.Printf("  %-5d %-16s %7d %5d", part.Line, part.Name, part.Nands, part.DFFs)
+				if part.Builtins > 0 {
+					fmt.Printf("  (%d builtin)", part.Builtins)
+				}
+				fmt.Println()
+			}
+		}
+		if len(stats.Path) > 0 {
+			fmt.Printf("  critical path: %s\n", strings.Join(stats.Path, " -> "))
+		}
+		if stats.Builtins > 0 {
+			fmt.Println("  builtin parts are not counted and add no depth")
+		}
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "verilog", "verilog, or dot for a Graphviz graph of the chip's parts")
+	flat := flags.Bool("flat", false, "flatten the chip into one Verilog module of Nand gates and DFFs")
+	builtin := flags.String("builtin", "", "chips to export as builtin modules even where their HDL exists (or all)")
+	out := flags.String("o", "", "output file (default: <chip>.v or <chip>.dot)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: n2t export [-format verilog|dot] [-flat] [-builtin chips] [-o file] <file.hdl>")
+	}
+	path := flags.Arg(0)
+
+	loader := hdl.NewLoader(tst.ProjectPath(filepath.Dir(path))...)
+	loader.Builtin = builtinSwitches(*builtin, "")
+	chip, err := loader.ParseFile(path)
+	if err != nil {
+		return err
+	}
+	var write func(w *os.File) error
+	switch *format {
+	case "verilog":
+		*out = defaultName(*out, path, ".v")
+		write = func(w *os.File) error { return loader.WriteVerilog(w, chip, filepath.Dir(path)) }
+		if *flat {
+			circuit, err := loader.Build(chip, filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			write = func(w *os.File) error { return circuit.WriteVerilog(w) }
+		}
+	case "dot":
+		*out = defaultName(*out, path, ".dot")
+		write = func(w *os.File) error { return loader.WriteDOT(w, chip, filepath.Dir(path)) }
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	return writeFile(*out, write)
+}
+
+func defaultName(name, path, ext string) string {
+	if name == "" {
+		return replaceExt(path, ext)
+	}
+	return name
+}
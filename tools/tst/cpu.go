@@ -0,0 +1,192 @@
+package tst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/build"
+	"github.com/christopher-weiss/nand2tetris/tools/cover"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/vcd"
+)
+
+/*
+ * CPUSimulator runs CPU emulator scripts (load X.asm, ticktock, RAM[n], PC, ...)
+ * on the Go Hack emulator. Beyond the commands of the Java emulator, snapshot
+ * saves the machine state and restore brings it back, so test cases can start
+ * from the same state without running the program up to it again; with a
+ * file name they write and read a snapshot file next to the script.
+ */
+type CPUSimulator struct {
+	CPU *cpu.CPU
+
+	dir      string
+	snapshot *cpu.Snapshot
+	coverage *cover.Coverage
+	trace    *vcd.Writer
+	traced   []tracedWord
+}
+
+/*
+ * Load builds the program the script names. When the script's directory holds
+ * .vm sources, the .asm is produced by translating them, so the scripts of
+ * projects 07 and 08 test the VM translator rather than a stale .asm file.
+ */
+func (s *CPUSimulator) Load(path string) error {
+	source := path
+	if filepath.Ext(path) == ".asm" {
+		if files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.vm")); len(files) > 0 {
+			source = filepath.Dir(path)
+		} else if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	program, symbols, err := build.HackSymbols(source)
+	if err != nil {
+		return err
+	}
+	s.dir = filepath.Dir(path)
+	if s.trace != nil && s.CPU != nil {
+		return fmt.Errorf("only one program can be traced per script")
+	}
+	s.CPU = cpu.New(program)
+	if s.coverage != nil && symbols.Debug != nil {
+		s.CPU.Profile = &cpu.Profile{}
+		s.coverage.Add(s.CPU.Profile, program, symbols.Debug.Lines, s.dir)
+		if symbols.Source != nil {
+			s.coverage.AddVMSource(symbols.Source)
+		}
+	}
+	s.dump()
+	return nil
+}
+
+/*
+ * Cover adds the programs loaded from now on to the coverage.
+ */
+func (s *CPUSimulator) Cover(coverage *cover.Coverage) {
+	s.coverage = coverage
+}
+
+func (s *CPUSimulator) Get(name string) (int, error) {
+	switch name {
+	case "A":
+		return int(s.CPU.A), nil
+	case "D":
+		return int(s.CPU.D), nil
+	case "PC":
+		return int(s.CPU.PC), nil
+	case "time":
+		return int(s.CPU.Cycles), nil
+	}
+	memory, index, err := memoryIndex(name)
+	if err != nil {
+		return 0, err
+	}
+	if memory == "ROM" {
+		return int(int16(s.CPU.ROM[index])), nil
+	}
+	return int(s.CPU.RAM[index]), nil
+}
+
+func (s *CPUSimulator) Set(name string, value int) error {
+	switch name {
+	case "A":
+		s.CPU.A = int16(value)
+		return nil
+	case "D":
+		s.CPU.D = int16(value)
+		return nil
+	case "PC":
+		s.CPU.PC = uint16(value)
+		return nil
+	}
+	memory, index, err := memoryIndex(name)
+	if err != nil {
+		return err
+	}
+	if memory == "ROM" {
+		s.CPU.ROM[index] = uint16(value)
+	} else {
+		s.CPU.RAM[index] = int16(value)
+	}
+	return nil
+}
+
+func (s *CPUSimulator) Exec(command string, args []string) error {
+	switch command {
+	case "snapshot", "restore":
+		if len(args) > 1 {
+			return fmt.Errorf("%s expects at most a file name", command)
+		}
+		return s.snapshotCommand(command, args)
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments to %s", command)
+	}
+	switch command {
+	case "ticktock", "tock":
+		s.CPU.Step()
+		s.dump()
+	case "tick":
+		// the emulator executes a whole instruction on tock
+	default:
+		return fmt.Errorf("unknown CPU emulator command %q", command)
+	}
+	return nil
+}
+
+func (s *CPUSimulator) snapshotCommand(command string, args []string) error {
+	switch {
+	case command == "snapshot" && len(args) == 0:
+		s.snapshot = s.CPU.Save()
+	case command == "snapshot":
+		return s.CPU.Save().WriteFile(filepath.Join(s.dir, args[0]))
+	case len(args) == 0:
+		if s.snapshot == nil {
+			return fmt.Errorf("restore before snapshot")
+		}
+		s.CPU.Restore(s.snapshot)
+	default:
+		snapshot, err := cpu.ReadSnapshot(filepath.Join(s.dir, args[0]))
+		if err != nil {
+			return err
+		}
+		s.CPU.Restore(snapshot)
+	}
+	s.dump()
+	return nil
+}
+
+/*
+ * PlayKeyboard presses the keys of a keyboard script into RAM[24576] as the
+ * program runs, counting cycles from the load.
+ */
+func (s *CPUSimulator) PlayKeyboard(keyboard *cpu.Keyboard) error {
+	s.CPU.Keyboard = keyboard
+	key, _ := keyboard.Advance(s.CPU.Cycles)
+	s.CPU.RAM[cpu.KBD] = key
+	return nil
+}
+
+/*
+ * memoryIndex splits RAM[n] or ROM[n] into the memory name and the address.
+ */
+func memoryIndex(name string) (string, int, error) {
+	open := strings.Index(name, "[")
+	if open < 0 || !strings.HasSuffix(name, "]") {
+		return "", 0, fmt.Errorf("unknown variable %q", name)
+	}
+	memory := name[:open]
+	if memory != "RAM" && memory != "ROM" {
+		return "", 0, fmt.Errorf("unknown variable %q", name)
+	}
+	index, err := strconv.Atoi(name[open+1 : len(name)-1])
+	if err != nil || index < 0 || index >= cpu.RAMSize {
+		return "", 0, fmt.Errorf("invalid address in %q", name)
+	}
+	return memory, index, nil
+}
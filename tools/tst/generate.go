@@ -0,0 +1,128 @@
+package tst
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/hdl"
+)
+
+/*
+ * Generate writes a test script for chip to script and the output it must
+ * produce to compare, computed by model. n2t gen passes hdl.Reference, which
+ * has models of the reference chips only; any other chip needs a model of its
+ * own from hdl.NewModel.
+ * Each input vector is applied with set and followed by eval and output or, if
+ * the chip is clocked, by tick, output, tock, output as in the project 3
+ * scripts, with a time column. Outputs the model leaves unspecified are
+ * written as *, which matches anything. The script names X.hdl, X.out and
+ * X.cmp for a chip X, so it runs with our runner and the Java tools alike.
+ */
+func Generate(chip *hdl.Chip, model hdl.Simulation, vectors [][]int, script, compare io.Writer) error {
+	clocked := len(chip.Clocked) > 0
+	var columns []Column
+	if clocked {
+		columns = append(columns, Column{Name: "time", Format: 'S', PadL: 1, Len: 4, PadR: 1})
+	}
+	for _, pins := range [][]hdl.Pin{chip.Inputs, chip.Outputs} {
+		for _, pin := range pins {
+			columns = append(columns, pinColumn(pin))
+		}
+	}
+
+	s := bufio.NewWriter(script)
+	c := bufio.NewWriter(compare)
+	fmt.Fprintf(s, "// %s.tst: generated by n2t gen from a model of the chip.\n\n", chip.Name)
+	fmt.Fprintf(s, "load %s.hdl,\n", chip.Name)
+	fmt.Fprintf(s, "output-file %s.out,\n", chip.Name)
+	fmt.Fprintf(s, "compare-to %s.cmp,\n", chip.Name)
+	var specs []string
+	for _, column := range columns {
+		specs = append(specs, fmt.Sprintf("%s%%%c%d.%d.%d", column.Name, column.Format, column.PadL, column.Len, column.PadR))
+	}
+	fmt.Fprintf(s, "output-list %s;\n", strings.Join(specs, " "))
+
+	c.WriteString("|")
+	for _, column := range columns {
+		c.WriteString(column.Header() + "|")
+	}
+	c.WriteString("\n")
+	time := 0
+	row := func(clock string) error {
+		c.WriteString("|")
+		for _, column := range columns {
+			if column.Name == "time" && clocked {
+				c.WriteString(column.Text(clock) + "|")
+				continue
+			}
+			if p, ok := model.(hdl.Partial); ok && !p.Specified(column.Name) {
+				c.WriteString(strings.Repeat("*", column.Width()) + "|")
+				continue
+			}
+			value, err := model.Get(column.Name)
+			if err != nil {
+				return err
+			}
+			c.WriteString(column.Cell(value) + "|")
+		}
+		c.WriteString("\n")
+		return nil
+	}
+
+	model.Reset()
+	for _, vector := range vectors {
+		fmt.Fprintln(s)
+		for i, pin := range chip.Inputs {
+			if err := model.Set(pin.Name, vector[i]); err != nil {
+				return err
+			}
+			fmt.Fprintf(s, "set %s %s,\n", pin.Name, scriptValue(vector[i], pin.Width))
+		}
+		if !clocked {
+			model.Eval()
+			fmt.Fprintln(s, "eval,\noutput;")
+			if err := row(""); err != nil {
+				return err
+			}
+			continue
+		}
+		model.Tick()
+		fmt.Fprintln(s, "tick,\noutput;\n\ntock,\noutput;")
+		if err := row(fmt.Sprintf("%d+", time)); err != nil {
+			return err
+		}
+		model.Tock()
+		time++
+		if err := row(fmt.Sprint(time)); err != nil {
+			return err
+		}
+	}
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+/*
+ * pinColumn shows a pin in binary, padded so that its name fits the header.
+ */
+func pinColumn(pin hdl.Pin) Column {
+	pad := 1
+	if extra := len(pin.Name) - pin.Width; extra > 0 {
+		pad = (extra + 3) / 2
+	}
+	return Column{Name: pin.Name, Format: 'B', PadL: pad, Len: pin.Width, PadR: pad}
+}
+
+/*
+ * scriptValue writes a single bit in decimal and a bus as a %B literal of its
+ * width.
+ */
+func scriptValue(value, width int) string {
+	if width == 1 {
+		return fmt.Sprint(value & 1)
+	}
+	return "%B" + formatBase(value, 2, width)
+}
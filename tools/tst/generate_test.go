@@ -0,0 +1,112 @@
+package tst
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/christopher-weiss/nand2tetris/tools/hdl"
+)
+
+/*
+ * chipsFromNand are a combinational and a clocked chip built from Nand and
+ * DFF only, so that they load from any directory.
+ */
+var chipsFromNand = map[string]string{
+	"Xor": `CHIP Xor {
+    IN a, b;
+    OUT out;
+    PARTS:
+    Nand(a=a, b=b, out=nab);
+    Nand(a=a, b=nab, out=x);
+    Nand(a=nab, b=b, out=y);
+    Nand(a=x, b=y, out=out);
+}
+`,
+	"Bit": `CHIP Bit {
+    IN in, load;
+    OUT out;
+    PARTS:
+    Nand(a=load, b=load, out=notload);
+    Nand(a=in, b=load, out=x);
+    Nand(a=state, b=notload, out=y);
+    Nand(a=x, b=y, out=next);
+    DFF(in=next, out=state, out=out);
+}
+`,
+}
+
+/*
+ * generate writes the HDL of a chip to dir with a test script and compare
+ * file generated from the chip's reference model, and returns the script.
+ */
+func generate(t *testing.T, dir, name, source string) string {
+	t.Helper()
+	file := filepath.Join(dir, name+".hdl")
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	chip, err := hdl.NewLoader().ParseFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, def, err := hdl.Reference(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins := *chip
+	pins.Clocked = def.Clocked
+	var script, compare strings.Builder
+	if err := Generate(&pins, model, hdl.Vectors(&pins, 16, 1), &script, &compare); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".cmp"), []byte(compare.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name+".tst")
+	if err := os.WriteFile(path, []byte(script.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+/*
+ * TestGenerate generates tests for a combinational and a clocked chip from
+ * their reference models and runs them against HDL implementations.
+ */
+func TestGenerate(t *testing.T) {
+	for name, source := range chipsFromNand {
+		t.Run(name, func(t *testing.T) {
+			script := generate(t, t.TempDir(), name, source)
+			if err := RunFile(script); err != nil {
+				t.Fatal(err)
+			}
+			text, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clocked := strings.Contains(string(text), "tick"); clocked != (name == "Bit") {
+				t.Errorf("script of %s clocked: %v", name, clocked)
+			}
+		})
+	}
+}
+
+/*
+ * TestGenerateCatchesBug runs the generated test of Xor against a Nand, which
+ * must fail on the row where the two differ.
+ */
+func TestGenerateCatchesBug(t *testing.T) {
+	dir := t.TempDir()
+	script := generate(t, dir, "Xor", chipsFromNand["Xor"])
+	broken := "CHIP Xor {\n    IN a, b;\n    OUT out;\n    PARTS:\n    Nand(a=a, b=b, out=out);\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "Xor.hdl"), []byte(broken), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the vectors count up from a=0, b=0, the first row after the header
+	err := RunFile(script)
+	if err == nil || !strings.Contains(err.Error(), "comparison failure at line 2, column out") {
+		t.Fatalf("a Nand ran the generated Xor test with %v", err)
+	}
+}
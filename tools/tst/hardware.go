@@ -0,0 +1,254 @@
+package tst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/build"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/hdl"
+	"github.com/christopher-weiss/nand2tetris/tools/vcd"
+)
+
+/*
+ * HardwareSimulator runs hardware simulator scripts (load X.hdl, set, eval,
+ * tick, tock, ...) on the Go HDL simulator. Parts are looked up next to the
+ * loaded chip and then in Path, which defaults to every directory of the
+ * repository that holds .hdl files.
+ *
+ * Builtin switches chips between HDL and builtin implementations. Chips in
+ * Inspected, whose state the script reads or sets (RAM16K[0], PC[], ROM32K
+ * load), are simulated by their builtins unless Builtin says otherwise.
+ */
+type HardwareSimulator struct {
+	Path      []string
+	Builtin   map[string]bool
+	Inspected []string
+	Circuit   *hdl.Circuit
+	dir       string
+	time      int
+	ticked    bool
+	keyboard  *cpu.Keyboard
+
+	trace    *vcd.Writer
+	patterns []string
+	traced   []tracedSignal
+	clock    int
+	samples  uint64
+}
+
+func (s *HardwareSimulator) Load(path string) error {
+	s.dir = filepath.Dir(path)
+	if s.Path == nil {
+		s.Path = ProjectPath(s.dir)
+	}
+	loader := hdl.NewLoader(s.Path...)
+	loader.Scopes = s.trace != nil
+	loader.Builtin = map[string]bool{}
+	for _, chip := range s.Inspected {
+		loader.Builtin[chip] = true
+	}
+	for chip, builtin := range s.Builtin {
+		loader.Builtin[chip] = builtin
+	}
+	circuit, err := loader.Load(path)
+	if err != nil {
+		return err
+	}
+	if s.trace != nil && s.Circuit != nil {
+		return fmt.Errorf("only one chip can be traced per script")
+	}
+	s.Circuit = circuit
+	s.time, s.ticked = 0, false
+	s.keyboard = nil
+	if s.trace != nil {
+		return s.declare()
+	}
+	return nil
+}
+
+/*
+ * Time is the clock as the hardware simulator shows it: the number of completed
+ * cycles, followed by + between a tick and its tock.
+ */
+func (s *HardwareSimulator) Time() string {
+	if s.ticked {
+		return strconv.Itoa(s.time) + "+"
+	}
+	return strconv.Itoa(s.time)
+}
+
+func (s *HardwareSimulator) Get(name string) (int, error) {
+	if name == "time" {
+		return s.time, nil
+	}
+	return s.Circuit.Get(name)
+}
+
+func (s *HardwareSimulator) Set(name string, value int) error {
+	return s.Circuit.Set(name, value)
+}
+
+func (s *HardwareSimulator) Exec(command string, args []string) error {
+	if len(args) > 0 {
+		// <chip> load <file>, e.g. ROM32K load Max.hack
+		if len(args) != 2 || args[0] != "load" {
+			return fmt.Errorf("unknown hardware simulator command %q", command+" "+strings.Join(args, " "))
+		}
+		program, err := build.Hack(filepath.Join(s.dir, args[1]))
+		if err != nil {
+			return err
+		}
+		return s.Circuit.LoadMemory(command, program)
+	}
+	switch command {
+	case "eval":
+		s.Circuit.Eval()
+		s.dump()
+	case "tick":
+		s.Circuit.Tick()
+		s.ticked = true
+		s.dump()
+	case "tock":
+		s.Circuit.Tock()
+		s.time++
+		s.ticked = false
+		s.dump()
+		return s.pressKeys()
+	case "ticktock":
+		s.Circuit.Tick()
+		s.ticked = true
+		s.dump()
+		s.Circuit.Tock()
+		s.time++
+		s.ticked = false
+		s.dump()
+		return s.pressKeys()
+	default:
+		return fmt.Errorf("unknown hardware simulator command %q", command)
+	}
+	return nil
+}
+
+/*
+ * PlayKeyboard holds down the keys of a keyboard script on the chip's
+ * Keyboard part as the clock cycles pass, counting from the load.
+ */
+func (s *HardwareSimulator) PlayKeyboard(keyboard *cpu.Keyboard) error {
+	key, _ := keyboard.Advance(uint64(s.time))
+	if err := s.Circuit.Set("Keyboard[]", int(key)); err != nil {
+		return err
+	}
+	s.keyboard = keyboard
+	return nil
+}
+
+/*
+ * pressKeys updates the Keyboard part after a clock cycle.
+ */
+func (s *HardwareSimulator) pressKeys() error {
+	if s.keyboard == nil {
+		return nil
+	}
+	if key, changed := s.keyboard.Advance(uint64(s.time)); changed {
+		return s.Circuit.Set("Keyboard[]", int(key))
+	}
+	return nil
+}
+
+/*
+ * ProjectPath returns the directories holding .hdl files in the repository
+ * containing dir, whose root is the nearest ancestor with a go.mod or .git. If
+ * there is none, dir alone is searched.
+ */
+func ProjectPath(dir string) []string {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return []string{dir}
+	}
+	for !isRepositoryRoot(root) {
+		parent := filepath.Dir(root)
+		if parent == root {
+			return []string{dir}
+		}
+		root = parent
+	}
+	seen := map[string]bool{}
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && path != root && info.Name()[0] == '.' {
+			return filepath.SkipDir
+		}
+		if filepath.Ext(path) == ".hdl" {
+			seen[filepath.Dir(path)] = true
+		}
+		return nil
+	})
+	var path []string
+	for d := range seen {
+		path = append(path, d)
+	}
+	sort.Strings(path)
+	return path
+}
+
+func isRepositoryRoot(dir string) bool {
+	for _, name := range []string{"go.mod", ".git"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * inspectedParts returns the builtin chips whose state a script refers to, as
+ * Name[...] in outputs, sets and conditions or as Name load <file>.
+ */
+func inspectedParts(statements []Statement) []string {
+	builtins := map[string]bool{}
+	for _, name := range hdl.Builtins() {
+		builtins[name] = true
+	}
+	seen := map[string]bool{}
+	var chips []string
+	add := func(chip string) {
+		if builtins[chip] && !seen[chip] {
+			seen[chip] = true
+			chips = append(chips, chip)
+		}
+	}
+	reference := func(name string) {
+		if i := strings.Index(name, "["); i >= 0 {
+			add(name[:i])
+		}
+	}
+	var walk func(statements []Statement)
+	walk = func(statements []Statement) {
+		for _, statement := range statements {
+			switch statement.Command {
+			case "output-list":
+				for _, arg := range statement.Args {
+					reference(arg)
+				}
+			case "set", "while":
+				if len(statement.Args) > 0 {
+					reference(statement.Args[0])
+				}
+			default:
+				if len(statement.Args) > 0 && statement.Args[0] == "load" {
+					add(statement.Command)
+				}
+			}
+			walk(statement.Body)
+		}
+	}
+	walk(statements)
+	return chips
+}
@@ -0,0 +1,73 @@
+package tst
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+)
+
+/*
+ * slowScripts simulate memories of thousands of registers gate by gate.
+ */
+var slowScripts = map[string]bool{
+	"RAM4K.tst":  true,
+	"RAM16K.tst": true,
+	"Memory.tst": true,
+}
+
+/*
+ * keyboardScripts wait for keys pressed in the simulator's GUI; the keyboard
+ * scripts next to them press the keys.
+ */
+var keyboardScripts = map[string]string{
+	"Memory.tst": "Memory.keys",
+}
+
+/*
+ * TestChips runs the hardware test scripts of projects 01-05 against the HDL in
+ * the repository.
+ */
+func TestChips(t *testing.T) {
+	var scripts []string
+	for _, pattern := range []string{"../../0[1-5]_*/*.tst", "../../0[1-5]_*/*/*.tst"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts = append(scripts, matches...)
+	}
+	sort.Strings(scripts)
+	for _, script := range scripts {
+		script := script
+		source, err := os.ReadFile(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(source), ".hdl") {
+			continue
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(script), "../../")
+		t.Run(name, func(t *testing.T) {
+			if testing.Short() && slowScripts[filepath.Base(script)] {
+				t.Skip("gate-level simulation of a large memory")
+			}
+			statements, err := Parse(string(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner := &Runner{Dir: filepath.Dir(script), OutDir: t.TempDir()}
+			if keys, ok := keyboardScripts[filepath.Base(script)]; ok {
+				if runner.Keyboard, err = cpu.ReadKeyboard(filepath.Join(filepath.Dir(script), keys)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := runner.Run(statements); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
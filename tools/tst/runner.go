@@ -0,0 +1,575 @@
+package tst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/cover"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/vcd"
+)
+
+/*
+ * Simulator is the machine a test script drives: it loads the program named by
+ * the script, reads and writes named values (RAM[0], PC, pins, ...) and executes
+ * simulation commands such as ticktock or ROM32K load Max.hack.
+ */
+type Simulator interface {
+	Load(path string) error
+	Get(name string) (int, error)
+	Set(name string, value int) error
+	Exec(command string, args []string) error
+}
+
+/*
+ * Keyboarded is a Simulator whose keyboard a keyboard script can drive, see
+ * cpu.Keyboard. The CPU emulator times the script in instructions, the
+ * hardware simulator in clock cycles.
+ */
+type Keyboarded interface {
+	PlayKeyboard(keyboard *cpu.Keyboard) error
+}
+
+/*
+ * Covered is a Simulator that can report the coverage of the programs it
+ * runs, see cover.Coverage.
+ */
+type Covered interface {
+	Cover(coverage *cover.Coverage)
+}
+
+/*
+ * Column is one entry of an output-list, e.g. RAM[0]%D2.6.2.
+ */
+type Column struct {
+	Name   string
+	Format byte
+	PadL   int
+	Len    int
+	PadR   int
+}
+
+/*
+ * CompareError reports the first output row that differs from the .cmp file.
+ */
+type CompareError struct {
+	Line     int
+	Column   string
+	Expected string
+	Actual   string
+}
+
+func (e *CompareError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("comparison failure at line %d: expected %q, got %q", e.Line, e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("comparison failure at line %d, column %s: expected %q, got %q", e.Line, e.Column, e.Expected, e.Actual)
+}
+
+/*
+ * Runner executes a test script against a Simulator, writes the output file and
+ * compares it line by line against the compare file. Files named by the script
+ * are relative to Dir; the output file goes to OutDir if it is set. Builtin
+ * switches chips of hardware scripts between HDL and builtin implementations,
+ * see hdl.Loader. If Trace is set, the signals matching TraceSignals are
+ * recorded into it, see Tracer. Keyboard, if set, is played into every
+ * program or chip the script loads, as the keyboard <file> command does.
+ * Coverage, if set, collects the coverage of every program loaded.
+ */
+type Runner struct {
+	Dir          string
+	OutDir       string
+	Simulator    Simulator
+	Echo         func(message string)
+	Builtin      map[string]bool
+	Trace        *vcd.Writer
+	TraceSignals []string
+	Keyboard     *cpu.Keyboard
+	Coverage     *cover.Coverage
+
+	script   []Statement
+	outFile  string
+	compare  []string
+	columns  []Column
+	output   []string
+	failure  error
+	compared bool
+}
+
+/*
+ * RunFile parses and runs the script at path. A nil error means every output row
+ * matched the compare file (or there was none).
+ */
+func RunFile(path string) error {
+	return (&Runner{}).RunFile(path)
+}
+
+/*
+ * RunFile runs the script at path with the runner's settings, taking Dir from
+ * the path.
+ */
+func (r *Runner) RunFile(path string) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	statements, err := Parse(string(source))
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	r.Dir = filepath.Dir(path)
+	if err := r.Run(statements); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+/*
+ * Run executes statements. The output file, if the script names one, is written
+ * even when a comparison fails.
+ */
+func (r *Runner) Run(statements []Statement) error {
+	r.script = statements
+	err := r.execBlock(statements)
+	if writeErr := r.writeOutput(); err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return err
+	}
+	return r.failure
+}
+
+func (r *Runner) writeOutput() error {
+	if r.outFile == "" {
+		return nil
+	}
+	data := strings.Join(r.output, "\n")
+	if len(r.output) > 0 {
+		data += "\n"
+	}
+	dir := r.OutDir
+	if dir == "" {
+		dir = r.Dir
+	}
+	return os.WriteFile(filepath.Join(dir, r.outFile), []byte(data), 0644)
+}
+
+func (r *Runner) execBlock(statements []Statement) error {
+	for _, statement := range statements {
+		if r.failure != nil {
+			return nil
+		}
+		if err := r.exec(statement); err != nil {
+			return fmt.Errorf("line %d: %v", statement.Line, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) exec(statement Statement) error {
+	args := statement.Args
+	switch statement.Command {
+	case "load":
+		if len(args) != 1 {
+			return fmt.Errorf("load expects a file name")
+		}
+		simulator, err := simulatorFor(args[0])
+		if err != nil {
+			return err
+		}
+		if hardware, ok := simulator.(*HardwareSimulator); ok {
+			hardware.Builtin = r.Builtin
+			hardware.Inspected = inspectedParts(r.script)
+		}
+		if r.Trace != nil {
+			tracer, ok := simulator.(Tracer)
+			if !ok {
+				return fmt.Errorf("%s: this simulator cannot trace", args[0])
+			}
+			if err := tracer.Trace(r.Trace, r.TraceSignals); err != nil {
+				return err
+			}
+		}
+		if covered, ok := simulator.(Covered); ok && r.Coverage != nil {
+			covered.Cover(r.Coverage)
+		}
+		if err := simulator.Load(filepath.Join(r.Dir, args[0])); err != nil {
+			return err
+		}
+		r.Simulator = simulator
+		if r.Keyboard != nil {
+			return r.playKeyboard(r.Keyboard)
+		}
+	case "keyboard":
+		if len(args) != 1 {
+			return fmt.Errorf("keyboard expects a file name")
+		}
+		if r.Simulator == nil {
+			return fmt.Errorf("keyboard before load")
+		}
+		keyboard, err := cpu.ReadKeyboard(filepath.Join(r.Dir, args[0]))
+		if err != nil {
+			return err
+		}
+		return r.playKeyboard(keyboard)
+	case "output-file":
+		if len(args) != 1 {
+			return fmt.Errorf("output-file expects a file name")
+		}
+		r.outFile = args[0]
+	case "compare-to":
+		if len(args) != 1 {
+			return fmt.Errorf("compare-to expects a file name")
+		}
+		data, err := os.ReadFile(filepath.Join(r.Dir, args[0]))
+		if err != nil {
+			return err
+		}
+		r.compare = strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+		r.compared = true
+	case "output-list":
+		r.columns = nil
+		for _, arg := range args {
+			column, err := ParseColumn(arg)
+			if err != nil {
+				return err
+			}
+			r.columns = append(r.columns, column)
+		}
+		r.emit(r.header())
+	case "output":
+		row, err := r.row()
+		if err != nil {
+			return err
+		}
+		r.emit(row)
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("set expects a name and a value")
+		}
+		value, err := ParseValue(args[1])
+		if err != nil {
+			return err
+		}
+		if r.Simulator == nil {
+			return fmt.Errorf("set before load")
+		}
+		return r.Simulator.Set(args[0], value)
+	case "repeat":
+		count := -1
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid repeat count %q", args[0])
+			}
+			count = n
+		} else if len(args) > 1 {
+			return fmt.Errorf("repeat expects a count")
+		}
+		for i := 0; count < 0 || i < count; i++ {
+			if err := r.execBlock(statement.Body); err != nil {
+				return err
+			}
+			if r.failure != nil {
+				return nil
+			}
+		}
+	case "while":
+		for {
+			holds, err := r.condition(args)
+			if err != nil {
+				return err
+			}
+			if !holds {
+				return nil
+			}
+			if err := r.execBlock(statement.Body); err != nil {
+				return err
+			}
+			if r.failure != nil {
+				return nil
+			}
+		}
+	case "echo":
+		if r.Echo != nil {
+			r.Echo(strings.Join(args, " "))
+		}
+	case "clear-echo", "breakpoint", "clear-breakpoints":
+		// only meaningful in the interactive simulators
+	default:
+		if r.Simulator == nil {
+			return fmt.Errorf("%s before load", statement.Command)
+		}
+		return r.Simulator.Exec(statement.Command, args)
+	}
+	return nil
+}
+
+func (r *Runner) playKeyboard(keyboard *cpu.Keyboard) error {
+	simulator, ok := r.Simulator.(Keyboarded)
+	if !ok {
+		return fmt.Errorf("this simulator has no keyboard")
+	}
+	return simulator.PlayKeyboard(keyboard)
+}
+
+/*
+ * condition evaluates `<name> <op> <value>` of a while loop.
+ */
+func (r *Runner) condition(args []string) (bool, error) {
+	if len(args) != 3 {
+		return false, fmt.Errorf("while expects a condition like RAM[0] <> 0")
+	}
+	if r.Simulator == nil {
+		return false, fmt.Errorf("while before load")
+	}
+	left, err := r.Simulator.Get(args[0])
+	if err != nil {
+		return false, err
+	}
+	right, err := ParseValue(args[2])
+	if err != nil {
+		return false, err
+	}
+	switch args[1] {
+	case "=":
+		return left == right, nil
+	case "<>":
+		return left != right, nil
+	case "<":
+		return left < right, nil
+	case "<=":
+		return left <= right, nil
+	case ">":
+		return left > right, nil
+	case ">=":
+		return left >= right, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", args[1])
+}
+
+/*
+ * emit appends a line to the output and checks it against the compare file.
+ */
+func (r *Runner) emit(line string) {
+	r.output = append(r.output, line)
+	if !r.compared || r.failure != nil {
+		return
+	}
+	index := len(r.output) - 1
+	if index >= len(r.compare) {
+		r.failure = &CompareError{Line: index + 1, Expected: "", Actual: line}
+		return
+	}
+	expected := r.compare[index]
+	if !matches(expected, line) {
+		r.failure = &CompareError{
+			Line:     index + 1,
+			Column:   r.columnAt(line, expected),
+			Expected: expected,
+			Actual:   line,
+		}
+	}
+}
+
+/*
+ * matches compares an output line against a compare line, where '*' in the
+ * compare line matches any character.
+ */
+func matches(expected, actual string) bool {
+	expected = strings.TrimRight(expected, " \r")
+	actual = strings.TrimRight(actual, " ")
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := 0; i < len(expected); i++ {
+		if expected[i] != '*' && expected[i] != actual[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * columnAt names the output-list column containing the first differing character.
+ */
+func (r *Runner) columnAt(actual, expected string) string {
+	position := 0
+	for position < len(actual) && position < len(expected) &&
+		(expected[position] == '*' || expected[position] == actual[position]) {
+		position++
+	}
+	start := 1
+	for _, column := range r.columns {
+		end := start + column.PadL + column.Len + column.PadR
+		if position < end {
+			return column.Name
+		}
+		start = end + 1
+	}
+	return ""
+}
+
+/*
+ * ParseColumn reads an output-list entry of the form name%<fmt><padL>.<len>.<padR>.
+ */
+func ParseColumn(spec string) (Column, error) {
+	column := Column{Name: spec, Format: 'D', PadL: 1, Len: 6, PadR: 1}
+	index := strings.LastIndex(spec, "%")
+	if index < 0 {
+		return column, nil
+	}
+	column.Name = spec[:index]
+	format := spec[index+1:]
+	if len(format) < 1 {
+		return column, fmt.Errorf("invalid output format %q", spec)
+	}
+	column.Format = format[0]
+	switch column.Format {
+	case 'B', 'D', 'X', 'S':
+	default:
+		return column, fmt.Errorf("invalid output format %q", spec)
+	}
+	widths := strings.Split(format[1:], ".")
+	if len(widths) != 3 {
+		return column, fmt.Errorf("invalid output format %q", spec)
+	}
+	values := make([]int, 3)
+	for i, width := range widths {
+		n, err := strconv.Atoi(width)
+		if err != nil || n < 0 {
+			return column, fmt.Errorf("invalid output format %q", spec)
+		}
+		values[i] = n
+	}
+	column.PadL, column.Len, column.PadR = values[0], values[1], values[2]
+	return column, nil
+}
+
+/*
+ * Width is the number of characters the column occupies between the separators.
+ */
+func (c Column) Width() int {
+	return c.PadL + c.Len + c.PadR
+}
+
+/*
+ * Header returns the column name centred in the column, truncated if too long.
+ */
+func (c Column) Header() string {
+	name := c.Name
+	width := c.Width()
+	if len(name) > width {
+		name = name[:width]
+	}
+	left := (width - len(name)) / 2
+	return strings.Repeat(" ", left) + name + strings.Repeat(" ", width-left-len(name))
+}
+
+/*
+ * Cell formats value for the column.
+ */
+func (c Column) Cell(value int) string {
+	var text string
+	switch c.Format {
+	case 'B':
+		text = formatBase(value, 2, c.Len)
+	case 'X':
+		text = formatBase(value, 16, c.Len)
+	case 'S':
+		text = strconv.Itoa(value)
+	default:
+		text = strconv.Itoa(value)
+	}
+	return c.pad(text)
+}
+
+/*
+ * Text formats a string value (e.g. the simulator time "3+") for the column.
+ */
+func (c Column) Text(text string) string {
+	return c.pad(text)
+}
+
+func (c Column) pad(text string) string {
+	if len(text) > c.Len {
+		text = text[len(text)-c.Len:]
+	}
+	if c.Format == 'S' {
+		text = text + strings.Repeat(" ", c.Len-len(text))
+	} else {
+		text = strings.Repeat(" ", c.Len-len(text)) + text
+	}
+	return strings.Repeat(" ", c.PadL) + text + strings.Repeat(" ", c.PadR)
+}
+
+/*
+ * formatBase renders the low bits of value as a zero-padded number of the given
+ * number of digits.
+ */
+func formatBase(value int, base int, digits int) string {
+	bits := uint(digits)
+	if base == 16 {
+		bits *= 4
+	}
+	unsigned := uint64(int64(value))
+	if bits < 64 {
+		unsigned &= (1 << bits) - 1
+	}
+	text := strconv.FormatUint(unsigned, base)
+	text = strings.ToUpper(text)
+	if len(text) < digits {
+		text = strings.Repeat("0", digits-len(text)) + text
+	}
+	return text
+}
+
+func (r *Runner) header() string {
+	var b strings.Builder
+	b.WriteString("|")
+	for _, column := range r.columns {
+		b.WriteString(column.Header())
+		b.WriteString("|")
+	}
+	return b.String()
+}
+
+func (r *Runner) row() (string, error) {
+	if r.Simulator == nil {
+		return "", fmt.Errorf("output before load")
+	}
+	var b strings.Builder
+	b.WriteString("|")
+	for _, column := range r.columns {
+		if timer, ok := r.Simulator.(interface{ Time() string }); ok && column.Name == "time" {
+			b.WriteString(column.Text(timer.Time()))
+		} else {
+			value, err := r.Simulator.Get(column.Name)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(column.Cell(value))
+		}
+		b.WriteString("|")
+	}
+	return b.String(), nil
+}
+
+/*
+ * simulatorFor picks the simulator for the file a script loads.
+ */
+func simulatorFor(name string) (Simulator, error) {
+	switch filepath.Ext(name) {
+	case ".asm", ".hack":
+		return &CPUSimulator{}, nil
+	case ".hdl":
+		return &HardwareSimulator{}, nil
+	case ".vm", "":
+		return nil, fmt.Errorf("%s: VM emulator scripts are not supported", name)
+	}
+	return nil, fmt.Errorf("%s: no simulator for this file type", name)
+}
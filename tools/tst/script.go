@@ -0,0 +1,190 @@
+package tst
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ * Statement is one command of a test script, e.g. `set RAM[0] 256` or
+ * `repeat 60 { ticktock; }`. Loops carry their statements in Body.
+ */
+type Statement struct {
+	Command string
+	Args    []string
+	Body    []Statement
+	Line    int
+}
+
+type token struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+/*
+ * Parse reads the statements of a .tst script.
+ */
+func Parse(source string) ([]Statement, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	statements, rest, err := parseBlock(tokens, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected %q", rest[0].line, rest[0].text)
+	}
+	return statements, nil
+}
+
+func parseBlock(tokens []token, nested bool) ([]Statement, []token, error) {
+	var statements []Statement
+	for len(tokens) > 0 {
+		first := tokens[0]
+		if !first.quoted {
+			switch first.text {
+			case "}":
+				if !nested {
+					return nil, nil, fmt.Errorf("line %d: unexpected }", first.line)
+				}
+				return statements, tokens[1:], nil
+			case ",", ";":
+				tokens = tokens[1:]
+				continue
+			}
+		}
+
+		statement := Statement{Command: first.text, Line: first.line}
+		tokens = tokens[1:]
+		for len(tokens) > 0 && !isDelimiter(tokens[0]) {
+			statement.Args = append(statement.Args, tokens[0].text)
+			tokens = tokens[1:]
+		}
+
+		if statement.Command == "repeat" || statement.Command == "while" {
+			if len(tokens) == 0 || tokens[0].text != "{" {
+				return nil, nil, fmt.Errorf("line %d: %s without {", first.line, statement.Command)
+			}
+			body, rest, err := parseBlock(tokens[1:], true)
+			if err != nil {
+				return nil, nil, err
+			}
+			statement.Body = body
+			tokens = rest
+		} else if len(tokens) > 0 && tokens[0].text == "{" {
+			return nil, nil, fmt.Errorf("line %d: unexpected {", tokens[0].line)
+		}
+		statements = append(statements, statement)
+	}
+	if nested {
+		return nil, nil, fmt.Errorf("missing }")
+	}
+	return statements, nil, nil
+}
+
+func isDelimiter(t token) bool {
+	if t.quoted {
+		return false
+	}
+	switch t.text {
+	case ",", ";", "{", "}":
+		return true
+	}
+	return false
+}
+
+/*
+ * tokenize splits a script into words, quoted strings and the punctuation
+ * characters , ; { }, dropping line and block comments.
+ */
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	line := 1
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			i += 2
+		case r == ',' || r == ';' || r == '{' || r == '}':
+			tokens = append(tokens, token{text: string(r), line: line})
+			i++
+		case r == '"':
+			start := i + 1
+			i++
+			for i < len(runes) && runes[i] != '"' && runes[i] != '\n' {
+				i++
+			}
+			if i >= len(runes) || runes[i] != '"' {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{text: string(runes[start:i]), line: line, quoted: true})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(",;{}\"", runes[i]) {
+				if runes[i] == '/' && i+1 < len(runes) && (runes[i+1] == '/' || runes[i+1] == '*') {
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, token{text: string(runes[start:i]), line: line})
+		}
+	}
+	return tokens, nil
+}
+
+/*
+ * ParseValue reads a script value: a decimal number, or a number in the
+ * %B (binary), %X (hexadecimal) or %D (decimal) notation.
+ */
+func ParseValue(text string) (int, error) {
+	base := 10
+	digits := text
+	if strings.HasPrefix(text, "%") && len(text) > 2 {
+		switch text[1] {
+		case 'B':
+			base = 2
+		case 'X':
+			base = 16
+		case 'D':
+			base = 10
+		default:
+			return 0, fmt.Errorf("invalid value %q", text)
+		}
+		digits = text[2:]
+	}
+	value, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", text)
+	}
+	if base != 10 && value > 32767 && value < 65536 {
+		// binary and hex literals are 16-bit two's complement words
+		value -= 65536
+	}
+	return int(value), nil
+}
@@ -0,0 +1,190 @@
+package tst
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+	"github.com/christopher-weiss/nand2tetris/tools/hdl"
+	"github.com/christopher-weiss/nand2tetris/tools/vcd"
+)
+
+/*
+ * Tracer is implemented by simulators that can record a waveform. Trace starts
+ * recording the signals matching patterns (see Selected) into w, from the
+ * program or chip loaded now or next; the caller flushes w when done.
+ */
+type Tracer interface {
+	Trace(w *vcd.Writer, patterns []string) error
+}
+
+/*
+ * Selected reports whether a traced signal matches one of the patterns. A
+ * pattern names a signal (out, Register_0.Bit_3.out), a scope whose signals
+ * are all traced (Register_0) or is a glob with * and ? (RAM[1?], *.load);
+ * all selects every signal. Without patterns, only the signals of the loaded
+ * chip itself are traced, not those of its parts.
+ */
+func Selected(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return !strings.Contains(name, ".")
+	}
+	// brackets are part of names like RAM[0], not character classes
+	literal := strings.NewReplacer("[", `\[`, "]", `\]`)
+	for _, pattern := range patterns {
+		if pattern == "all" || pattern == name || strings.HasPrefix(name, pattern+".") {
+			return true
+		}
+		if matched, _ := path.Match(literal.Replace(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+type tracedSignal struct {
+	index  int
+	signal hdl.Signal
+}
+
+/*
+ * Trace records pins and internal signals of the chip, including those of its
+ * HDL parts (builtin parts have no internal signals), as a variable per signal
+ * in a VCD scope per part instance, plus clk, which is high between tick and
+ * tock. There is one time unit per eval, tick and tock.
+ */
+func (s *HardwareSimulator) Trace(w *vcd.Writer, patterns []string) error {
+	if s.trace != nil {
+		return fmt.Errorf("only one chip can be traced per script")
+	}
+	s.trace, s.patterns = w, patterns
+	if s.Circuit != nil {
+		return s.declare()
+	}
+	return nil
+}
+
+func (s *HardwareSimulator) declare() error {
+	s.traced = nil
+	// hasSelected reports whether a scope has a selected signal, so that no
+	// empty scopes are declared
+	hasSelected := func(scope *hdl.Scope, prefix string) bool {
+		found := false
+		scope.Walk(func(name string, signal hdl.Signal) {
+			found = found || Selected(prefix+name, s.patterns)
+		})
+		return found
+	}
+	var declare func(scope *hdl.Scope, prefix string)
+	declare = func(scope *hdl.Scope, prefix string) {
+		for _, signal := range scope.Signals {
+			if Selected(prefix+signal.Name, s.patterns) {
+				s.traced = append(s.traced, tracedSignal{s.trace.Var(signal.Name, signal.Width), signal})
+			}
+		}
+		for _, child := range scope.Children {
+			if hasSelected(child, prefix+child.Name+".") {
+				s.trace.Scope(child.Name)
+				declare(child, prefix+child.Name+".")
+				s.trace.EndScope()
+			}
+		}
+	}
+	s.trace.Scope(s.Circuit.Chip.Name)
+	s.clock = s.trace.Var("clk", 1)
+	declare(s.Circuit.Scope(), "")
+	s.trace.EndScope()
+	if len(s.traced) == 0 {
+		return fmt.Errorf("no signal of %s matches %s", s.Circuit.Chip.Name, strings.Join(s.patterns, ","))
+	}
+	s.samples = 0
+	s.dump()
+	return nil
+}
+
+func (s *HardwareSimulator) dump() {
+	if s.trace == nil {
+		return
+	}
+	for _, t := range s.traced {
+		s.trace.Set(t.index, s.Circuit.Value(t.signal))
+	}
+	clock := 0
+	if s.ticked {
+		clock = 1
+	}
+	s.trace.Set(s.clock, clock)
+	s.trace.Dump(s.samples)
+	s.samples++
+}
+
+/*
+ * cpuSignals are traced by default: the registers and the instruction at PC,
+ * about to be executed.
+ */
+var cpuSignals = []string{"A", "D", "PC", "instruction"}
+
+type tracedWord struct {
+	index int
+	name  string
+}
+
+/*
+ * Trace records the registers of the CPU, the instruction at PC and the RAM
+ * words named by the patterns, e.g. RAM[0] or RAM[1?], once per instruction;
+ * all stands for the registers and RAM[0] to RAM[15], the virtual registers.
+ * The time is the number of instructions executed.
+ */
+func (s *CPUSimulator) Trace(w *vcd.Writer, patterns []string) error {
+	if s.trace != nil {
+		return fmt.Errorf("only one program can be traced per script")
+	}
+	var words []string
+	all := len(patterns) == 0
+	for _, pattern := range patterns {
+		if pattern == "all" {
+			all = true
+		} else {
+			words = append(words, pattern)
+		}
+	}
+	s.trace = w
+	w.Scope("CPU")
+	for _, name := range cpuSignals {
+		if all || Selected(name, words) {
+			s.traced = append(s.traced, tracedWord{w.Var(name, 16), name})
+		}
+	}
+	for address := 0; address < cpu.RAMSize; address++ {
+		name := fmt.Sprintf("RAM[%d]", address)
+		if all && len(patterns) > 0 && address < 16 || len(words) > 0 && Selected(name, words) {
+			// brackets would read as a bit range in GTKWave
+			s.traced = append(s.traced, tracedWord{w.Var(fmt.Sprintf("RAM_%d", address), 16), name})
+		}
+	}
+	w.EndScope()
+	if len(s.traced) == 0 {
+		return fmt.Errorf("no CPU register or RAM word matches %s", strings.Join(patterns, ","))
+	}
+	if s.CPU != nil {
+		s.dump()
+	}
+	return nil
+}
+
+func (s *CPUSimulator) dump() {
+	if s.trace == nil {
+		return
+	}
+	for _, t := range s.traced {
+		var value int
+		if t.name == "instruction" {
+			value = int(s.CPU.ROM[s.CPU.PC&(cpu.ROMSize-1)])
+		} else {
+			value, _ = s.Get(t.name)
+		}
+		s.trace.Set(t.index, value)
+	}
+	s.trace.Dump(s.CPU.Cycles)
+}
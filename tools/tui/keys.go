@@ -0,0 +1,88 @@
+package tui
+
+/*
+ * control keys the TUI handles itself rather than passing to the program.
+ */
+const (
+	ctrlC = 0x03
+	ctrlD = 0x04
+	ctrlP = 0x10
+	ctrlQ = 0x11
+	ctrlR = 0x12
+	ctrlU = 0x15
+)
+
+/*
+ * sequences maps the escape sequences terminals send for special keys to
+ * Hack key codes.
+ */
+var sequences = map[string]int16{
+	"\x1b[A": 131, "\x1b[B": 133, "\x1b[C": 132, "\x1b[D": 130,
+	"\x1bOA": 131, "\x1bOB": 133, "\x1bOC": 132, "\x1bOD": 130,
+	"\x1b[H": 134, "\x1b[F": 135, "\x1bOH": 134, "\x1bOF": 135,
+	"\x1b[1~": 134, "\x1b[4~": 135, "\x1b[7~": 134, "\x1b[8~": 135,
+	"\x1b[2~": 138, "\x1b[3~": 139, "\x1b[5~": 136, "\x1b[6~": 137,
+	"\x1bOP": 141, "\x1bOQ": 142, "\x1bOR": 143, "\x1bOS": 144,
+	"\x1b[15~": 145, "\x1b[17~": 146, "\x1b[18~": 147, "\x1b[19~": 148,
+	"\x1b[20~": 149, "\x1b[21~": 150, "\x1b[23~": 151, "\x1b[24~": 152,
+}
+
+/*
+ * keypress is a key read from the terminal: a Hack key code, or a control
+ * key of the TUI.
+ */
+type keypress struct {
+	code    int16
+	control byte
+}
+
+/*
+ * decodeKeys splits what one read from the terminal returned into keys. An
+ * escape alone is the Esc key; unknown sequences are dropped.
+ */
+func decodeKeys(input []byte) []keypress {
+	var keys []keypress
+	for i := 0; i < len(input); {
+		b := input[i]
+		switch {
+		case b == 0x1b:
+			n := sequenceLength(input[i:])
+			if n == 1 {
+				keys = append(keys, keypress{code: 140})
+			} else if code, ok := sequences[string(input[i:i+n])]; ok {
+				keys = append(keys, keypress{code: code})
+			}
+			i += n
+			continue
+		case b == '\r' || b == '\n':
+			keys = append(keys, keypress{code: 128})
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, keypress{code: 129})
+		case b < 0x20:
+			keys = append(keys, keypress{control: b})
+		case b < 0x7f:
+			keys = append(keys, keypress{code: int16(b)})
+		}
+		i++
+	}
+	return keys
+}
+
+/*
+ * sequenceLength returns the length of the escape sequence input starts
+ * with: ESC [ parameters final, ESC O final, or ESC alone.
+ */
+func sequenceLength(input []byte) int {
+	if len(input) < 3 || input[1] != '[' && input[1] != 'O' {
+		return 1
+	}
+	if input[1] == 'O' {
+		return 3
+	}
+	for n := 2; n < len(input); n++ {
+		if b := input[n]; b >= 0x40 && b <= 0x7e {
+			return n + 1
+		}
+	}
+	return len(input)
+}
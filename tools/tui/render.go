@@ -0,0 +1,134 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+)
+
+/*
+ * Mode is how the screen is drawn with text: BRAILLE shows 2x4 pixels per
+ * character, HALF 1x2 with the half block characters, which more fonts draw
+ * solidly.
+ */
+type Mode int
+
+const (
+	BRAILLE Mode = iota
+	HALF
+)
+
+/*
+ * ParseMode reads a mode by name, braille or half.
+ */
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "braille":
+		return BRAILLE, nil
+	case "half":
+		return HALF, nil
+	}
+	return 0, fmt.Errorf("unknown mode %q, expected braille or half", name)
+}
+
+/*
+ * cell returns the pixels a character shows at scale 1.
+ */
+func (m Mode) cell() (width, height int) {
+	if m == HALF {
+		return 1, 2
+	}
+	return 2, 4
+}
+
+/*
+ * Size returns the characters the screen takes in a mode at a scale.
+ */
+func Size(mode Mode, scale int) (columns, rows int) {
+	width, height := mode.cell()
+	width, height = width*scale, height*scale
+	return (cpu.ScreenWidth + width - 1) / width, (cpu.ScreenHeight + height - 1) / height
+}
+
+/*
+ * FitScale returns the smallest scale at which the screen fits in columns by
+ * rows characters, or the largest scale that makes sense if none does.
+ */
+func FitScale(mode Mode, columns, rows int) int {
+	scale := 1
+	for ; scale < 8; scale++ {
+		if c, r := Size(mode, scale); c <= columns && r <= rows {
+			break
+		}
+	}
+	return scale
+}
+
+/*
+ * braille numbers the dots of a braille character by column and row.
+ */
+var braille = [2][4]rune{{0x01, 0x02, 0x04, 0x40}, {0x08, 0x10, 0x20, 0x80}}
+
+/*
+ * Render draws the screen as lines of text. At a scale above 1 each dot or
+ * half block stands for scale x scale pixels and is set if any of them is
+ * black, so thin lines do not vanish.
+ */
+func Render(c *cpu.CPU, mode Mode, scale int) []string {
+	black := func(x, y int) bool {
+		for dy := 0; dy < scale; dy++ {
+			row := y*scale + dy
+			if row >= cpu.ScreenHeight {
+				break
+			}
+			for dx := 0; dx < scale; dx++ {
+				column := x*scale + dx
+				if column >= cpu.ScreenWidth {
+					break
+				}
+				if uint16(c.RAM[cpu.SCREEN+row*32+column/16])>>(column%16)&1 != 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	columns, rows := Size(mode, scale)
+	width, height := mode.cell()
+	lines := make([]string, rows)
+	line := make([]rune, columns)
+	for r := 0; r < rows; r++ {
+		for col := 0; col < columns; col++ {
+			if mode == HALF {
+				top, bottom := black(col, r*height), black(col, r*height+1)
+				switch {
+				case top && bottom:
+					line[col] = '█'
+				case top:
+					line[col] = '▀'
+				case bottom:
+					line[col] = '▄'
+				default:
+					line[col] = ' '
+				}
+				continue
+			}
+			dots := rune(0)
+			for dx := 0; dx < width; dx++ {
+				for dy := 0; dy < height; dy++ {
+					if black(col*width+dx, r*height+dy) {
+						dots |= braille[dx][dy]
+					}
+				}
+			}
+			// a blank braille character is narrower than a space in some fonts
+			if dots == 0 {
+				line[col] = ' '
+			} else {
+				line[col] = 0x2800 + dots
+			}
+		}
+		lines[r] = string(line)
+	}
+	return lines
+}
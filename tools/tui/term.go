@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+/*
+ * The terminal is configured with stty, which every Linux and macOS system
+ * has, rather than with ioctls, to keep the tools free of dependencies.
+ */
+
+func stty(terminal *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = terminal
+	out, err := cmd.Output()
+	if exit, ok := err.(*exec.ExitError); ok && len(exit.Stderr) > 0 {
+		return "", fmt.Errorf("%s", strings.TrimSpace(string(exit.Stderr)))
+	}
+	if err != nil {
+		return "", fmt.Errorf("stty %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+/*
+ * makeRaw turns off line buffering, echo and signals on the terminal and
+ * returns a function that restores its settings.
+ */
+func makeRaw(terminal *os.File) (restore func(), err error) {
+	saved, err := stty(terminal, "-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty(terminal, "raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(terminal, saved) }, nil
+}
+
+/*
+ * terminalSize returns the rows and columns of the terminal.
+ */
+func terminalSize(terminal *os.File) (rows, columns int, err error) {
+	size, err := stty(terminal, "size")
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscan(size, &rows, &columns); err != nil {
+		return 0, 0, fmt.Errorf("stty size: unexpected output %q", size)
+	}
+	return rows, columns, nil
+}
@@ -0,0 +1,186 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+)
+
+/*
+ * fps is how often the screen is redrawn and the keyboard polled.
+ */
+const fps = 30
+
+/*
+ * Options configure a TUI session. Scale 0 picks the smallest scale that fits
+ * the terminal; Speed is in cycles per second, 0 for as fast as the emulator
+ * goes. Terminals report key presses but not releases, so a key is held down
+ * for Hold after the terminal last sent it; holding a key down makes the
+ * terminal repeat it.
+ */
+type Options struct {
+	Mode  Mode
+	Scale int
+	Speed uint64
+	Hold  time.Duration
+}
+
+/*
+ * Run runs the program on c in the terminal, which in must be, drawing its
+ * screen to out with live registers and passing the keys typed to the KBD
+ * register, until the user presses Ctrl-C or Ctrl-Q. Ctrl-P pauses, Ctrl-U
+ * and Ctrl-D double and halve the speed and Ctrl-R resets the CPU.
+ */
+func Run(c *cpu.CPU, in *os.File, out io.Writer, options Options) error {
+	scale := options.Scale
+	if scale == 0 {
+		rows, columns, err := terminalSize(in)
+		if err != nil {
+			return err
+		}
+		scale = FitScale(options.Mode, columns, rows-2)
+	}
+	restore, err := makeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	input := make(chan []byte)
+	go func() {
+		buffer := make([]byte, 256)
+		for {
+			n, err := in.Read(buffer)
+			if err != nil {
+				close(input)
+				return
+			}
+			input <- append([]byte(nil), buffer[:n]...)
+		}
+	}()
+
+	w := bufio.NewWriter(out)
+	// the alternate screen keeps the shell's scrollback intact
+	fmt.Fprint(w, "\x1b[?1049h\x1b[?25l\x1b[2J")
+	defer func() {
+		fmt.Fprint(w, "\x1b[?25h\x1b[?1049l")
+		w.Flush()
+	}()
+
+	speed := options.Speed
+	paused := false
+	var held time.Time
+	var shown []string
+	var rate float64
+	lastCycles, lastSample := c.Cycles, time.Now()
+	ticker := time.NewTicker(time.Second / fps)
+	defer ticker.Stop()
+	for {
+		select {
+		case data, ok := <-input:
+			if !ok {
+				return nil
+			}
+			for _, key := range decodeKeys(data) {
+				switch key.control {
+				case 0:
+					c.RAM[cpu.KBD] = key.code
+					held = time.Now()
+				case ctrlC, ctrlQ:
+					return nil
+				case ctrlP:
+					paused = !paused
+				case ctrlU:
+					if speed != 0 {
+						speed *= 2
+					}
+				case ctrlD:
+					if speed == 0 {
+						speed = uint64(rate)
+					}
+					speed = max(speed/2, fps)
+				case ctrlR:
+					c.Reset()
+					lastCycles = 0
+				}
+			}
+		case now := <-ticker.C:
+			if c.RAM[cpu.KBD] != 0 && now.Sub(held) > options.Hold {
+				c.RAM[cpu.KBD] = 0
+			}
+			if !paused {
+				run(c, speed, now)
+			}
+			if elapsed := now.Sub(lastSample); elapsed >= time.Second {
+				rate = float64(c.Cycles-lastCycles) / elapsed.Seconds()
+				lastCycles, lastSample = c.Cycles, now
+			}
+			shown = draw(w, c, options.Mode, scale, shown, status(c, rate, speed, paused))
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+/*
+ * run executes a frame's worth of cycles at speed, or as many as fit in most
+ * of a frame if speed is 0.
+ */
+func run(c *cpu.CPU, speed uint64, start time.Time) {
+	if speed != 0 {
+		c.Run(max(speed/fps, 1))
+		return
+	}
+	deadline := start.Add(time.Second * 3 / 4 / fps)
+	for time.Now().Before(deadline) {
+		c.Run(10000)
+	}
+}
+
+/*
+ * status shows the registers, the cycle count and the speed, then the keys.
+ */
+func status(c *cpu.CPU, rate float64, speed uint64, paused bool) []string {
+	target := "unthrottled"
+	if speed != 0 {
+		target = "of " + perSecond(float64(speed))
+	}
+	line := fmt.Sprintf("PC %5d  A %6d  D %6d  KBD %3d  cycles %d  %s %s", c.PC, c.A, c.D, c.RAM[cpu.KBD], c.Cycles, perSecond(rate), target)
+	if paused {
+		line += "  [paused]"
+	}
+	return []string{line, "^C quit  ^P pause  ^U faster  ^D slower  ^R reset"}
+}
+
+func perSecond(rate float64) string {
+	switch {
+	case rate >= 1e6:
+		return fmt.Sprintf("%.2fM/s", rate/1e6)
+	case rate >= 1e3:
+		return fmt.Sprintf("%.1fk/s", rate/1e3)
+	}
+	return fmt.Sprintf("%.0f/s", rate)
+}
+
+/*
+ * draw writes the lines of the screen that changed since shown, then the
+ * status lines, and returns the lines now shown.
+ */
+func draw(w io.Writer, c *cpu.CPU, mode Mode, scale int, shown []string, status []string) []string {
+	lines := Render(c, mode, scale)
+	for i, line := range lines {
+		if shown == nil || shown[i] != line {
+			fmt.Fprintf(w, "\x1b[%d;1H%s", i+1, line)
+		}
+	}
+	for i, line := range status {
+		fmt.Fprintf(w, "\x1b[%d;1H%s\x1b[K", len(lines)+i+1, strings.TrimRight(line, " "))
+	}
+	return lines
+}
@@ -0,0 +1,132 @@
+package vcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+/*
+ * Writer writes a Value Change Dump, the waveform format GTKWave and most HDL
+ * simulators read. Variables are declared first, grouped in scopes; after that
+ * each Dump writes a time stamp and the variables whose value changed since the
+ * previous one.
+ */
+type Writer struct {
+	w        *bufio.Writer
+	vars     []variable
+	scopes   int
+	declared bool
+	time     uint64
+	dumped   bool
+}
+
+type variable struct {
+	id      string
+	width   int
+	value   uint64
+	shown   uint64
+	written bool
+}
+
+/*
+ * NewWriter starts a dump with one time unit of the given length, e.g. "1 ns".
+ */
+func NewWriter(w io.Writer, timescale string) *Writer {
+	v := &Writer{w: bufio.NewWriter(w)}
+	fmt.Fprintln(v.w, "$version nand2tetris n2t $end")
+	fmt.Fprintf(v.w, "$timescale %s $end\n", timescale)
+	return v
+}
+
+/*
+ * Scope opens a scope (a module instance in GTKWave's tree) for the variables
+ * declared until the matching EndScope.
+ */
+func (v *Writer) Scope(name string) {
+	fmt.Fprintf(v.w, "$scope module %s $end\n", name)
+	v.scopes++
+}
+
+func (v *Writer) EndScope() {
+	fmt.Fprintln(v.w, "$upscope $end")
+	v.scopes--
+}
+
+/*
+ * Var declares a variable of the given width in the current scope and returns
+ * its index for Set.
+ */
+func (v *Writer) Var(name string, width int) int {
+	id := identifier(len(v.vars))
+	if width == 1 {
+		fmt.Fprintf(v.w, "$var wire 1 %s %s $end\n", id, name)
+	} else {
+		fmt.Fprintf(v.w, "$var wire %d %s %s [%d:0] $end\n", width, id, name, width-1)
+	}
+	v.vars = append(v.vars, variable{id: id, width: width})
+	return len(v.vars) - 1
+}
+
+/*
+ * identifier is the short code naming variable i in the value changes, written
+ * in base 94 with the printable characters ! to ~.
+ */
+func identifier(i int) string {
+	id := []byte{byte('!' + i%94)}
+	for i /= 94; i > 0; i /= 94 {
+		id = append(id, byte('!'+i%94))
+	}
+	return string(id)
+}
+
+/*
+ * Set gives variable index its value as of the next Dump.
+ */
+func (v *Writer) Set(index int, value int) {
+	mask := uint64(1)<<uint(v.vars[index].width) - 1
+	v.vars[index].value = uint64(value) & mask
+}
+
+/*
+ * Dump writes the values that changed at the given time, which must not be
+ * earlier than that of the previous Dump.
+ */
+func (v *Writer) Dump(time uint64) {
+	if !v.declared {
+		for v.scopes > 0 {
+			v.EndScope()
+		}
+		fmt.Fprintln(v.w, "$enddefinitions $end")
+		v.declared = true
+	}
+	stamped := false
+	for i := range v.vars {
+		variable := &v.vars[i]
+		if variable.written && variable.value == variable.shown {
+			continue
+		}
+		if !stamped && (!v.dumped || time != v.time) {
+			fmt.Fprintf(v.w, "#%d\n", time)
+		}
+		stamped = true
+		if variable.width == 1 {
+			fmt.Fprintf(v.w, "%d%s\n", variable.value, variable.id)
+		} else {
+			fmt.Fprintf(v.w, "b%s %s\n", strconv.FormatUint(variable.value, 2), variable.id)
+		}
+		variable.written = true
+		variable.shown = variable.value
+	}
+	if stamped {
+		v.time, v.dumped = time, true
+	}
+}
+
+/*
+ * Flush writes out what is buffered; call it when the simulation ends.
+ */
+func (v *Writer) Flush() error {
+	return v.w.Flush()
+}
@@ -0,0 +1,66 @@
+package vcd
+
+import (
+	"strings"
+	"testing"
+)
+
+/*
+ * TestWriter traces a bit and a bus in a scope and checks the declarations
+ * and that only values that changed are written, under one time stamp each.
+ */
+func TestWriter(t *testing.T) {
+	var out strings.Builder
+	w := NewWriter(&out, "1 ns")
+	w.Scope("PC")
+	clk := w.Var("clk", 1)
+	pc := w.Var("out", 16)
+	for time, values := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {0, 1}, {1, -1}} {
+		w.Set(clk, values[0])
+		w.Set(pc, values[1])
+		w.Dump(uint64(time))
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := `$version nand2tetris n2t $end
+$timescale 1 ns $end
+$scope module PC $end
+$var wire 1 ! clk $end
+$var wire 16 " out [15:0] $end
+$upscope $end
+$enddefinitions $end
+#0
+0!
+b0 "
+#1
+1!
+#2
+0!
+b1 "
+#4
+1!
+b1111111111111111 "
+`
+	if out.String() != want {
+		t.Errorf("dump is\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+/*
+ * TestIdentifier checks that variable codes stay unique past the 94
+ * printable characters.
+ */
+func TestIdentifier(t *testing.T) {
+	seen := map[string]int{}
+	for i := 0; i < 94*94+10; i++ {
+		id := identifier(i)
+		if other, ok := seen[id]; ok {
+			t.Fatalf("variables %d and %d are both %q", other, i, id)
+		}
+		seen[id] = i
+	}
+	if identifier(0) != "!" || identifier(93) != "~" || identifier(94) != `!"` {
+		t.Errorf("identifiers 0, 93, 94 are %q, %q, %q", identifier(0), identifier(93), identifier(94))
+	}
+}
@@ -0,0 +1,762 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type CommandType int
+
+const (
+	C_ARITHMETIC CommandType = iota
+	C_PUSH
+	C_POP
+	C_LABEL
+	C_GOTO
+	C_IF
+	C_FUNCTION
+	C_RETURN
+	C_CALL
+)
+
+/*
+ * Command is a parsed VM command. File is the base name of its .vm file,
+ * which qualifies static variables, and Path the file's path when it was read
+ * from disk rather than compiled or built in.
+ */
+type Command struct {
+	CommandType CommandType
+	Command     string
+	Segment     string
+	Index       uint
+	File        string
+	Line        int
+	Path        string
+}
+
+/*
+ * String formats the command as a line of a .vm file.
+ */
+func (c Command) String() string {
+	switch c.CommandType {
+	case C_PUSH, C_POP, C_FUNCTION, C_CALL:
+		return fmt.Sprintf("%s %s %d", c.Command, c.Segment, c.Index)
+	case C_LABEL, C_GOTO, C_IF:
+		return fmt.Sprintf("%s %s", c.Command, c.Segment)
+	}
+	return c.Command
+}
+
+/*
+ * Features selects the command set the translator accepts: the stack arithmetic
+ * and memory access commands of project 07, or those plus the program flow and
+ * function calling commands of project 08.
+ */
+type Features int
+
+const (
+	StackArithmetic Features = iota
+	ProgramFlow
+)
+
+/*
+ * Base addresses of the segments that live at fixed places in RAM.
+ */
+const (
+	pointerBase = 3
+	tempBase    = 5
+)
+
+var segmentPointers = map[string]string{
+	"local":    "LCL",
+	"argument": "ARG",
+	"this":     "THIS",
+	"that":     "THAT",
+}
+
+var arithmeticCommands = map[string]bool{
+	"add": true, "sub": true, "neg": true,
+	"eq": true, "gt": true, "lt": true,
+	"and": true, "or": true, "not": true,
+}
+
+/*
+ * translator carries the state needed while translating a program: counters for
+ * generated labels and the function the current command belongs to.
+ */
+type translator struct {
+	features   Features
+	labelCount int
+	callCount  int
+	function   string
+}
+
+/*
+ * Translate parsed VM commands into Hack assembly, one instruction per string.
+ * With ProgramFlow, programs that define Sys.init start with the bootstrap code,
+ * and programs that call functions end with the shared calling sequences;
+ * programs that compare with gt or lt end with the shared comparisons.
+ */
+func Translate(commands []Command, features Features) ([]string, error) {
+	op, _, err := TranslateMapped(commands, features)
+	return op, err
+}
+
+/*
+ * SourceMap locates the VM commands of a translated program in ROM, in the
+ * order of their code. Code the translator adds itself, the bootstrap and the
+ * shared routines, is mapped to commands without a File named after it.
+ */
+type SourceMap struct {
+	Entries []MapEntry
+}
+
+/*
+ * MapEntry is a command whose code starts at ROM address Address, within
+ * the named function. Labels and functions without locals have no code and
+ * share their address with the next command.
+ */
+type MapEntry struct {
+	Address  int
+	Command  Command
+	Function string
+}
+
+/*
+ * Lookup returns the command whose code contains the ROM address.
+ */
+func (m *SourceMap) Lookup(address int) (MapEntry, bool) {
+	i := sort.Search(len(m.Entries), func(i int) bool { return m.Entries[i].Address > address }) - 1
+	if i < 0 {
+		return MapEntry{}, false
+	}
+	return m.Entries[i], true
+}
+
+/*
+ * TranslateMapped translates like Translate and also returns where the code
+ * of each command starts in ROM.
+ */
+func TranslateMapped(commands []Command, features Features) ([]string, *SourceMap, error) {
+	t := &translator{features: features}
+	var op []string
+	sourceMap := &SourceMap{}
+	address := 0
+	emit := func(code []string, command Command) {
+		sourceMap.Entries = append(sourceMap.Entries, MapEntry{address, command, t.function})
+		for _, line := range code {
+			if !strings.HasPrefix(line, "(") {
+				address++
+			}
+		}
+		op = append(op, code...)
+	}
+	bootstrapped := features == ProgramFlow && definesFunction(commands, "Sys.init")
+	if bootstrapped {
+		emit(t.bootstrap(), Command{Command: "bootstrap"})
+	}
+	for _, command := range commands {
+		code, err := t.translate(command)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s.vm:%d: %v", command.File, command.Line, err)
+		}
+		emit(code, command)
+	}
+	// the bootstrap calls Sys.init even if the program calls nothing
+	calls := features == ProgramFlow && (bootstrapped || callsFunctions(commands))
+	if jumps := comparisons(commands); calls || len(jumps) > 0 {
+		t.function = ""
+		emit(routines(calls, jumps), Command{Command: "shared routines"})
+	}
+	return op, sourceMap, nil
+}
+
+/*
+ * comparisons returns the jumps of the gt and lt commands of a program, whose
+ * shared routines it needs.
+ */
+func comparisons(commands []Command) []string {
+	used := map[string]bool{}
+	for _, command := range commands {
+		switch command.Command {
+		case "gt":
+			used["JGT"] = true
+		case "lt":
+			used["JLT"] = true
+		}
+	}
+	var jumps []string
+	for _, jump := range []string{"JGT", "JLT"} {
+		if used[jump] {
+			jumps = append(jumps, jump)
+		}
+	}
+	return jumps
+}
+
+func callsFunctions(commands []Command) bool {
+	for _, command := range commands {
+		if command.CommandType == C_CALL || command.CommandType == C_RETURN {
+			return true
+		}
+	}
+	return false
+}
+
+func definesFunction(commands []Command, name string) bool {
+	for _, command := range commands {
+		if command.CommandType == C_FUNCTION && command.Segment == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *translator) translate(command Command) ([]string, error) {
+	if command.CommandType >= C_LABEL && t.features == StackArithmetic {
+		return nil, fmt.Errorf("%s is a program flow command; translate with ProgramFlow", command.Command)
+	}
+	switch command.CommandType {
+	case C_PUSH:
+		return push(command.Segment, command.Index, command.File)
+	case C_POP:
+		return pop(command.Segment, command.Index, command.File)
+	case C_ARITHMETIC:
+		switch command.Command {
+		case "add":
+			return binary("M=D+M"), nil
+		case "sub":
+			return binary("M=M-D"), nil
+		case "and":
+			return binary("M=D&M"), nil
+		case "or":
+			return binary("M=D|M"), nil
+		case "neg":
+			return unary("M=-M"), nil
+		case "not":
+			return unary("M=!M"), nil
+		case "eq":
+			return t.compare("JEQ"), nil
+		case "gt":
+			return t.compare("JGT"), nil
+		case "lt":
+			return t.compare("JLT"), nil
+		}
+	case C_LABEL:
+		return label(t.scoped(command.Segment)), nil
+	case C_GOTO:
+		return gotoLabel(t.scoped(command.Segment)), nil
+	case C_IF:
+		return gotoIf(t.scoped(command.Segment)), nil
+	case C_FUNCTION:
+		t.function = command.Segment
+		return function(command.Segment, command.Index), nil
+	case C_CALL:
+		return t.call(command.Segment, command.Index), nil
+	case C_RETURN:
+		return returnFromFunc(), nil
+	}
+	return nil, fmt.Errorf("unknown command %q", command.Command)
+}
+
+/*
+ * scoped qualifies a label with the enclosing function, e.g. Main.loop$WHILE.
+ */
+func (t *translator) scoped(label string) string {
+	if t.function == "" {
+		return label
+	}
+	return fmt.Sprintf("%s$%s", t.function, label)
+}
+
+func (t *translator) bootstrap() []string {
+	var op []string
+	// initialize stack pointer to Mem[256]
+	op = append(op, "@256")
+	op = append(op, "D=A")
+	op = append(op, "@SP")
+	op = append(op, "M=D")
+	op = append(op, t.call("Sys.init", 0)...)
+	return op
+}
+
+/*
+ * pushD pushes the D register onto the stack.
+ */
+func pushD() []string {
+	var op []string
+	op = append(op, "@SP")
+	op = append(op, "A=M")
+	op = append(op, "M=D")
+	op = append(op, "@SP")
+	op = append(op, "M=M+1")
+	return op
+}
+
+/*
+ * popD pops the top of the stack into the D register.
+ */
+func popD() []string {
+	var op []string
+	op = append(op, "@SP")
+	op = append(op, "AM=M-1")
+	op = append(op, "D=M")
+	return op
+}
+
+func push(segment string, index uint, file string) ([]string, error) {
+	var op []string
+	switch segment {
+	case "constant":
+		if index > 32767 {
+			return nil, fmt.Errorf("constant %d out of range", index)
+		}
+		op = append(op, fmt.Sprintf("@%d", index))
+		op = append(op, "D=A")
+	case "local", "argument", "this", "that":
+		op = append(op, fmt.Sprintf("@%d", index))
+		op = append(op, "D=A")
+		op = append(op, fmt.Sprintf("@%s", segmentPointers[segment]))
+		op = append(op, "A=D+M")
+		op = append(op, "D=M")
+	default:
+		address, err := fixedAddress(segment, index, file)
+		if err != nil {
+			return nil, err
+		}
+		op = append(op, fmt.Sprintf("@%s", address))
+		op = append(op, "D=M")
+	}
+	op = append(op, pushD()...)
+	return op, nil
+}
+
+func pop(segment string, index uint, file string) ([]string, error) {
+	var op []string
+	switch segment {
+	case "constant":
+		return nil, fmt.Errorf("cannot pop to constant")
+	case "local", "argument", "this", "that":
+		// target address in R13, then store the popped value there
+		op = append(op, fmt.Sprintf("@%d", index))
+		op = append(op, "D=A")
+		op = append(op, fmt.Sprintf("@%s", segmentPointers[segment]))
+		op = append(op, "D=D+M")
+		op = append(op, "@R13")
+		op = append(op, "M=D")
+		op = append(op, popD()...)
+		op = append(op, "@R13")
+		op = append(op, "A=M")
+		op = append(op, "M=D")
+	default:
+		address, err := fixedAddress(segment, index, file)
+		if err != nil {
+			return nil, err
+		}
+		op = append(op, popD()...)
+		op = append(op, fmt.Sprintf("@%s", address))
+		op = append(op, "M=D")
+	}
+	return op, nil
+}
+
+/*
+ * fixedAddress resolves the pointer, temp and static segments, which map to
+ * fixed RAM locations (statics become assembler variables named File.index).
+ */
+func fixedAddress(segment string, index uint, file string) (string, error) {
+	switch segment {
+	case "pointer":
+		if index > 1 {
+			return "", fmt.Errorf("index %d out of range for pointer (only 0 and 1 are valid)", index)
+		}
+		return strconv.Itoa(pointerBase + int(index)), nil
+	case "temp":
+		if index > 7 {
+			return "", fmt.Errorf("index %d out of range for temp (0-7)", index)
+		}
+		return strconv.Itoa(tempBase + int(index)), nil
+	case "static":
+		if index > 239 {
+			return "", fmt.Errorf("index %d out of range for static (0-239)", index)
+		}
+		return fmt.Sprintf("%s.%d", file, index), nil
+	}
+	return "", fmt.Errorf("unknown segment %q", segment)
+}
+
+/*
+ * binary applies a two operand instruction, operating with D = y and M = x,
+ * leaving the result in place of x.
+ */
+func binary(instruction string) []string {
+	var op []string
+	op = append(op, popD()...)
+	op = append(op, "A=A-1")
+	op = append(op, instruction)
+	return op
+}
+
+/*
+ * unary applies a one operand instruction to the top of the stack in place.
+ */
+func unary(instruction string) []string {
+	var op []string
+	op = append(op, "@SP")
+	op = append(op, "A=M-1")
+	op = append(op, instruction)
+	return op
+}
+
+/*
+ * compare replaces x and y with -1 (true) if x-y satisfies jump, 0 otherwise.
+ * x-y overflows a word when x and y have different signs, as for -30000 and
+ * 30000, so gt and lt save the return address in R14 and jump to a shared
+ * routine that compares the signs first (see compareRoutine).
+ */
+func (t *translator) compare(jump string) []string {
+	n := t.labelCount
+	t.labelCount++
+
+	var op []string
+	if jump != "JEQ" {
+		returnAddr := fmt.Sprintf("COMPARE_RETURN%d", n)
+		op = append(op, fmt.Sprintf("@%s", returnAddr))
+		op = append(op, "D=A")
+		op = append(op, "@R14")
+		op = append(op, "M=D")
+		op = append(op, gotoLabel(compareRoutines[jump])...)
+		op = append(op, fmt.Sprintf("(%s)", returnAddr))
+		return op
+	}
+	isTrue := fmt.Sprintf("COMPARE_TRUE%d", n)
+	op = append(op, popD()...)
+	op = append(op, "A=A-1")
+	op = append(op, "D=M-D")
+	op = append(op, "M=-1")
+	op = append(op, fmt.Sprintf("@%s", isTrue))
+	op = append(op, "D;JEQ")
+	op = append(op, "@SP")
+	op = append(op, "A=M-1")
+	op = append(op, "M=0")
+	op = append(op, fmt.Sprintf("(%s)", isTrue))
+	return op
+}
+
+func label(label string) []string {
+	var op []string
+	op = append(op, fmt.Sprintf("(%s)", label))
+	return op
+}
+
+func gotoLabel(label string) []string {
+	var op []string
+	op = append(op, fmt.Sprintf("@%s", label))
+	op = append(op, "0;JMP")
+	return op
+}
+
+func gotoIf(label string) []string {
+	var op []string
+	op = append(op, popD()...)
+	op = append(op, fmt.Sprintf("@%s", label))
+	op = append(op, "D;JNE")
+	return op
+}
+
+func function(fn string, localc uint) []string {
+	var op []string
+	// create function label
+	op = append(op, fmt.Sprintf("(%s)", fn))
+	// initialize locals to 0
+	for i := uint(0); i < localc; i++ {
+		op = append(op, "@SP")
+		op = append(op, "A=M")
+		op = append(op, "M=0")
+		op = append(op, "@SP")
+		op = append(op, "M=M+1")
+	}
+	return op
+}
+
+/*
+ * call saves the return address, the argument count and the callee's address
+ * in R13..R15 and jumps to the shared calling sequence, which keeps each call
+ * site short enough for the Jack OS and a program to fit in ROM together.
+ */
+func (t *translator) call(fn string, argc uint) []string {
+	returnAddr := fmt.Sprintf("%s$ret.%d", fn, t.callCount)
+	t.callCount++
+
+	var op []string
+	op = append(op, fmt.Sprintf("@%s", returnAddr))
+	op = append(op, "D=A")
+	op = append(op, "@R13")
+	op = append(op, "M=D")
+	op = append(op, fmt.Sprintf("@%d", argc+5))
+	op = append(op, "D=A")
+	op = append(op, "@R14")
+	op = append(op, "M=D")
+	op = append(op, fmt.Sprintf("@%s", fn))
+	op = append(op, "D=A")
+	op = append(op, "@R15")
+	op = append(op, "M=D")
+	op = append(op, gotoLabel(callRoutine)...)
+	op = append(op, fmt.Sprintf("(%s)", returnAddr))
+	return op
+}
+
+func returnFromFunc() []string {
+	return gotoLabel(returnRoutine)
+}
+
+const (
+	endLabel      = "VM_END"
+	callRoutine   = "VM_CALL"
+	returnRoutine = "VM_RETURN"
+)
+
+/*
+ * compareRoutines are the shared routines of gt and lt by their jump.
+ */
+var compareRoutines = map[string]string{"JGT": "VM_GT", "JLT": "VM_LT"}
+
+/*
+ * compareRoutine replaces x and y with -1 if x-y satisfies jump, 0 otherwise,
+ * and returns to the address in R14. When the signs of x and y differ, x-y
+ * may overflow, but its sign is that of x; otherwise x-y is exact.
+ */
+func compareRoutine(jump string) []string {
+	name := compareRoutines[jump]
+	xNegative, sameSign, decide, isTrue := name+"$NEGATIVE", name+"$SAME", name+"$DECIDE", name+"$TRUE"
+	var op []string
+	op = append(op, fmt.Sprintf("(%s)", name))
+	// keep y in R13 and look at the sign of x
+	op = append(op, popD()...)
+	op = append(op, "@R13")
+	op = append(op, "M=D")
+	op = append(op, "@SP")
+	op = append(op, "A=M-1")
+	op = append(op, "D=M")
+	op = append(op, fmt.Sprintf("@%s", xNegative))
+	op = append(op, "D;JLT")
+	// x >= 0: if y < 0, x-y is positive
+	op = append(op, "@R13")
+	op = append(op, "D=M")
+	op = append(op, fmt.Sprintf("@%s", sameSign))
+	op = append(op, "D;JGE")
+	op = append(op, "D=1")
+	op = append(op, fmt.Sprintf("@%s", decide))
+	op = append(op, "0;JMP")
+	// x < 0: if y >= 0, x-y is negative
+	op = append(op, fmt.Sprintf("(%s)", xNegative))
+	op = append(op, "@R13")
+	op = append(op, "D=M")
+	op = append(op, fmt.Sprintf("@%s", sameSign))
+	op = append(op, "D;JLT")
+	op = append(op, "D=-1")
+	op = append(op, fmt.Sprintf("@%s", decide))
+	op = append(op, "0;JMP")
+	// same signs: x-y cannot overflow
+	op = append(op, fmt.Sprintf("(%s)", sameSign))
+	op = append(op, "@R13")
+	op = append(op, "D=M")
+	op = append(op, "@SP")
+	op = append(op, "A=M-1")
+	op = append(op, "D=M-D")
+	op = append(op, fmt.Sprintf("(%s)", decide))
+	op = append(op, "@SP")
+	op = append(op, "A=M-1")
+	op = append(op, "M=-1")
+	op = append(op, fmt.Sprintf("@%s", isTrue))
+	op = append(op, fmt.Sprintf("D;%s", jump))
+	op = append(op, "@SP")
+	op = append(op, "A=M-1")
+	op = append(op, "M=0")
+	op = append(op, fmt.Sprintf("(%s)", isTrue))
+	op = append(op, "@R14")
+	op = append(op, "A=M")
+	op = append(op, "0;JMP")
+	return op
+}
+
+/*
+ * routines are the code shared by the commands of a program: the calling
+ * sequences of call and return if calls is set, and the comparisons of gt and
+ * lt for the given jumps. They are placed after the program behind an endless
+ * loop so that a program running off its end never falls into them.
+ */
+func routines(calls bool, jumps []string) []string {
+	var op []string
+	op = append(op, fmt.Sprintf("(%s)", endLabel))
+	op = append(op, gotoLabel(endLabel)...)
+	for _, jump := range jumps {
+		op = append(op, compareRoutine(jump)...)
+	}
+	if !calls {
+		return op
+	}
+
+	op = append(op, fmt.Sprintf("(%s)", callRoutine))
+	// push return address (R13)
+	op = append(op, "@R13")
+	op = append(op, "D=M")
+	op = append(op, pushD()...)
+	// save the caller's frame
+	for _, pointer := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		op = append(op, fmt.Sprintf("@%s", pointer))
+		op = append(op, "D=M")
+		op = append(op, pushD()...)
+	}
+	// reposition ARG (SP-5-argc, with argc+5 in R14)
+	op = append(op, "@SP")
+	op = append(op, "D=M")
+	op = append(op, "@R14")
+	op = append(op, "D=D-M")
+	op = append(op, "@ARG")
+	op = append(op, "M=D")
+	// reposition LCL
+	op = append(op, "@SP")
+	op = append(op, "D=M")
+	op = append(op, "@LCL")
+	op = append(op, "M=D")
+	// goto the function (R15)
+	op = append(op, "@R15")
+	op = append(op, "A=M")
+	op = append(op, "0;JMP")
+
+	op = append(op, fmt.Sprintf("(%s)", returnRoutine))
+	// store LCL (the frame) in R13
+	op = append(op, "@LCL")
+	op = append(op, "D=M")
+	op = append(op, "@R13")
+	op = append(op, "M=D")
+	// put return address (Memory[R13-5]) in R14
+	op = append(op, "@5")
+	op = append(op, "A=D-A")
+	op = append(op, "D=M")
+	op = append(op, "@R14")
+	op = append(op, "M=D")
+	// Reposition the return value for the caller
+	op = append(op, popD()...)
+	op = append(op, "@ARG")
+	op = append(op, "A=M")
+	op = append(op, "M=D")
+	// Restore SP of the caller (SP=ARG+1)
+	op = append(op, "@ARG")
+	op = append(op, "D=M+1")
+	op = append(op, "@SP")
+	op = append(op, "M=D")
+	// Restore THAT, THIS, ARG and LCL of the caller (Memory[R13-1] .. Memory[R13-4])
+	for _, pointer := range []string{"THAT", "THIS", "ARG", "LCL"} {
+		op = append(op, "@R13")
+		op = append(op, "AM=M-1")
+		op = append(op, "D=M")
+		op = append(op, fmt.Sprintf("@%s", pointer))
+		op = append(op, "M=D")
+	}
+	// Goto return address (Memory[R14])
+	op = append(op, "@R14")
+	op = append(op, "A=M")
+	op = append(op, "0;JMP")
+	return op
+}
+
+/*
+ * Parse the VM commands of a .vm source. name is the file the commands come
+ * from; its base name qualifies the static variables, e.g. Main.vm -> Main.0.
+ */
+func Parse(name string, source io.Reader) ([]Command, error) {
+	file := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	var commands []Command
+	lineNumber := 0
+	scanner := bufio.NewScanner(source)
+	for scanner.Scan() {
+		lineNumber++
+		var command, ok, err = parseLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, lineNumber, err)
+		}
+		if ok {
+			command.File = file
+			command.Line = lineNumber
+			commands = append(commands, command)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+func parseLine(line string) (Command, bool, error) {
+	// remove comments && split on whitespace
+	tokens := strings.Fields(stripComment(line))
+
+	// ignore empty lines
+	if len(tokens) == 0 {
+		return Command{}, false, nil
+	}
+
+	command := Command{Command: tokens[0]}
+	arguments := 0
+	switch tokens[0] {
+	case "push":
+		command.CommandType = C_PUSH
+		arguments = 2
+	case "pop":
+		command.CommandType = C_POP
+		arguments = 2
+	case "label":
+		command.CommandType = C_LABEL
+		arguments = 1
+	case "goto":
+		command.CommandType = C_GOTO
+		arguments = 1
+	case "if-goto":
+		command.CommandType = C_IF
+		arguments = 1
+	case "function":
+		command.CommandType = C_FUNCTION
+		arguments = 2
+	case "call":
+		command.CommandType = C_CALL
+		arguments = 2
+	case "return":
+		command.CommandType = C_RETURN
+	default:
+		if !arithmeticCommands[tokens[0]] {
+			return Command{}, false, fmt.Errorf("unknown command %q", tokens[0])
+		}
+		command.CommandType = C_ARITHMETIC
+	}
+
+	if len(tokens)-1 != arguments {
+		return Command{}, false, fmt.Errorf("%s expects %d arguments, got %d", tokens[0], arguments, len(tokens)-1)
+	}
+	if arguments >= 1 {
+		command.Segment = tokens[1]
+	}
+	if arguments == 2 {
+		value, err := strconv.ParseUint(tokens[2], 10, 16)
+		if err != nil {
+			return Command{}, false, fmt.Errorf("expecting uint value for index, got %q", tokens[2])
+		}
+		command.Index = uint(value)
+	}
+
+	return command, true, nil
+}
+
+func stripComment(source string) string {
+	if comment := strings.Index(source, "//"); comment >= 0 {
+		return strings.TrimRightFunc(source[:comment], unicode.IsSpace)
+	}
+	return source
+}
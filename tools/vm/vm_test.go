@@ -0,0 +1,188 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/christopher-weiss/nand2tetris/tools/asm"
+	"github.com/christopher-weiss/nand2tetris/tools/cpu"
+)
+
+/*
+ * run translates VM sources, given by file name, assembles them and runs the
+ * program on the Hack emulator for the given number of instructions.
+ */
+func run(t *testing.T, sources map[string]string, cycles uint64) *cpu.CPU {
+	t.Helper()
+	var commands []Command
+	for _, name := range []string{"Sys.vm", "Main.vm"} {
+		parsed, err := Parse(name, strings.NewReader(sources[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, parsed...)
+	}
+	program, err := Translate(commands, ProgramFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := asm.Assemble(strings.NewReader(strings.Join(program, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := cpu.ParseWords(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cpu.New(words)
+	c.Run(cycles)
+	return c
+}
+
+/*
+ * TestCallAndReturn runs nested calls through the shared calling sequences:
+ * arguments and return values, a function without arguments, whose return
+ * value overwrites the slot of its return address, and the restored frame of
+ * the caller.
+ */
+func TestCallAndReturn(t *testing.T) {
+	c := run(t, map[string]string{
+		"Sys.vm": `
+function Sys.init 0
+push constant 1234
+pop pointer 0
+push constant 3
+push constant 4
+call Main.add 2
+pop static 0
+call Main.seven 0
+pop static 1
+label END
+goto END
+`,
+		"Main.vm": `
+function Main.add 1
+push argument 0
+push argument 1
+add
+pop local 0
+push constant 5000
+pop pointer 0
+push local 0
+call Main.double 1
+return
+function Main.double 0
+push argument 0
+push argument 0
+add
+return
+function Main.seven 0
+push constant 7
+return
+`,
+	}, 10000)
+
+	// Sys.0 and Sys.1 are the first variables
+	if c.RAM[16] != 14 {
+		t.Errorf("Main.add(3, 4) doubled is %d, want 14", c.RAM[16])
+	}
+	if c.RAM[17] != 7 {
+		t.Errorf("Main.seven() is %d, want 7", c.RAM[17])
+	}
+	// the bootstrap calls Sys.init with SP at 256, whose frame is 5 words
+	want := map[int]int16{cpu.SP: 261, cpu.LCL: 261, cpu.ARG: 256, cpu.THIS: 1234}
+	for address, value := range want {
+		if c.RAM[address] != value {
+			t.Errorf("RAM[%d] is %d after the calls, want %d", address, c.RAM[address], value)
+		}
+	}
+}
+
+/*
+ * TestRecursion computes a Fibonacci number recursively, many calls deep.
+ */
+func TestRecursion(t *testing.T) {
+	c := run(t, map[string]string{
+		"Sys.vm": `
+function Sys.init 0
+push constant 12
+call Main.fibonacci 1
+pop static 0
+label END
+goto END
+`,
+		"Main.vm": `
+function Main.fibonacci 0
+push argument 0
+push constant 2
+lt
+if-goto BASE
+push argument 0
+push constant 1
+sub
+call Main.fibonacci 1
+push argument 0
+push constant 2
+sub
+call Main.fibonacci 1
+add
+return
+label BASE
+push argument 0
+return
+`,
+	}, 1000000)
+	if c.RAM[16] != 144 {
+		t.Errorf("fibonacci(12) is %d, want 144", c.RAM[16])
+	}
+	if c.RAM[cpu.SP] != 261 {
+		t.Errorf("SP is %d after the calls, want 261", c.RAM[cpu.SP])
+	}
+}
+
+/*
+ * TestCompareOverflow compares operands whose difference does not fit in a
+ * word, such as -30000 and 30000, as well as ones of the same sign.
+ */
+func TestCompareOverflow(t *testing.T) {
+	tests := []struct {
+		x, y    int
+		command string
+		want    int16
+	}{
+		{-30000, 30000, "lt", -1},
+		{-30000, 30000, "gt", 0},
+		{30000, -30000, "lt", 0},
+		{30000, -30000, "gt", -1},
+		{-32767, 1, "lt", -1},
+		{32767, -2, "gt", -1},
+		{0, -1, "gt", -1},
+		{-1, 0, "lt", -1},
+		{-5, -3, "lt", -1},
+		{-5, -3, "gt", 0},
+		{7, 7, "lt", 0},
+		{-30000, 30000, "eq", 0},
+		{-7, -7, "eq", -1},
+	}
+	pushConstant := func(value int) string {
+		if value < 0 {
+			return fmt.Sprintf("push constant %d\nneg\n", -value)
+		}
+		return fmt.Sprintf("push constant %d\n", value)
+	}
+	var sys strings.Builder
+	sys.WriteString("function Sys.init 0\n")
+	for i, test := range tests {
+		sys.WriteString(pushConstant(test.x))
+		sys.WriteString(pushConstant(test.y))
+		fmt.Fprintf(&sys, "%s\npop static %d\n", test.command, i)
+	}
+	sys.WriteString("label END\ngoto END\n")
+	c := run(t, map[string]string{"Sys.vm": sys.String(), "Main.vm": ""}, 10000)
+	for i, test := range tests {
+		if got := c.RAM[16+i]; got != test.want {
+			t.Errorf("%d %s %d is %d, want %d", test.x, test.command, test.y, got, test.want)
+		}
+	}
+}